@@ -0,0 +1,259 @@
+package plow
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewCertStore creates an empty [CertStore].
+func NewCertStore() *CertStore {
+	return &CertStore{}
+}
+
+// CertStore holds TLS certificates of the server and selects them
+// by the server name (SNI) requested by the client, see [Server.ServeTLSStore].
+//
+// The certificate is selected by the exact name of its DNS SANs
+// (or the subject common name if it has no SANs), then by the wildcard name
+// such as "*.example.com" matching one label, otherwise the first added certificate is used.
+//
+// Certificates added from files are reloaded by [CertStore.Reload] and [CertStore.Watch]
+// when the files change, the certificates are replaced atomically, so handshakes
+// in progress keep the previous ones and a failed reload keeps serving the current certificate.
+//
+// CertStore is safe for concurrent use.
+type CertStore struct {
+
+	// OnReloadError is called by [CertStore.Watch] when certificate files cannot be reloaded,
+	// the current certificate keeps being served until the files are changed again.
+	OnReloadError func(err error)
+
+	mu      sync.Mutex
+	entries []*certEntry
+	index   atomic.Pointer[certIndex]
+}
+
+type certEntry struct {
+	certFile, keyFile string
+	stamp             certFileStamp
+	cert              *tls.Certificate
+}
+
+// certFileStamp identifies the version of certificate files,
+// so unchanged files are not reloaded.
+type certFileStamp struct {
+	certMod, keyMod   time.Time
+	certSize, keySize int64
+}
+
+type certIndex struct {
+	names    map[string]*tls.Certificate
+	fallback *tls.Certificate
+}
+
+// Add adds the certificate which is never reloaded.
+func (store *CertStore) Add(cert tls.Certificate) error {
+	if err := parseLeaf(&cert); err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.entries = append(store.entries, &certEntry{cert: &cert})
+	store.rebuild()
+	return nil
+}
+
+// AddFile loads the certificate and matching private key from PEM files
+// and adds it, the files are reloaded by [CertStore.Reload] and [CertStore.Watch].
+func (store *CertStore) AddFile(certFile, keyFile string) error {
+	entry := &certEntry{certFile: certFile, keyFile: keyFile}
+	stamp, err := statCertFiles(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := loadCertFiles(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	entry.stamp = stamp
+	entry.cert = cert
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.entries = append(store.entries, entry)
+	store.rebuild()
+	return nil
+}
+
+// Reload reloads certificates whose files have changed since the last load.
+//
+// Certificates which cannot be loaded keep their current version and
+// are not retried until their files change again, the errors are returned joined.
+func (store *CertStore) Reload() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var errs []error
+	var changed bool
+	for _, entry := range store.entries {
+		if entry.certFile == "" {
+			continue
+		}
+
+		stamp, err := statCertFiles(entry.certFile, entry.keyFile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		} else if stamp == entry.stamp {
+			continue
+		}
+		entry.stamp = stamp
+
+		cert, err := loadCertFiles(entry.certFile, entry.keyFile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		entry.cert = cert
+		changed = true
+	}
+
+	if changed {
+		store.rebuild()
+	}
+	return errors.Join(errs...)
+}
+
+// Watch checks certificate files for changes every interval and reloads them
+// until the context is done, errors are reported to the OnReloadError.
+//
+// Watch blocks, so it is usually started in its own goroutine.
+func (store *CertStore) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		panic("plow: non-positive watch interval")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := store.Reload(); err != nil && store.OnReloadError != nil {
+				store.OnReloadError(err)
+			}
+		}
+	}
+}
+
+// GetCertificate selects the certificate for the TLS handshake,
+// it can be used as [tls.Config.GetCertificate].
+func (store *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	index := store.index.Load()
+	if index == nil {
+		return nil, errors.New("plow: no certificates in the store")
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, ok := index.names[name]; ok {
+			return cert, nil
+		}
+		if _, parent, ok := strings.Cut(name, "."); ok {
+			if cert, ok := index.names["*."+parent]; ok {
+				return cert, nil
+			}
+		}
+	}
+	return index.fallback, nil
+}
+
+// rebuild replaces the index of the certificates,
+// names of earlier added certificates take precedence.
+func (store *CertStore) rebuild() {
+	index := &certIndex{
+		names: make(map[string]*tls.Certificate),
+	}
+
+	for _, entry := range store.entries {
+		if index.fallback == nil {
+			index.fallback = entry.cert
+		}
+		for _, name := range certNames(entry.cert.Leaf) {
+			if _, has := index.names[name]; !has {
+				index.names[name] = entry.cert
+			}
+		}
+	}
+
+	store.index.Store(index)
+}
+
+func certNames(leaf *x509.Certificate) []string {
+	names := leaf.DNSNames
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = []string{leaf.Subject.CommonName}
+	}
+
+	result := make([]string, len(names))
+	for i, name := range names {
+		result[i] = strings.ToLower(name)
+	}
+	return result
+}
+
+func parseLeaf(cert *tls.Certificate) error {
+	if cert.Leaf != nil {
+		return nil
+	} else if len(cert.Certificate) == 0 {
+		return errors.New("plow: empty certificate")
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	cert.Leaf = leaf
+	return nil
+}
+
+func loadCertFiles(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("plow: load certificate %s: %w", certFile, err)
+	}
+	if err = parseLeaf(&cert); err != nil {
+		return nil, fmt.Errorf("plow: load certificate %s: %w", certFile, err)
+	}
+	return &cert, nil
+}
+
+func statCertFiles(certFile, keyFile string) (certFileStamp, error) {
+	certInfo, err := os.Stat(certFile)
+	if err != nil {
+		return certFileStamp{}, err
+	}
+	keyInfo, err := os.Stat(keyFile)
+	if err != nil {
+		return certFileStamp{}, err
+	}
+	return certFileStamp{
+		certMod:  certInfo.ModTime(),
+		keyMod:   keyInfo.ModTime(),
+		certSize: certInfo.Size(),
+		keySize:  keyInfo.Size(),
+	}, nil
+}
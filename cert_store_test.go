@@ -0,0 +1,237 @@
+package plow
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oesand/plow/internal/testing_ops"
+	"github.com/oesand/plow/specs"
+)
+
+func writeCertFiles(t *testing.T, dir string, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+
+	certPEM, keyPEM := testing_ops.CertPEM(cert)
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// touchCertFiles moves modification time of files forward,
+// so the change is detected on file systems with coarse time resolution.
+func touchCertFiles(t *testing.T, files ...string) {
+	t.Helper()
+
+	mod := time.Now().Add(time.Minute)
+	for _, file := range files {
+		if err := os.Chtimes(file, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertStore_GetCertificate(t *testing.T) {
+	store := NewCertStore()
+
+	if _, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); err == nil {
+		t.Error("expected error of empty store")
+	}
+
+	certs := map[string]tls.Certificate{
+		"default":  testing_ops.NewServerCert("default.com"),
+		"example":  testing_ops.NewServerCert("", "example.com", "www.example.com"),
+		"wildcard": testing_ops.NewServerCert("", "*.example.com"),
+		"api":      testing_ops.NewServerCert("API.example.org"),
+	}
+	for _, key := range []string{"default", "example", "wildcard", "api"} {
+		if err := store.Add(certs[key]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		serverName string
+		expect     string
+	}{
+		{"example.com", "example"},
+		{"WWW.Example.com", "example"},
+		{"www.example.com.", "example"},
+		{"shop.example.com", "wildcard"},
+		{"deep.shop.example.com", "default"},
+		{"api.example.org", "api"},
+		{"unknown.net", "default"},
+		{"", "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cert.Leaf != certs[tt.expect].Leaf {
+				t.Errorf("expected %s certificate, got %v", tt.expect, cert.Leaf.DNSNames)
+			}
+		})
+	}
+}
+
+func TestCertStore_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertFiles(t, dir, testing_ops.NewServerCert("", "v1.example.com"))
+
+	store := NewCertStore()
+	if err := store.AddFile(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	hello := &tls.ClientHelloInfo{ServerName: "v1.example.com"}
+	first, _ := store.GetCertificate(hello)
+
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ := store.GetCertificate(hello); cert != first {
+		t.Error("expected unchanged files not to be reloaded")
+	}
+
+	// Broken key keeps the current certificate
+	os.WriteFile(keyFile, []byte("broken"), 0o600)
+	touchCertFiles(t, keyFile)
+	if err := store.Reload(); err == nil {
+		t.Error("expected reload error")
+	}
+	if cert, _ := store.GetCertificate(hello); cert != first {
+		t.Error("expected current certificate after failed reload")
+	}
+
+	// Failed version is not retried until files change again
+	if err := store.Reload(); err != nil {
+		t.Errorf("expected no error for unchanged files, got %v", err)
+	}
+
+	writeCertFiles(t, dir, testing_ops.NewServerCert("", "v2.example.com"))
+	touchCertFiles(t, certFile, keyFile)
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "v2.example.com"})
+	if cert == first || cert.Leaf.DNSNames[0] != "v2.example.com" {
+		t.Errorf("expected reloaded certificate, got %v", cert.Leaf.DNSNames)
+	}
+}
+
+func TestCertStore_Watch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertFiles(t, dir, testing_ops.NewServerCert("", "v1.example.com"))
+
+	store := NewCertStore()
+	if err := store.AddFile(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	reloadErrs := make(chan error, 1)
+	store.OnReloadError = func(err error) {
+		select {
+		case reloadErrs <- err:
+		default:
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Watch(ctx, 10*time.Millisecond)
+
+	os.Remove(keyFile)
+	select {
+	case <-reloadErrs:
+	case <-time.After(time.Second):
+		t.Fatal("expected reload error")
+	}
+
+	writeCertFiles(t, dir, testing_ops.NewServerCert("", "v2.example.com"))
+	touchCertFiles(t, certFile, keyFile)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		cert, _ := store.GetCertificate(&tls.ClientHelloInfo{})
+		if cert.Leaf.DNSNames[0] == "v2.example.com" {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("expected certificate to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServer_ServeTLSStore(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertFiles(t, dir, testing_ops.NewServerCert("", "v1.example.com"))
+
+	store := NewCertStore()
+	if err := store.AddFile(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(testing_ops.NewServerCert("", "*.example.org")); err != nil {
+		t.Fatal(err)
+	}
+
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLSStore(listener, store)
+	defer server.Shutdown()
+
+	get := func(serverName string) string {
+		t.Helper()
+
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:    testing_ops.CertPool(),
+				ServerName: serverName,
+			},
+			DisableKeepAlives: true,
+		}}
+		resp, err := client.Get("https://" + listener.Addr().String())
+		if err != nil {
+			t.Fatal("req:", err)
+		}
+		checkHttpResponseBody(t, resp, []byte("okay"))
+		return resp.TLS.PeerCertificates[0].DNSNames[0]
+	}
+
+	if name := get("v1.example.com"); name != "v1.example.com" {
+		t.Errorf("expected v1.example.com certificate, got %s", name)
+	}
+	if name := get("shop.example.org"); name != "*.example.org" {
+		t.Errorf("expected *.example.org certificate, got %s", name)
+	}
+
+	writeCertFiles(t, dir, testing_ops.NewServerCert("", "v2.example.com"))
+	touchCertFiles(t, certFile, keyFile)
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if name := get("v2.example.com"); name != "v2.example.com" {
+		t.Errorf("expected v2.example.com certificate, got %s", name)
+	}
+}
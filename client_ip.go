@@ -0,0 +1,24 @@
+package plow
+
+import (
+	"net"
+
+	"github.com/oesand/plow/internal/proxy"
+)
+
+// ClientIP returns IP of the client which sent the [Request],
+// it is resolved through trusted proxies if [Server.TrustedProxies] is set.
+//
+// Returns nil if the remote address has no IP, such as unix socket.
+func ClientIP(req Request) net.IP {
+	return proxy.AddrIP(req.RemoteAddr())
+}
+
+// PeerAddr returns the address of the immediate peer of the connection of the [Request],
+// such as trusted proxy, unlike Request.RemoteAddr which reports the resolved client address.
+func PeerAddr(req Request) net.Addr {
+	if peer, ok := req.(interface{ PeerAddr() net.Addr }); ok {
+		return peer.PeerAddr()
+	}
+	return req.RemoteAddr()
+}
@@ -0,0 +1,158 @@
+package plow
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/oesand/plow/internal"
+	"github.com/oesand/plow/specs"
+)
+
+var clientTraceKey = internal.FlagKey{Key: "client.trace.key"}
+
+// WithClientTrace returns a copy of [context.Context] in which
+// the provided ClientTrace stored.
+//
+// Used only with Transport or Client for observe stages of requests.
+func WithClientTrace(ctx context.Context, trace *ClientTrace) context.Context {
+	if trace == nil {
+		panic("plow: nil client trace pointer")
+	}
+	return context.WithValue(ctx, clientTraceKey, trace)
+}
+
+// ContextClientTrace returns the [ClientTrace] associated with
+// the provided context. If none, it returns nil.
+func ContextClientTrace(ctx context.Context) *ClientTrace {
+	trace, _ := ctx.Value(clientTraceKey).(*ClientTrace)
+	return trace
+}
+
+// ClientTrace is a set of hooks to run at various stages of an outgoing
+// request made by [Transport]. Any particular hook may be nil.
+//
+// Functions may be called concurrently from different goroutines
+// and some may be called after the request has completed or failed.
+type ClientTrace struct {
+	// DNSStart is called when a host lookup by [Transport.Resolver] begins.
+	DNSStart func(host string)
+
+	// DNSDone is called when a host lookup ends.
+	DNSDone func(ips []net.IP, err error)
+
+	// ConnectStart is called when a new connection's Dial begins.
+	// If [Transport.Resolver] is set, it may be called multiple
+	// times for racing connection attempts.
+	ConnectStart func(network, address string)
+
+	// ConnectDone is called when a new connection's Dial completes.
+	// The provided err indicates whether the connection completed successfully.
+	ConnectDone func(network, address string, err error)
+
+	// ProxyHandshakeStart is called when the handshake
+	// with the proxy (such as CONNECT or SOCKS5) begins.
+	ProxyHandshakeStart func(proxyUrl *specs.Url)
+
+	// ProxyHandshakeDone is called after the handshake
+	// with the proxy completes.
+	ProxyHandshakeDone func(proxyUrl *specs.Url, err error)
+
+	// TLSHandshakeStart is called when the TLS handshake is started.
+	TLSHandshakeStart func()
+
+	// TLSHandshakeDone is called after the TLS handshake with either the
+	// successful handshake's connection state, or a non-nil error on handshake failure.
+	TLSHandshakeDone func(state tls.ConnectionState, err error)
+
+	// WroteHeaders is called after the Transport has written the request headline and headers.
+	WroteHeaders func()
+
+	// WroteRequest is called with the result of writing the
+	// request body, it is called even if request has no body
+	// or the body is not sent as the server replied without "100 Continue".
+	WroteRequest func(err error)
+
+	// Got100Continue is called if the server replies with a "100 Continue" response.
+	Got100Continue func()
+
+	// GotFirstResponseByte is called once when the first byte of the response is available,
+	// including the "100 Continue" response.
+	GotFirstResponseByte func()
+}
+
+func (trace *ClientTrace) dnsStart(host string) {
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(host)
+	}
+}
+
+func (trace *ClientTrace) dnsDone(ips []net.IP, err error) {
+	if trace != nil && trace.DNSDone != nil {
+		trace.DNSDone(ips, err)
+	}
+}
+
+func (trace *ClientTrace) connectStart(network, address string) {
+	if trace != nil && trace.ConnectStart != nil {
+		trace.ConnectStart(network, address)
+	}
+}
+
+func (trace *ClientTrace) connectDone(network, address string, err error) {
+	if trace != nil && trace.ConnectDone != nil {
+		trace.ConnectDone(network, address, err)
+	}
+}
+
+func (trace *ClientTrace) proxyHandshakeStart(proxyUrl *specs.Url) {
+	if trace != nil && trace.ProxyHandshakeStart != nil {
+		trace.ProxyHandshakeStart(proxyUrl)
+	}
+}
+
+func (trace *ClientTrace) proxyHandshakeDone(proxyUrl *specs.Url, err error) {
+	if trace != nil && trace.ProxyHandshakeDone != nil {
+		trace.ProxyHandshakeDone(proxyUrl, err)
+	}
+}
+
+func (trace *ClientTrace) tlsHandshakeStart() {
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+}
+
+func (trace *ClientTrace) tlsHandshakeDone(conn net.Conn, err error) {
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		var state tls.ConnectionState
+		if stater, ok := conn.(interface{ ConnectionState() tls.ConnectionState }); ok && err == nil {
+			state = stater.ConnectionState()
+		}
+		trace.TLSHandshakeDone(state, err)
+	}
+}
+
+func (trace *ClientTrace) wroteHeaders() {
+	if trace != nil && trace.WroteHeaders != nil {
+		trace.WroteHeaders()
+	}
+}
+
+func (trace *ClientTrace) wroteRequest(err error) {
+	if trace != nil && trace.WroteRequest != nil {
+		trace.WroteRequest(err)
+	}
+}
+
+func (trace *ClientTrace) got100Continue() {
+	if trace != nil && trace.Got100Continue != nil {
+		trace.Got100Continue()
+	}
+}
+
+func (trace *ClientTrace) gotFirstResponseByte() {
+	if trace != nil && trace.GotFirstResponseByte != nil {
+		trace.GotFirstResponseByte()
+	}
+}
@@ -0,0 +1,182 @@
+package plow
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oesand/plow/internal/server_ops"
+	"github.com/oesand/plow/socks5"
+	"github.com/oesand/plow/specs"
+)
+
+type traceRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *traceRecorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *traceRecorder) trace() *ClientTrace {
+	return &ClientTrace{
+		DNSStart: func(host string) { r.add("DNSStart") },
+		DNSDone: func(ips []net.IP, err error) {
+			r.add("DNSDone")
+		},
+		ConnectStart: func(network, address string) { r.add("ConnectStart") },
+		ConnectDone: func(network, address string, err error) {
+			if err == nil {
+				r.add("ConnectDone")
+			}
+		},
+		ProxyHandshakeStart: func(proxyUrl *specs.Url) { r.add("ProxyHandshakeStart") },
+		ProxyHandshakeDone: func(proxyUrl *specs.Url, err error) {
+			if err == nil {
+				r.add("ProxyHandshakeDone")
+			}
+		},
+		TLSHandshakeStart: func() { r.add("TLSHandshakeStart") },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil && state.HandshakeComplete {
+				r.add("TLSHandshakeDone")
+			}
+		},
+		WroteHeaders:         func() { r.add("WroteHeaders") },
+		WroteRequest:         func(err error) { r.add("WroteRequest") },
+		Got100Continue:       func() { r.add("Got100Continue") },
+		GotFirstResponseByte: func() { r.add("GotFirstResponseByte") },
+	}
+}
+
+func TestTransport_ClientTrace(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	serverUrl := specs.MustParseUrl(server.URL)
+	transport := DefaultTransport()
+	transport.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	transport.Resolver = ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP(serverUrl.Host)}, nil
+	})
+
+	recorder := &traceRecorder{}
+	ctx := WithClientTrace(context.Background(), recorder.trace())
+
+	url := &specs.Url{Scheme: "https", Host: "example.com", Port: serverUrl.Port, Path: "/"}
+	req := TextRequest(specs.HttpMethodPost, url, specs.ContentTypePlain, "body")
+	req.Header().Set("Expect", "100-continue")
+
+	resp, err := transport.RoundTrip(ctx, req.Method(), req.Url(), req.Header(), req.(BodyWriter))
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	checkResponseBody(t, resp, []byte("OK"))
+
+	expected := []string{
+		"DNSStart", "DNSDone", "ConnectStart", "ConnectDone",
+		"TLSHandshakeStart", "TLSHandshakeDone", "WroteHeaders",
+		"GotFirstResponseByte", "Got100Continue", "WroteRequest",
+	}
+	if !slices.Equal(recorder.events, expected) {
+		t.Errorf("unexpected trace events:\n%s\nwant\n%s",
+			strings.Join(recorder.events, ", "), strings.Join(expected, ", "))
+	}
+}
+
+func TestTransport_ClientTraceFinalWithoutContinue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	url, err := serveTcpTest(ctx, func(conn net.Conn) {
+		bufioReader := bufio.NewReader(conn)
+		if _, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), bufioReader, 1024, 8*1024, false); err != nil {
+			t.Error(err)
+		}
+
+		header := specs.NewHeader()
+		header.Set("Content-Length", "6")
+		if _, err := server_ops.WriteResponseHead(conn, true, specs.StatusCodeForbidden, header); err != nil {
+			t.Error(err)
+		}
+		conn.Write([]byte("denied"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &traceRecorder{}
+	traceCtx := WithClientTrace(ctx, recorder.trace())
+
+	req := TextRequest(specs.HttpMethodPost, url, specs.ContentTypePlain, "body")
+	req.Header().Set("Expect", "100-continue")
+
+	resp, err := DefaultTransport().RoundTrip(traceCtx, req.Method(), req.Url(), req.Header(), req.(BodyWriter))
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	if resp.StatusCode() != specs.StatusCodeForbidden {
+		t.Errorf("unexpected status code: %d", resp.StatusCode())
+	}
+	defer resp.Body().Close()
+	if body, err := io.ReadAll(resp.Body()); err != nil || string(body) != "denied" {
+		t.Errorf("unexpected body: %q, %v", body, err)
+	}
+
+	expected := []string{"ConnectStart", "ConnectDone", "WroteHeaders", "GotFirstResponseByte", "WroteRequest"}
+	if !slices.Equal(recorder.events, expected) {
+		t.Errorf("unexpected trace events:\n%s\nwant\n%s",
+			strings.Join(recorder.events, ", "), strings.Join(expected, ", "))
+	}
+}
+
+func TestTransport_ClientTraceProxy(t *testing.T) {
+	closeServer, url := newTestServer(func(req Request) (specs.StatusCode, *specs.Header, []byte) {
+		header := specs.NewHeader()
+		header.Set("Content-Length", "2")
+		return specs.StatusCodeOK, header, []byte("OK")
+	})
+	defer closeServer()
+
+	proxyServer := socks5.DefaultServer()
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxyListener.Close()
+	go proxyServer.Serve(proxyListener)
+
+	transport := DefaultTransport()
+	transport.Proxy = FixedProxyUrl(specs.MustParseUrl("socks5://" + proxyListener.Addr().String()))
+
+	recorder := &traceRecorder{}
+	ctx := WithClientTrace(context.Background(), recorder.trace())
+
+	resp, err := transport.RoundTrip(ctx, specs.HttpMethodGet, url, specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	checkResponseBody(t, resp, []byte("OK"))
+
+	expected := []string{
+		"ConnectStart", "ConnectDone", "ProxyHandshakeStart", "ProxyHandshakeDone",
+		"WroteHeaders", "WroteRequest", "GotFirstResponseByte",
+	}
+	if !slices.Equal(recorder.events, expected) {
+		t.Errorf("unexpected trace events:\n%s\nwant\n%s",
+			strings.Join(recorder.events, ", "), strings.Join(expected, ", "))
+	}
+}
@@ -0,0 +1,52 @@
+package plow
+
+import "net"
+
+// ConnState represents the state of a connection served by the [Server],
+// see [Server.ConnState].
+type ConnState int
+
+const (
+	// ConnStateNew represents a new connection that is expected
+	// to send a request immediately. It is reported after the
+	// connection is accepted and passed [Server.FilterConn].
+	ConnStateNew ConnState = iota
+
+	// ConnStateActive represents a connection whose request head is read,
+	// it stays active until the response is written.
+	ConnStateActive
+
+	// ConnStateIdle represents a connection that has finished
+	// handling a request and is waiting for a new one in the keep-alive state.
+	ConnStateIdle
+
+	// ConnStateHijacked represents a hijacked connection, see Request.Hijack,
+	// or a connection taken over by the handler of [Server.TLSNextProto].
+	ConnStateHijacked
+
+	// ConnStateClosed represents a closed connection, it is reported
+	// for hijacked connections too after the hijack handler returns.
+	ConnStateClosed
+)
+
+var connStateNames = [...]string{
+	ConnStateNew:      "new",
+	ConnStateActive:   "active",
+	ConnStateIdle:     "idle",
+	ConnStateHijacked: "hijacked",
+	ConnStateClosed:   "closed",
+}
+
+func (state ConnState) String() string {
+	if state < 0 || int(state) >= len(connStateNames) {
+		return "unknown"
+	}
+	return connStateNames[state]
+}
+
+func (srv *Server) setState(conn net.Conn, state ConnState) {
+	srv.Metrics.connState(state)
+	if srv.ConnState != nil {
+		srv.ConnState(conn, state)
+	}
+}
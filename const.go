@@ -2,6 +2,7 @@ package plow
 
 import (
 	"github.com/oesand/plow/internal/server_ops"
+	"github.com/oesand/plow/internal/stream"
 	"github.com/oesand/plow/specs"
 	"io"
 	"net"
@@ -20,8 +21,36 @@ const (
 )
 
 var (
+	// DefaultContentEncodings default value for Server.ContentEncodings parameter
+	DefaultContentEncodings = []string{
+		specs.ContentEncodingGzip,
+		specs.ContentEncodingBrotli,
+		specs.ContentEncodingDeflate,
+	}
+
+	// DefaultEncodingContentTypes default value for Server.EncodingContentTypes parameter
+	DefaultEncodingContentTypes = []string{
+		"text/*",
+		specs.ContentTypeJson,
+		specs.ContentTypeXml,
+		specs.ContentTypeSVG,
+		"application/javascript",
+		"application/ld+json",
+		"application/manifest+json",
+		"application/problem+json",
+		"application/rss+xml",
+		"application/atom+xml",
+		"application/xhtml+xml",
+		"application/wasm",
+		specs.ContentTypeFontTTF,
+		"font/otf",
+	}
+
 	httpV1NextProtoTLS = "http/1.1"
 
+	// responseWriterPool buffers response heads with small bodies of server connections
+	responseWriterPool = stream.BufioWriterPool{MaxSize: 4 << 10}
+
 	defaultDialer = net.Dialer{
 		Timeout:   30 * time.Second,
 		KeepAlive: 10 * time.Second,
@@ -39,6 +68,11 @@ var (
 		Code: specs.StatusCodeRequestEntityTooLarge,
 		Text: "http: too large body.",
 	}
+	responseErrSlowClient = &server_ops.ErrorResponse{
+		Code: specs.StatusCodeRequestTimeout,
+		Text: "http: request is sent too slowly.",
+		Err:  specs.ErrSlowClient,
+	}
 	responseExpectationFailedError = &server_ops.ErrorResponse{
 		Code: specs.StatusCodeExpectationFailed,
 	}
@@ -50,6 +84,10 @@ var (
 		Code: specs.StatusCodeNotImplemented,
 		Text: "http: unsupported transfer encoding",
 	}
+	responseUnsupportedContentEncoding = &server_ops.ErrorResponse{
+		Code: specs.StatusCodeUnsupportedMediaType,
+		Text: "http: unsupported content encoding",
+	}
 	responseInternalServerError = &server_ops.ErrorResponse{
 		Code: specs.StatusCodeInternalServerError,
 		Text: "http: internal server error",
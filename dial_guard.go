@@ -0,0 +1,81 @@
+package plow
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/oesand/plow/internal"
+	"github.com/oesand/plow/specs"
+)
+
+var dialGuardKey = internal.FlagKey{Key: "dial.guard.key"}
+
+var errHostNotAllowed = errors.New("plow: host is not allowed")
+
+// dialGuard checks the IP address and port of the connection before it is established,
+// the connection is refused if it returns error.
+type dialGuard func(ip net.IP, port uint16) error
+
+func withDialGuard(ctx context.Context, guard dialGuard) context.Context {
+	return context.WithValue(ctx, dialGuardKey, guard)
+}
+
+// withoutDialGuard returns the context for dialing proxies,
+// the guard checks addresses of target hosts only.
+func withoutDialGuard(ctx context.Context) context.Context {
+	if contextDialGuard(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, dialGuardKey, dialGuard(nil))
+}
+
+func contextDialGuard(ctx context.Context) dialGuard {
+	guard, _ := ctx.Value(dialGuardKey).(dialGuard)
+	return guard
+}
+
+func (guard dialGuard) checkAddr(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if ip == nil || err != nil {
+		return errHostNotAllowed
+	}
+	return guard(ip, uint16(portNum))
+}
+
+// dial connects by the default dialer which checks the resolved address before connecting,
+// or by the custom dialer which connection is checked by its remote address.
+func (guard dialGuard) dial(ctx context.Context, dialer Dialer, address string) (net.Conn, error) {
+	if dialer == nil {
+		netDialer := defaultDialer
+		netDialer.Control = func(network, address string, c syscall.RawConn) error {
+			return guard.checkAddr(address)
+		}
+		return netDialer.DialContext(ctx, "tcp", address)
+	}
+
+	conn, err := dialer.Dial(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if err = guard.checkAddr(conn.RemoteAddr().String()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func isHostNotAllowed(err error) bool {
+	var opErr *specs.OpError
+	if errors.As(err, &opErr) {
+		err = opErr.Err
+	}
+	return errors.Is(err, errHostNotAllowed)
+}
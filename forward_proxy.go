@@ -0,0 +1,184 @@
+package plow
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/oesand/plow/internal"
+	"github.com/oesand/plow/internal/client_ops"
+	"github.com/oesand/plow/internal/proxy"
+	"github.com/oesand/plow/specs"
+)
+
+// NewForwardProxy creates a [ForwardProxy] that forwards
+// requests through the transport of [NewReverseProxy].
+func NewForwardProxy() *ForwardProxy {
+	return &ForwardProxy{
+		Transport: proxyTransport(),
+	}
+}
+
+// ForwardProxy is a [Handler] that acts as an HTTP proxy server.
+//
+// Requests in absolute-form (such as "GET http://example.com/ HTTP/1.1")
+// are forwarded through the [RoundTripper] with stripped hop-by-hop headers,
+// CONNECT requests establish a tunnel to the requested host by hijacking the connection.
+type ForwardProxy struct {
+	_ internal.NoCopy
+
+	// Transport specifies the mechanism by which forwarded requests are made.
+	// If nil, the transport of [NewReverseProxy] is used.
+	Transport RoundTripper
+
+	// Dialer specifies the dialer for creating CONNECT tunnels.
+	// If Dialer is nil then the proxy dials using package net.
+	Dialer Dialer
+
+	// Authenticate optionally verifies credentials passed by clients
+	// in the 'Proxy-Authorization' header with Basic scheme.
+	//
+	// If Authenticate returns false or credentials are not passed,
+	// [specs.StatusCodeProxyAuthRequired] is answered.
+	// If nil, authentication is not required.
+	Authenticate func(username, password string) bool
+
+	// Realm specifies the realm sent in the 'Proxy-Authenticate' header.
+	//
+	// If empty, "plow" is used.
+	Realm string
+
+	// AllowHosts specifies comma or space separated list of host patterns
+	// in the same notation as NO_PROXY of [ProxyFromEnvironment],
+	// only requests to matched hosts are allowed.
+	//
+	// If empty, requests to any hosts are allowed.
+	AllowHosts string
+
+	// DenyHosts specifies comma or space separated list of host patterns
+	// in the same notation as NO_PROXY of [ProxyFromEnvironment],
+	// requests to matched hosts are forbidden, it takes precedence over AllowHosts.
+	//
+	// IP and CIDR patterns of AllowHosts and DenyHosts are also checked against
+	// the address the host name is resolved to, before the connection is established
+	// by Dialer or [Transport], connections made through other proxies are not checked.
+	// If Dialer or [Transport.Dialer] is set, the remote address of its connection is checked.
+	DenyHosts string
+
+	// Handler optionally serves requests which are not addressed to the proxy,
+	// such as requests in origin-form ("GET /health HTTP/1.1").
+	//
+	// If nil, [specs.StatusCodeBadRequest] is answered.
+	Handler Handler
+
+	once       sync.Once
+	allowHosts proxy.HostPatterns
+	denyHosts  proxy.HostPatterns
+	forward    *ReverseProxy
+}
+
+func (fp *ForwardProxy) beforeOnce() {
+	fp.allowHosts = proxy.ParseHostPatterns(fp.AllowHosts)
+	fp.denyHosts = proxy.ParseHostPatterns(fp.DenyHosts)
+
+	transport := fp.Transport
+	if transport == nil {
+		transport = proxyTransport()
+	}
+	fp.forward = &ReverseProxy{
+		Transport: transport,
+		Rewrite: func(req Request, url *specs.Url, header *specs.Header) {
+			target := req.Url()
+			url.Scheme, url.Host, url.Port = target.Scheme, target.Host, target.Port
+			url.Path = target.Path
+		},
+		DisableForwardedHeaders: true,
+		ErrorResponse: func(req Request, err error) Response {
+			if isHostNotAllowed(err) {
+				return responseHostNotAllowed()
+			}
+			return proxyErrorResponse(err)
+		},
+	}
+}
+
+// Handle implements the [Handler] interface.
+func (fp *ForwardProxy) Handle(ctx context.Context, req Request) Response {
+	fp.once.Do(fp.beforeOnce)
+
+	url := req.Url()
+	isConnect := req.Method() == specs.HttpMethodConnect
+	if !isConnect && url.Host == "" {
+		if fp.Handler != nil {
+			return fp.Handler.Handle(ctx, req)
+		}
+		return TextResponse(specs.StatusCodeBadRequest, specs.ContentTypePlain, "plow: not a proxy request")
+	}
+
+	if fp.Authenticate != nil {
+		username, password, err := specs.ParseBasicAuthHeader(req.Header().Get("Proxy-Authorization"))
+		if err != nil || !fp.Authenticate(username, password) {
+			realm := fp.Realm
+			if realm == "" {
+				realm = "plow"
+			}
+			return EmptyResponse(specs.StatusCodeProxyAuthRequired, func(resp Response) {
+				resp.Header().Set("Proxy-Authenticate", "Basic realm=\""+realm+"\"")
+			})
+		}
+	}
+
+	port := url.Port
+	if port == 0 {
+		port = proxy.SchemeDefaultPortMap[url.Scheme]
+	}
+	host := client_ops.IdnaHost(url.Host)
+
+	if fp.denyHosts.Match(host, port) {
+		return responseHostNotAllowed()
+	}
+
+	// Host names which are not allowed by name may be allowed by the resolved address
+	allowedByName := len(fp.allowHosts) == 0 || fp.allowHosts.Match(host, port)
+	if !allowedByName && (net.ParseIP(host) != nil || !fp.allowHosts.HasIP()) {
+		return responseHostNotAllowed()
+	}
+
+	if fp.denyHosts.HasIP() || !allowedByName {
+		ctx = withDialGuard(ctx, func(ip net.IP, port uint16) error {
+			if fp.denyHosts.MatchIP(ip, port) || (!allowedByName && !fp.allowHosts.MatchIP(ip, port)) {
+				return errHostNotAllowed
+			}
+			return nil
+		})
+	}
+
+	if !isConnect {
+		return fp.forward.Handle(ctx, req)
+	}
+
+	conn, err := fp.dial(ctx, client_ops.HostPort(host, port))
+	if err != nil {
+		return fp.forward.errorResponse(req, err)
+	}
+
+	req.Hijack(func(ctx context.Context, clientConn net.Conn) {
+		tunnelConns(ctx, clientConn, conn)
+	})
+
+	return EmptyResponse(specs.StatusCodeOK)
+}
+
+func (fp *ForwardProxy) dial(ctx context.Context, address string) (net.Conn, error) {
+	if guard := contextDialGuard(ctx); guard != nil {
+		return guard.dial(ctx, fp.Dialer, address)
+	}
+	if fp.Dialer != nil {
+		return fp.Dialer.Dial(ctx, "tcp", address)
+	}
+	return defaultDialer.DialContext(ctx, "tcp", address)
+}
+
+func responseHostNotAllowed() Response {
+	return TextResponse(specs.StatusCodeForbidden, specs.ContentTypePlain, "plow: host is not allowed")
+}
@@ -0,0 +1,272 @@
+package plow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/oesand/plow/specs"
+)
+
+func newForwardProxyTest(t *testing.T, proxy *ForwardProxy) *specs.Url {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := DefaultServer(proxy)
+	go server.Serve(listener)
+
+	return specs.MustParseUrl("http://" + listener.Addr().String())
+}
+
+func TestForwardProxy_HttpRequest(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/items" || r.Header.Get("X-Ping") != "xyz-123" {
+			t.Errorf("unexpected upstream request: %s %+v", r.URL, r.Header)
+		}
+		if r.Header.Get("Proxy-Authorization") != "" {
+			t.Errorf("proxy credentials must not be forwarded: %+v", r.Header)
+		}
+		w.Header().Set("X-Pong", "xyz-321")
+		w.Write([]byte("forwarded"))
+	}))
+	defer upstream.Close()
+
+	proxyUrl := newForwardProxyTest(t, &ForwardProxy{
+		Authenticate: func(username, password string) bool {
+			return username == "user" && password == "pass"
+		},
+	})
+	proxyUrl.Username, proxyUrl.Password = "user", "pass"
+
+	transport := DefaultTransport()
+	transport.Proxy = FixedProxyUrl(proxyUrl)
+
+	header := specs.NewHeader()
+	header.Set("X-Ping", "xyz-123")
+
+	resp, err := transport.RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl(upstream.URL+"/items"), header, nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	if resp.Header().Get("X-Pong") != "xyz-321" {
+		t.Errorf("not found expected headers, %+v", resp.Header())
+	}
+
+	checkResponseBody(t, resp, []byte("forwarded"))
+}
+
+func TestForwardProxy_HttpRequestByHttpClient(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("forwarded"))
+	}))
+	defer upstream.Close()
+
+	proxyUrl := newForwardProxyTest(t, NewForwardProxy())
+
+	client := &http.Client{Transport: &http.Transport{
+		Proxy: http.ProxyURL(&neturl.URL{Scheme: "http", Host: proxyUrl.Host + ":" + strconv.Itoa(int(proxyUrl.Port))}),
+	}}
+
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	checkHttpResponseBody(t, resp, []byte("forwarded"))
+}
+
+func TestForwardProxy_LargeChunkedResponse(t *testing.T) {
+	// The body is larger than the default limit of the transport
+	chunk := bytes.Repeat([]byte("0123456789abcdef"), 4<<10)
+	const chunks = 192
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for range chunks {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	proxyUrl := newForwardProxyTest(t, &ForwardProxy{})
+
+	client := &http.Client{Transport: &http.Transport{
+		Proxy: http.ProxyURL(&neturl.URL{Scheme: "http", Host: proxyUrl.Host + ":" + strconv.Itoa(int(proxyUrl.Port))}),
+	}}
+
+	resp, err := client.Get(upstream.URL + "/download")
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	defer resp.Body.Close()
+
+	size, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		t.Fatal("read:", err)
+	}
+	if expected := int64(len(chunk) * chunks); size != expected {
+		t.Errorf("unexpected body size: %d, want %d", size, expected)
+	}
+}
+
+func TestForwardProxy_AuthRequired(t *testing.T) {
+	proxyUrl := newForwardProxyTest(t, &ForwardProxy{
+		Authenticate: func(username, password string) bool {
+			return false
+		},
+		Realm: "test",
+	})
+
+	transport := DefaultTransport()
+	transport.Proxy = FixedProxyUrl(proxyUrl)
+
+	resp, err := transport.RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl("http://example.com/"), specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	if resp.StatusCode() != specs.StatusCodeProxyAuthRequired ||
+		resp.Header().Get("Proxy-Authenticate") != `Basic realm="test"` {
+		t.Errorf("unexpected response: %d %+v", resp.StatusCode(), resp.Header())
+	}
+}
+
+func TestForwardProxy_ConnectTunnel(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tunneled"))
+	}))
+	defer upstream.Close()
+
+	proxyUrl := newForwardProxyTest(t, NewForwardProxy())
+
+	transport := DefaultTransport()
+	transport.Proxy = FixedProxyUrl(proxyUrl)
+	transport.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	resp, err := transport.RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl(upstream.URL), specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	checkResponseBody(t, resp, []byte("tunneled"))
+}
+
+func TestForwardProxy_HostRules(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("forwarded"))
+	}))
+	defer upstream.Close()
+
+	tlsUpstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("denied host must not be reached")
+	}))
+	defer tlsUpstream.Close()
+
+	upstreamUrl := specs.MustParseUrl(upstream.URL)
+	tlsUpstreamUrl := specs.MustParseUrl(tlsUpstream.URL)
+
+	// Host names not allowed by name are checked by the resolved address
+	proxyTransport := DefaultTransport()
+	proxyTransport.Resolver = ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("192.0.2.1")}, nil
+	})
+
+	proxyUrl := newForwardProxyTest(t, &ForwardProxy{
+		Transport:  proxyTransport,
+		AllowHosts: "127.0.0.0/8",
+		DenyHosts:  "127.0.0.1:" + strconv.Itoa(int(tlsUpstreamUrl.Port)),
+	})
+
+	transport := DefaultTransport()
+	transport.Proxy = FixedProxyUrl(proxyUrl)
+	transport.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	resp, err := transport.RoundTrip(context.Background(), specs.HttpMethodGet, upstreamUrl, specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	checkResponseBody(t, resp, []byte("forwarded"))
+
+	resp, err = transport.RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl("http://example.com/"), specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	if resp.StatusCode() != specs.StatusCodeForbidden {
+		t.Errorf("unexpected status code: %d", resp.StatusCode())
+	}
+
+	_, err = transport.RoundTrip(context.Background(), specs.HttpMethodGet, tlsUpstreamUrl, specs.NewHeader(), nil)
+	if err == nil {
+		t.Error("expected tunnel to denied host to fail")
+	}
+}
+
+func TestForwardProxy_DenyResolvedHost(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("denied host must not be reached")
+	}))
+	defer upstream.Close()
+
+	tlsUpstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("denied host must not be reached")
+	}))
+	defer tlsUpstream.Close()
+
+	// The host name is not denied by name, but it is resolved to the denied address
+	proxyTransport := DefaultTransport()
+	proxyTransport.Resolver = ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("127.0.0.1")}, nil
+	})
+
+	proxyUrl := newForwardProxyTest(t, &ForwardProxy{
+		Transport: proxyTransport,
+		DenyHosts: "127.0.0.0/8",
+	})
+
+	transport := DefaultTransport()
+	transport.Proxy = FixedProxyUrl(proxyUrl)
+	transport.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	url := specs.MustParseUrl(upstream.URL)
+	url.Host = "internal.test"
+	resp, err := transport.RoundTrip(context.Background(), specs.HttpMethodGet, url, specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	if resp.StatusCode() != specs.StatusCodeForbidden {
+		t.Errorf("unexpected status code: %d", resp.StatusCode())
+	}
+
+	// CONNECT tunnels are dialed by the default dialer resolving "localhost"
+	tlsUrl := specs.MustParseUrl(tlsUpstream.URL)
+	tlsUrl.Host = "localhost"
+	_, err = transport.RoundTrip(context.Background(), specs.HttpMethodGet, tlsUrl, specs.NewHeader(), nil)
+	if err == nil {
+		t.Error("expected tunnel to denied address to fail")
+	}
+
+	proxyConn, err := net.Dial("tcp", proxyUrl.Host+":"+strconv.Itoa(int(proxyUrl.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxyConn.Close()
+	proxyConn.Write([]byte("CONNECT localhost:" + strconv.Itoa(int(tlsUrl.Port)) + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	statusLine, err := bufio.NewReader(proxyConn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(statusLine, "HTTP/1.1 403") {
+		t.Errorf("unexpected CONNECT response: %q", statusLine)
+	}
+}
@@ -4,8 +4,6 @@ go 1.23.2
 
 require golang.org/x/net v0.43.0 // direct
 
-require (
-	github.com/andybalholm/brotli v1.2.0 // indirect
-	github.com/armon/go-socks5 v0.0.0-20160902184237-e75332964ef5 // indirect
-	golang.org/x/text v0.28.0 // indirect
-)
+require github.com/andybalholm/brotli v1.2.0
+
+require golang.org/x/text v0.28.0 // indirect
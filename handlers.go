@@ -17,6 +17,14 @@ type HijackHandler = server_ops.HijackHandler
 type NextProtoHandler func(conn *tls.Conn)
 
 // Handler serve HTTP [Server] requests and answer it
+//
+// The context is cancelled if the client closes the connection once the request body
+// is consumed, the cause of the context is [specs.ErrClientDisconnected] then.
+//
+// The request is reused by the server for next requests of the connection:
+// it stays valid until the response, including its body written by [BodyWriter],
+// is sent and the hijack handler, if any, returns. It must not be used after that,
+// for example by goroutines started by the handler.
 type Handler interface {
 	Handle(ctx context.Context, request Request) Response
 }
@@ -45,6 +53,14 @@ type Dialer interface {
 	Dial(ctx context.Context, network, address string) (net.Conn, error)
 }
 
+// Resolver is an interface representing the ability to resolve host name to IP addresses.
+//
+// A Resolver must be concurrent safe for use by multiple goroutines.
+type Resolver interface {
+	// Resolve looks up host and returns a slice of its IP addresses.
+	Resolve(ctx context.Context, host string) ([]net.IP, error)
+}
+
 // TlsDialer is an interface representing the ability to dial tls connection and make Handshake.
 type TlsDialer interface {
 	// Handshake connects to the address on the named network.
@@ -85,6 +101,14 @@ func (f DialerFunc) Dial(ctx context.Context, network, address string) (net.Conn
 	return f(ctx, network, address)
 }
 
+// ResolverFunc shorthand implementation for [Resolver]
+type ResolverFunc func(ctx context.Context, host string) ([]net.IP, error)
+
+// Resolve triggers top level function [ResolverFunc]
+func (f ResolverFunc) Resolve(ctx context.Context, host string) ([]net.IP, error) {
+	return f(ctx, host)
+}
+
 // TlsDialerFunc shorthand implementation for [TlsDialer]
 type TlsDialerFunc func(ctx context.Context, conn net.Conn, host string) (net.Conn, error)
 
@@ -100,3 +124,15 @@ func FixedProxyUrl(url *specs.Url) func(*specs.Url) (*specs.Url, error) {
 		return url, nil
 	}
 }
+
+// FixedProxyChain returns a proxy chain function (for use in a [Transport])
+// that always returns the same chain of URLs.
+func FixedProxyChain(urls ...*specs.Url) func(*specs.Url) ([]*specs.Url, error) {
+	return func(*specs.Url) ([]*specs.Url, error) {
+		chain := make([]*specs.Url, len(urls))
+		for i, url := range urls {
+			chain[i] = cloneProxyUrl(url)
+		}
+		return chain, nil
+	}
+}
@@ -0,0 +1,269 @@
+package plow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/oesand/plow/internal/listen"
+)
+
+// Variables of listeners passed to the new process by [Handoff.Restart],
+// descriptors are laid out as by the systemd socket activation.
+const (
+	handoffFdsEnv   = "PLOW_HANDOFF_FDS"
+	handoffNamesEnv = "PLOW_HANDOFF_FDNAMES"
+	handoffReadyEnv = "PLOW_HANDOFF_READY_FD"
+)
+
+// NewHandoff creates [Handoff] with listeners inherited from the previous process,
+// or from the systemd socket activation if the process is started by systemd.
+func NewHandoff() (*Handoff, error) {
+	handoff := &Handoff{}
+
+	var count int
+	var names []string
+	var err error
+	if fds := os.Getenv(handoffFdsEnv); fds != "" {
+		count, err = listen.ParseFdCount(fds)
+		if err == nil {
+			names = listen.ParseNames(os.Getenv(handoffNamesEnv), count)
+		}
+
+		if fd, convErr := strconv.Atoi(os.Getenv(handoffReadyEnv)); convErr == nil {
+			handoff.ready = os.NewFile(uintptr(fd), "handoff-ready")
+		}
+	} else {
+		count, names, err = listen.ParseSystemdEnv(os.Getpid(), os.Getenv)
+	}
+
+	os.Unsetenv(handoffFdsEnv)
+	os.Unsetenv(handoffNamesEnv)
+	os.Unsetenv(handoffReadyEnv)
+	unsetSystemdEnv()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if count > 0 {
+		handoff.inherited, err = listen.Inherit(count, names)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return handoff, nil
+}
+
+// Handoff passes listeners to the new process of the server for restarts without downtime,
+// such as upgrades of the binary.
+//
+// The new process is started by [Handoff.Restart] with the same listening sockets,
+// so incoming connections are queued while it starts. Once it calls [Handoff.Ready],
+// the current process stops accepting connections with [Server.Shutdown]
+// and exits after active connections are done:
+//
+//	handoff, err := plow.NewHandoff()
+//	listener, err := handoff.Listener("http", func() (net.Listener, error) {
+//		return net.Listen("tcp", ":8080")
+//	})
+//	go server.Serve(listener)
+//	handoff.Ready()
+//
+//	for range upgradeSignal {
+//		if err := handoff.Restart(ctx); err != nil {
+//			log.Println(err) // the current process keeps serving
+//			continue
+//		}
+//		server.Shutdown()
+//		return
+//	}
+//
+// Listeners of the systemd socket activation are inherited the same way,
+// by names set with FileDescriptorName= of the socket units.
+//
+// Handoff is supported on Unix systems.
+type Handoff struct {
+	// Path is the executable of the new process,
+	// if empty the executable of the current process is used.
+	Path string
+
+	// Args are arguments of the new process,
+	// if nil arguments of the current process are used.
+	Args []string
+
+	mu        sync.Mutex
+	inherited map[string][]net.Listener
+	listeners []handoffListener
+	ready     *os.File
+	restarted bool
+}
+
+type handoffListener struct {
+	name     string
+	listener net.Listener
+}
+
+// Listener returns the listener with the name inherited from the previous process,
+// or creates it by the create function, the listener is passed to the new process
+// by [Handoff.Restart] with the same name.
+//
+// Several inherited listeners with the same name, such as ones of [ListenReusePort],
+// are merged by [MultiListener].
+func (handoff *Handoff) Listener(name string, create func() (net.Listener, error)) (net.Listener, error) {
+	if name == "" || strings.Contains(name, ":") {
+		return nil, fmt.Errorf("plow: invalid listener name %q", name)
+	}
+
+	handoff.mu.Lock()
+	defer handoff.mu.Unlock()
+
+	var listener net.Listener
+	if inherited, ok := handoff.inherited[name]; ok {
+		delete(handoff.inherited, name)
+		if len(inherited) == 1 {
+			listener = inherited[0]
+		} else {
+			listener = MultiListener(inherited...)
+		}
+	} else {
+		var err error
+		listener, err = create()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	handoff.listeners = append(handoff.listeners, handoffListener{name, listener})
+	return listener, nil
+}
+
+// Ready tells the previous process that the current one is serving,
+// so the previous process can be shut down.
+// It must be called once servers are started with listeners of [Handoff.Listener].
+//
+// Inherited listeners which are not requested by [Handoff.Listener] are closed.
+func (handoff *Handoff) Ready() error {
+	handoff.mu.Lock()
+	defer handoff.mu.Unlock()
+
+	for _, group := range handoff.inherited {
+		for _, listener := range group {
+			listener.Close()
+		}
+	}
+	handoff.inherited = nil
+
+	if handoff.ready == nil {
+		return nil
+	}
+
+	_, err := handoff.ready.Write([]byte{1})
+	handoff.ready.Close()
+	handoff.ready = nil
+	return err
+}
+
+// Restart starts the new process with listeners of [Handoff.Listener]
+// and waits until it calls [Handoff.Ready], then the current process must stop
+// accepting connections with [Server.Shutdown] and exit after active connections are done.
+//
+// If the new process exits or the context is done before it is ready,
+// the process is killed and the error is returned, so the current process keeps serving.
+func (handoff *Handoff) Restart(ctx context.Context) error {
+	handoff.mu.Lock()
+	defer handoff.mu.Unlock()
+
+	if handoff.restarted {
+		return errors.New("plow: handoff is already done")
+	}
+
+	path := handoff.Path
+	if path == "" {
+		var err error
+		if path, err = os.Executable(); err != nil {
+			return err
+		}
+	}
+	args := handoff.Args
+	if args == nil {
+		args = os.Args[1:]
+	}
+
+	var files []*os.File
+	var names []string
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	for _, item := range handoff.listeners {
+		listenerFiles, err := listen.Files(item.listener)
+		if err != nil {
+			return err
+		}
+		for range listenerFiles {
+			names = append(names, item.name)
+		}
+		files = append(files, listenerFiles...)
+	}
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+	files = append(files, readyWriter)
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		handoffFdsEnv+"="+strconv.Itoa(len(names)),
+		handoffNamesEnv+"="+strings.Join(names, ":"),
+		handoffReadyEnv+"="+strconv.Itoa(listen.FirstFd+len(names)),
+	)
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+
+	// The writer is kept only by the new process,
+	// so the reader is done if the process exits
+	readyWriter.Close()
+	files = files[:len(files)-1]
+
+	readyRes := make(chan error, 1)
+	go func() {
+		var buf [1]byte
+		_, err := readyReader.Read(buf[:])
+		readyRes <- err
+	}()
+
+	select {
+	case err = <-readyRes:
+		if err != nil {
+			err = fmt.Errorf("plow: new process is not ready: %w", err)
+		}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		cmd.Process.Kill()
+		return err
+	}
+
+	handoff.restarted = true
+	return nil
+}
@@ -0,0 +1,114 @@
+package plow
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/oesand/plow/specs"
+)
+
+const handoffChildEnv = "PLOW_TEST_HANDOFF_CHILD"
+
+// TestHandoff_Child is the new process started by TestHandoff_Restart.
+func TestHandoff_Child(t *testing.T) {
+	switch os.Getenv(handoffChildEnv) {
+	case "":
+		t.Skip("started by TestHandoff_Restart")
+	case "fail":
+		os.Exit(1)
+	}
+
+	handoff, err := NewHandoff()
+	if err != nil {
+		os.Exit(2)
+	}
+	listener, err := handoff.Listener("http", func() (net.Listener, error) {
+		return nil, errors.New("listener is not inherited")
+	})
+	if err != nil {
+		os.Exit(3)
+	}
+
+	served := make(chan struct{}, 1)
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		select {
+		case served <- struct{}{}:
+		default:
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "child")
+	}))
+	go server.Serve(listener)
+
+	if err = handoff.Ready(); err != nil {
+		os.Exit(4)
+	}
+
+	select {
+	case <-served:
+		// Give the response time to be written
+		time.Sleep(100 * time.Millisecond)
+	case <-time.After(5 * time.Second):
+	}
+	os.Exit(0)
+}
+
+func TestHandoff_Restart(t *testing.T) {
+	handoff, err := NewHandoff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handoff.Path = os.Args[0]
+	handoff.Args = []string{"-test.run=^TestHandoff_Child$"}
+
+	listener, err := handoff.Listener("http", func() (net.Listener, error) {
+		return net.Listen("tcp4", "127.0.0.1:0")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "parent")
+	}))
+	go server.Serve(listener)
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func(expect string) {
+		t.Helper()
+
+		resp, err := client.Get("http://" + listener.Addr().String())
+		if err != nil {
+			t.Fatal("req:", err)
+		}
+		checkHttpResponseBody(t, resp, []byte(expect))
+	}
+
+	get("parent")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The failed process leaves the current one serving
+	t.Setenv(handoffChildEnv, "fail")
+	if err = handoff.Restart(ctx); err == nil {
+		t.Fatal("expected error of failed process")
+	}
+	get("parent")
+
+	t.Setenv(handoffChildEnv, "serve")
+	if err = handoff.Restart(ctx); err != nil {
+		t.Fatal(err)
+	}
+	server.Shutdown()
+
+	get("child")
+
+	if err = handoff.Restart(ctx); err == nil {
+		t.Error("expected error of repeated restart")
+	}
+}
@@ -37,6 +37,45 @@ type Request interface {
 	Body() io.Reader
 }
 
+// BodyDecoder is an optional interface of [Request] which controls
+// whether Request.Body is decoded by the "Content-Encoding" header.
+//
+// It is implemented by requests of the [Server].
+type BodyDecoder interface {
+	// DecodeBody enables or disables decoding of the request body,
+	// it must be called before the body is read.
+	//
+	// Returns [specs.ErrUnknownContentEncoding] if decoding is enabled
+	// for a body of unsupported encoding.
+	DecodeBody(enabled bool) error
+}
+
+// BodyLimiter is an optional interface of [Request] which overrides
+// the maximum size of the body, see [Server.MaxBodySize].
+//
+// It is implemented by requests of the [Server].
+type BodyLimiter interface {
+	// LimitBody sets the maximum size in bytes of the request body,
+	// it must be called before the body is read.
+	//
+	// If size is zero or negative the body is unlimited.
+	LimitBody(size int64)
+}
+
+// BodyLimitProvider is an optional interface of [Handler] which provides
+// the maximum size of the request body before the request is handled.
+//
+// Requests which declare the body larger than [Server.MaxBodySize] by "Content-Length"
+// are responded 413 "Request Entity Too Large" before any handler code runs,
+// unless the provider raises the limit for them, such as routes of mux with the body limit flag.
+type BodyLimitProvider interface {
+	// BodyLimit returns the maximum size in bytes of the request body and true,
+	// or false to keep the limit of the server. It must not have side effects.
+	//
+	// If size is zero or negative the body is unlimited.
+	BodyLimit(request Request) (int64, bool)
+}
+
 // Response is an interface for the HTTP response sent by the [Server].
 type Response interface {
 	// StatusCode specifies [specs.StatusCode] to be sent by the server in HTTP request.
@@ -91,6 +130,32 @@ type BodyWriter interface {
 	ContentLength() int64
 }
 
+// TrailerWriter is an interface that can be implemented by [BodyWriter]
+// to send trailer fields after the HTTP server response body or client request body.
+//
+// Trailer is sent only with chunked transfer encoding,
+// which is used if any trailer fields are declared and the protocol allows it.
+type TrailerWriter interface {
+	// Trailer contains the trailer fields to be sent after the body.
+	//
+	// Fields present before the body is written are declared
+	// in the 'Trailer' header, values can be set until WriteBody returns.
+	Trailer() *specs.Header
+}
+
+// TrailerReader is an optional interface of [Request] and [ClientResponse]
+// which provides the trailer fields received after the chunked body,
+// see [Trailer] and [ResponseTrailer].
+//
+// It is implemented by requests of the [Server] and responses of the [Transport].
+type TrailerReader interface {
+	// Trailer contains the trailer fields received after the chunked body.
+	//
+	// Trailer is nil until the body is read up to EOF
+	// or if trailer was not sent.
+	Trailer() *specs.Header
+}
+
 // MarshallResponse is an interface that combines [Response] and [BodyWriter] capabilities
 // with the ability to provide an instance of the underlying response type.
 type MarshallResponse interface {
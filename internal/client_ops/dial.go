@@ -0,0 +1,148 @@
+package client_ops
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultConnectAttemptDelay recommended delay between
+// connection attempts by RFC 8305, section 5.
+const DefaultConnectAttemptDelay = 250 * time.Millisecond
+
+// ParseHostIP parse host as IP literal, host can be wrapped in brackets.
+func ParseHostIP(host string) net.IP {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if i := strings.LastIndex(host, "%"); i > 0 {
+		host = host[:i]
+	}
+	return net.ParseIP(host)
+}
+
+// InterleaveAddrs sorts addresses by alternating families
+// starting with family of the first address (RFC 8305, section 4).
+func InterleaveAddrs(ips []net.IP) []net.IP {
+	if len(ips) < 2 {
+		return ips
+	}
+
+	firstIs4 := ips[0].To4() != nil
+	var primary, fallback []net.IP
+	for _, ip := range ips {
+		if (ip.To4() != nil) == firstIs4 {
+			primary = append(primary, ip)
+		} else {
+			fallback = append(fallback, ip)
+		}
+	}
+
+	sorted := make([]net.IP, 0, len(ips))
+	for i := 0; i < len(primary) || i < len(fallback); i++ {
+		if i < len(primary) {
+			sorted = append(sorted, primary[i])
+		}
+		if i < len(fallback) {
+			sorted = append(sorted, fallback[i])
+		}
+	}
+	return sorted
+}
+
+// DialParallel races connection attempts to the addresses
+// according to Happy Eyeballs (RFC 8305).
+//
+// Every next attempt starts after delay or immediately after
+// failure of the previous one, first established connection wins
+// and all the others are cancelled.
+func DialParallel(
+	ctx context.Context, ips []net.IP, port uint16, delay time.Duration,
+	dial func(ctx context.Context, address string) (net.Conn, error),
+) (net.Conn, error) {
+	if len(ips) == 0 {
+		return nil, errors.New("no addresses to dial")
+	}
+	if delay <= 0 {
+		delay = DefaultConnectAttemptDelay
+	}
+
+	ips = InterleaveAddrs(ips)
+	if len(ips) == 1 {
+		return dial(ctx, HostPort(ipHost(ips[0]), port))
+	}
+
+	type attemptResult struct {
+		conn net.Conn
+		err  error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, len(ips))
+	startAttempt := func(ip net.IP) {
+		go func() {
+			conn, err := dial(ctx, HostPort(ipHost(ip), port))
+			results <- attemptResult{conn, err}
+		}()
+	}
+
+	// Close connections which may be established after return
+	drainPending := func(pending int) {
+		go func() {
+			for ; pending > 0; pending-- {
+				if late := <-results; late.conn != nil {
+					late.conn.Close()
+				}
+			}
+		}()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var firstErr error
+	started, finished := 1, 0
+	startAttempt(ips[0])
+
+	for finished < len(ips) {
+		select {
+		case res := <-results:
+			finished++
+			if res.err == nil {
+				cancel()
+				drainPending(started - finished)
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if started < len(ips) {
+				startAttempt(ips[started])
+				started++
+				timer.Reset(delay)
+			} else if finished == started {
+				return nil, firstErr
+			}
+		case <-timer.C:
+			if started < len(ips) {
+				startAttempt(ips[started])
+				started++
+				timer.Reset(delay)
+			}
+		case <-ctx.Done():
+			drainPending(started - finished)
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, firstErr
+}
+
+func ipHost(ip net.IP) string {
+	if ip.To4() == nil {
+		return "[" + ip.String() + "]"
+	}
+	return ip.String()
+}
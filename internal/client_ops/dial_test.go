@@ -0,0 +1,113 @@
+package client_ops
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInterleaveAddrs(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("::1"), net.ParseIP("::2"), net.ParseIP("::3"),
+		net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"),
+	}
+	expected := []string{"::1", "10.0.0.1", "::2", "10.0.0.2", "::3"}
+
+	var got []string
+	for _, ip := range InterleaveAddrs(ips) {
+		got = append(got, ip.String())
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("InterleaveAddrs() = %v, want %v", got, expected)
+	}
+}
+
+type fakeConn struct {
+	net.Conn
+	address string
+	closed  bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestDialParallel(t *testing.T) {
+	tests := []struct {
+		name     string
+		ips      []string
+		delays   map[string]time.Duration
+		failures map[string]bool
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "First address wins",
+			ips:  []string{"::1", "10.0.0.1"},
+			want: "[::1]:80",
+		},
+		{
+			name:   "Fallback after attempt delay",
+			ips:    []string{"::1", "10.0.0.1"},
+			delays: map[string]time.Duration{"[::1]:80": time.Second},
+			want:   "10.0.0.1:80",
+		},
+		{
+			name:     "Fallback immediately after failure",
+			ips:      []string{"::1", "10.0.0.1"},
+			failures: map[string]bool{"[::1]:80": true},
+			want:     "10.0.0.1:80",
+		},
+		{
+			name:     "All failed",
+			ips:      []string{"::1", "10.0.0.1"},
+			failures: map[string]bool{"[::1]:80": true, "10.0.0.1:80": true},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ips []net.IP
+			for _, ip := range tt.ips {
+				ips = append(ips, net.ParseIP(ip))
+			}
+
+			var mu sync.Mutex
+			var attempts []string
+			conn, err := DialParallel(context.Background(), ips, 80, 20*time.Millisecond,
+				func(ctx context.Context, address string) (net.Conn, error) {
+					mu.Lock()
+					attempts = append(attempts, address)
+					mu.Unlock()
+
+					select {
+					case <-time.After(tt.delays[address]):
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					}
+					if tt.failures[address] {
+						return nil, errors.New("refused")
+					}
+					return &fakeConn{address: address}, nil
+				})
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := conn.(*fakeConn).address; got != tt.want {
+				t.Errorf("connected to %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
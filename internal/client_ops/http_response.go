@@ -1,8 +1,10 @@
 package client_ops
 
 import (
+	"github.com/oesand/plow/internal/encoding"
 	"github.com/oesand/plow/specs"
 	"io"
+	"net"
 )
 
 func NewHttpClientResponse(status specs.StatusCode, header *specs.Header) *HttpClientResponse {
@@ -16,7 +18,9 @@ type HttpClientResponse struct {
 	status specs.StatusCode
 	header *specs.Header
 
-	Reader io.ReadCloser
+	Reader        io.ReadCloser
+	ChunkedReader *encoding.ChunkedReader
+	Addr          net.Addr
 }
 
 func (resp *HttpClientResponse) StatusCode() specs.StatusCode {
@@ -27,6 +31,17 @@ func (resp *HttpClientResponse) Header() *specs.Header {
 	return resp.header
 }
 
+func (resp *HttpClientResponse) RemoteAddr() net.Addr {
+	return resp.Addr
+}
+
 func (resp *HttpClientResponse) Body() io.ReadCloser {
 	return resp.Reader
 }
+
+func (resp *HttpClientResponse) Trailer() *specs.Header {
+	if resp.ChunkedReader == nil {
+		return nil
+	}
+	return resp.ChunkedReader.Trailer()
+}
@@ -26,7 +26,7 @@ func ReadResponse(ctx context.Context, reader *bufio.Reader, lineLimit int64, to
 		return nil, err
 	}
 
-	header, err := parsing.ParseHeaders(ctx, reader, lineLimit, totalLimit)
+	header, err := parsing.ParseHeaders(ctx, reader, lineLimit, totalLimit, false)
 	if err != nil {
 		return nil, err
 	}
@@ -3,6 +3,8 @@ package encoding
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"github.com/oesand/plow/internal/parsing"
 	"github.com/oesand/plow/specs"
 	"io"
 	"net/http/httputil"
@@ -11,21 +13,29 @@ import (
 
 var singleCRLF = []byte("\r\n")
 
-func NewChunkedReader(buf *bufio.Reader) io.Reader {
-	return &chunkedReader{
-		chunked: httputil.NewChunkedReader(buf),
-		bufio:   buf,
+// NewChunkedReader returns reader of the chunked body,
+// trailer fields following the last chunk are parsed
+// with provided limits as headers.
+func NewChunkedReader(buf *bufio.Reader, lineLimit int64, totalLimit int64) *ChunkedReader {
+	return &ChunkedReader{
+		chunked:    httputil.NewChunkedReader(buf),
+		bufio:      buf,
+		lineLimit:  lineLimit,
+		totalLimit: totalLimit,
 	}
 }
 
-type chunkedReader struct {
+type ChunkedReader struct {
 	chunked io.Reader
 	bufio   *bufio.Reader
 	mu      sync.Mutex
 	sawEOF  bool
+
+	lineLimit, totalLimit int64
+	trailer               *specs.Header
 }
 
-func (cr *chunkedReader) Read(p []byte) (int, error) {
+func (cr *ChunkedReader) Read(p []byte) (int, error) {
 	cr.mu.Lock()
 	defer cr.mu.Unlock()
 
@@ -43,7 +53,37 @@ func (cr *chunkedReader) Read(p []byte) (int, error) {
 			return 0, specs.ErrTrailerEOF
 		} else if err != nil {
 			return 0, err
+		} else if err = cr.readTrailer(); err != nil {
+			return 0, err
 		}
 	}
 	return n, err
 }
+
+func (cr *ChunkedReader) readTrailer() error {
+	header, err := parsing.ParseHeaders(context.Background(), cr.bufio, cr.lineLimit, cr.totalLimit, false)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return specs.ErrTrailerEOF
+		}
+		return err
+	}
+
+	trailer := specs.NewHeader()
+	for name, value := range header.All() {
+		if IsAllowedTrailer(name) {
+			trailer.Set(name, value)
+		}
+	}
+	cr.trailer = trailer
+	return nil
+}
+
+// Trailer returns trailer fields received after the last chunk,
+// nil until the body is read up to EOF or if trailer was not sent.
+func (cr *ChunkedReader) Trailer() *specs.Header {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	return cr.trailer
+}
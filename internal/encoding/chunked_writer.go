@@ -2,17 +2,33 @@ package encoding
 
 import (
 	"fmt"
+	"github.com/oesand/plow/specs"
 	"io"
 )
 
+var (
+	rawLastChunk  = []byte("0\r\n")
+	rawColonSpace = []byte(": ")
+)
+
 func NewChunkedWriter(writer io.Writer) io.WriteCloser {
+	return NewChunkedTrailerWriter(writer, nil)
+}
+
+// NewChunkedTrailerWriter returns writer of the chunked body
+// which sends trailer fields after the last chunk on close.
+//
+// Trailer fields are read on close, so they can be set while the body is written.
+func NewChunkedTrailerWriter(writer io.Writer, trailer *specs.Header) io.WriteCloser {
 	return &chunkedWriter{
-		writer: writer,
+		writer:  writer,
+		trailer: trailer,
 	}
 }
 
 type chunkedWriter struct {
-	writer io.Writer
+	writer  io.Writer
+	trailer *specs.Header
 }
 
 func (cw *chunkedWriter) Write(data []byte) (n int, err error) {
@@ -38,6 +54,24 @@ func (cw *chunkedWriter) Write(data []byte) (n int, err error) {
 }
 
 func (cw *chunkedWriter) Close() error {
-	_, err := io.WriteString(cw.writer, "0\r\n\r\n")
+	if cw.trailer == nil || !cw.trailer.Any() {
+		_, err := io.WriteString(cw.writer, "0\r\n\r\n")
+		return err
+	}
+
+	buf := make([]byte, 0, 64)
+	buf = append(buf, rawLastChunk...)
+	for name, value := range cw.trailer.All() {
+		if value == "" || !IsAllowedTrailer(name) {
+			continue
+		}
+		buf = append(buf, name...)
+		buf = append(buf, rawColonSpace...)
+		buf = append(buf, value...)
+		buf = append(buf, singleCRLF...)
+	}
+	buf = append(buf, singleCRLF...)
+
+	_, err := cw.writer.Write(buf)
 	return err
 }
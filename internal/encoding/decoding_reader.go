@@ -0,0 +1,41 @@
+package encoding
+
+import (
+	"io"
+)
+
+// NewDecodingReader returns [io.Reader] that decodes the reader by the content encoding.
+//
+// The decoder is created on the first read, so the encoded stream is not touched
+// until the body is actually consumed.
+func NewDecodingReader(contentEncoding string, reader io.Reader) io.Reader {
+	return &decodingReader{
+		contentEncoding: contentEncoding,
+		reader:          reader,
+	}
+}
+
+type decodingReader struct {
+	contentEncoding string
+	reader          io.Reader
+	decoder         io.ReadCloser
+	err             error
+}
+
+func (r *decodingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.decoder == nil {
+		r.decoder, r.err = NewReader(r.contentEncoding, r.reader)
+		if r.err != nil {
+			return 0, r.err
+		}
+	}
+
+	n, err := r.decoder.Read(p)
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
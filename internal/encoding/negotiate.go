@@ -0,0 +1,105 @@
+package encoding
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Negotiate selects the content encoding of the offers by the "Accept-Encoding"
+// header value with quality values (RFC 9110 section 12.5.3).
+//
+// Offers are listed in the server preferred order which breaks ties in quality.
+// Returns empty string if the identity (no encoding) must be used,
+// it is also used when none of the offers and the identity are acceptable.
+func Negotiate(acceptEncoding string, offers []string) string {
+	qualities := make(map[string]float64)
+	anyQuality, identityQuality := -1.0, -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		quality, ok := parseQuality(params)
+		if !ok {
+			continue
+		}
+
+		switch name {
+		case "*":
+			anyQuality = quality
+		case "identity":
+			identityQuality = quality
+		default:
+			qualities[name] = quality
+		}
+	}
+
+	// The identity is acceptable unless excluded explicitly or by "*",
+	// its implicit quality is the lowest one of listed encodings.
+	if identityQuality < 0 {
+		identityQuality = 1
+		if anyQuality >= 0 {
+			identityQuality = anyQuality
+		} else {
+			for _, quality := range qualities {
+				identityQuality = min(identityQuality, quality)
+			}
+		}
+	}
+
+	var selected string
+	var selectedQuality float64
+	for _, offer := range offers {
+		quality, ok := qualities[offer]
+		if !ok {
+			quality = anyQuality
+		}
+		if quality > selectedQuality {
+			selected, selectedQuality = offer, quality
+		}
+	}
+
+	if selected != "" && selectedQuality >= identityQuality {
+		return selected
+	}
+	return ""
+}
+
+func parseQuality(params string) (float64, bool) {
+	for _, param := range strings.Split(params, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if !strings.EqualFold(strings.TrimSpace(name), "q") {
+			continue
+		}
+
+		quality, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || quality < 0 || quality > 1 {
+			return 0, false
+		}
+		return quality, true
+	}
+	return 1, true
+}
+
+// MatchContentType reports whether the media type of the "Content-Type" header value
+// matches one of the patterns, such as "application/json" or "text/*" for any subtype.
+func MatchContentType(contentType string, patterns []string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return false
+	}
+
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if typ, _, _ := strings.Cut(mediaType, "/"); strings.EqualFold(typ, prefix) {
+				return true
+			}
+		} else if strings.EqualFold(mediaType, pattern) {
+			return true
+		}
+	}
+	return false
+}
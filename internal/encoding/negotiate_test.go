@@ -0,0 +1,64 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/oesand/plow/specs"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{specs.ContentEncodingGzip, specs.ContentEncodingBrotli, specs.ContentEncodingDeflate}
+
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{acceptEncoding: "", want: ""},
+		{acceptEncoding: "gzip", want: "gzip"},
+		{acceptEncoding: "br", want: "br"},
+		{acceptEncoding: "br,gzip", want: "gzip"},
+		{acceptEncoding: "deflate, br;q=0.9", want: "deflate"},
+		{acceptEncoding: "gzip;q=0.5, br;q=0.8", want: "br"},
+		{acceptEncoding: "GZIP;Q=0.5", want: "gzip"},
+		{acceptEncoding: "gzip;q=0", want: ""},
+		{acceptEncoding: "gzip;q=0, br", want: "br"},
+		{acceptEncoding: "gzip;q=0.5, identity", want: ""},
+		{acceptEncoding: "gzip;q=0.5, identity;q=0", want: "gzip"},
+		{acceptEncoding: "*", want: "gzip"},
+		{acceptEncoding: "*;q=0.5, gzip;q=0", want: "br"},
+		{acceptEncoding: "*;q=0", want: ""},
+		{acceptEncoding: "zstd, compress", want: ""},
+		{acceptEncoding: "gzip;q=2, br", want: "br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			if got := Negotiate(tt.acceptEncoding, offers); got != tt.want {
+				t.Errorf("Negotiate(%q) = %q, want %q", tt.acceptEncoding, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchContentType(t *testing.T) {
+	patterns := []string{"text/*", "application/json", "image/svg+xml"}
+
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{contentType: "text/plain", want: true},
+		{contentType: "text/html; charset=utf-8", want: true},
+		{contentType: "Application/JSON", want: true},
+		{contentType: "image/svg+xml", want: true},
+		{contentType: "image/png", want: false},
+		{contentType: "application/json-seq", want: false},
+		{contentType: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := MatchContentType(tt.contentType, patterns); got != tt.want {
+				t.Errorf("MatchContentType(%q) = %v, want %v", tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
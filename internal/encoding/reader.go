@@ -1,7 +1,6 @@
 package encoding
 
 import (
-	"bufio"
 	"compress/gzip"
 	"compress/zlib"
 	"fmt"
@@ -10,14 +9,7 @@ import (
 	"io"
 )
 
-func NewReader(isChunked bool, contentEncoding string, bufio *bufio.Reader) (io.ReadCloser, error) {
-	var reader io.Reader
-	if isChunked {
-		reader = NewChunkedReader(bufio)
-	} else {
-		reader = bufio
-	}
-
+func NewReader(contentEncoding string, reader io.Reader) (io.ReadCloser, error) {
 	switch contentEncoding {
 	case "":
 		return io.NopCloser(reader), nil
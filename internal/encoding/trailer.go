@@ -0,0 +1,50 @@
+package encoding
+
+import (
+	"github.com/oesand/plow/internal/plain"
+	"github.com/oesand/plow/specs"
+	"strings"
+)
+
+// RFC 7230, section 4.1.2: fields which are used for
+// message framing, routing, authentication or describe the payload
+// must not be sent in a trailer.
+var disallowedTrailers = map[string]struct{}{
+	"Authorization":       {},
+	"Cache-Control":       {},
+	"Content-Encoding":    {},
+	"Content-Length":      {},
+	"Content-Range":       {},
+	"Content-Type":        {},
+	"Cookie":              {},
+	"Expect":              {},
+	"Host":                {},
+	"Max-Forwards":        {},
+	"Pragma":              {},
+	"Proxy-Authenticate":  {},
+	"Proxy-Authorization": {},
+	"Range":               {},
+	"Set-Cookie":          {},
+	"Te":                  {},
+	"Trailer":             {},
+	"Transfer-Encoding":   {},
+	"Www-Authenticate":    {},
+}
+
+// IsAllowedTrailer checks if the field can be sent in a trailer.
+func IsAllowedTrailer(name string) bool {
+	_, disallowed := disallowedTrailers[plain.TitleCase(name)]
+	return !disallowed
+}
+
+// TrailerNames returns the value of the 'Trailer' header
+// which declares allowed fields of the trailer.
+func TrailerNames(trailer *specs.Header) string {
+	var names []string
+	for name := range trailer.All() {
+		if IsAllowedTrailer(name) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,155 @@
+package limit
+
+import (
+	"sync"
+	"time"
+)
+
+// NewSemaphore creates [Semaphore] of the size, or nil which is unlimited if size is zero or negative.
+func NewSemaphore(size int) Semaphore {
+	if size <= 0 {
+		return nil
+	}
+	return make(Semaphore, size)
+}
+
+// Semaphore limits the number of slots held at the same time,
+// the nil Semaphore is unlimited.
+type Semaphore chan struct{}
+
+// TryAcquire takes the slot if any is free.
+func (s Semaphore) TryAcquire() bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Acquire waits for the free slot up to the timeout or until done is closed.
+//
+// If timeout is zero or negative there is no timeout.
+func (s Semaphore) Acquire(done <-chan struct{}, timeout time.Duration) bool {
+	if s.TryAcquire() {
+		return true
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case s <- struct{}{}:
+		return true
+	case <-expired:
+		return false
+	case <-done:
+		return false
+	}
+}
+
+// Release frees the slot taken by TryAcquire or Acquire.
+func (s Semaphore) Release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// NewKeyedSemaphore creates [KeyedSemaphore] with the size of each key,
+// or nil which is unlimited if size is zero or negative.
+func NewKeyedSemaphore(size int) *KeyedSemaphore {
+	if size <= 0 {
+		return nil
+	}
+	return &KeyedSemaphore{
+		size:  size,
+		slots: map[string]*keyedSlots{},
+	}
+}
+
+// KeyedSemaphore limits the number of slots held at the same time
+// separately for each key, such as client IP address.
+// The nil KeyedSemaphore is unlimited.
+type KeyedSemaphore struct {
+	size  int
+	mutex sync.Mutex
+	slots map[string]*keyedSlots
+}
+
+type keyedSlots struct {
+	semaphore Semaphore
+	// refs counts holders and waiters of the slots to remove unused keys
+	refs int
+}
+
+// TryAcquire takes the slot of the key if any is free.
+func (k *KeyedSemaphore) TryAcquire(key string) bool {
+	if k == nil {
+		return true
+	}
+	slots := k.ref(key)
+	if slots.semaphore.TryAcquire() {
+		return true
+	}
+	k.unref(key)
+	return false
+}
+
+// Acquire waits for the free slot of the key up to the timeout or until done is closed.
+//
+// If timeout is zero or negative there is no timeout.
+func (k *KeyedSemaphore) Acquire(key string, done <-chan struct{}, timeout time.Duration) bool {
+	if k == nil {
+		return true
+	}
+	slots := k.ref(key)
+	if slots.semaphore.Acquire(done, timeout) {
+		return true
+	}
+	k.unref(key)
+	return false
+}
+
+// Release frees the slot of the key taken by TryAcquire or Acquire.
+func (k *KeyedSemaphore) Release(key string) {
+	if k == nil {
+		return
+	}
+	k.mutex.Lock()
+	slots := k.slots[key]
+	k.mutex.Unlock()
+
+	slots.semaphore.Release()
+	k.unref(key)
+}
+
+func (k *KeyedSemaphore) ref(key string) *keyedSlots {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	slots, ok := k.slots[key]
+	if !ok {
+		slots = &keyedSlots{semaphore: make(Semaphore, k.size)}
+		k.slots[key] = slots
+	}
+	slots.refs++
+	return slots
+}
+
+func (k *KeyedSemaphore) unref(key string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	slots := k.slots[key]
+	slots.refs--
+	if slots.refs == 0 {
+		delete(k.slots, key)
+	}
+}
@@ -0,0 +1,75 @@
+package limit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+	s := NewSemaphore(2)
+	if !s.TryAcquire() || !s.TryAcquire() {
+		t.Fatal("expected free slots")
+	}
+	if s.TryAcquire() {
+		t.Fatal("expected no free slots")
+	}
+	if s.Acquire(nil, 10*time.Millisecond) {
+		t.Fatal("expected acquire timeout")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.Release()
+	}()
+	if !s.Acquire(nil, time.Second) {
+		t.Fatal("expected released slot")
+	}
+
+	done := make(chan struct{})
+	close(done)
+	if s.Acquire(done, 0) {
+		t.Fatal("expected acquire to stop by done")
+	}
+}
+
+func TestSemaphore_Unlimited(t *testing.T) {
+	var s Semaphore = NewSemaphore(0)
+	for i := 0; i < 100; i++ {
+		if !s.TryAcquire() {
+			t.Fatal("expected unlimited slots")
+		}
+	}
+	s.Release()
+
+	var k *KeyedSemaphore = NewKeyedSemaphore(0)
+	if !k.TryAcquire("a") || !k.Acquire("a", nil, 0) {
+		t.Fatal("expected unlimited slots")
+	}
+	k.Release("a")
+}
+
+func TestKeyedSemaphore(t *testing.T) {
+	k := NewKeyedSemaphore(1)
+	if !k.TryAcquire("a") {
+		t.Fatal("expected free slot of a")
+	}
+	if k.TryAcquire("a") {
+		t.Fatal("expected no free slots of a")
+	}
+	if !k.TryAcquire("b") {
+		t.Fatal("expected free slot of b")
+	}
+	if k.Acquire("a", nil, 10*time.Millisecond) {
+		t.Fatal("expected acquire timeout of a")
+	}
+
+	k.Release("a")
+	k.Release("b")
+	if len(k.slots) != 0 {
+		t.Errorf("expected unused keys to be removed, got %d", len(k.slots))
+	}
+
+	if !k.TryAcquire("a") {
+		t.Fatal("expected released slot of a")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package listen
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func dupFile(conn syscall.Conn, name string) (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
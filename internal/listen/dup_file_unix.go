@@ -0,0 +1,38 @@
+//go:build unix
+
+package listen
+
+import (
+	"os"
+	"syscall"
+)
+
+// dupFile duplicates the descriptor of the connection.
+//
+// Unlike File of net listeners, the descriptor stays in non-blocking mode
+// when it is passed to the child process, the mode is shared with the original
+// descriptor, so the blocking one would hang pending accepts of the listener.
+func dupFile(conn syscall.Conn, name string) (*os.File, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var fd int
+	var dupErr error
+	err = raw.Control(func(sysfd uintptr) {
+		syscall.ForkLock.RLock()
+		defer syscall.ForkLock.RUnlock()
+
+		fd, dupErr = syscall.Dup(int(sysfd))
+		if dupErr == nil {
+			syscall.CloseOnExec(fd)
+		}
+	})
+	if err != nil {
+		return nil, err
+	} else if dupErr != nil {
+		return nil, os.NewSyscallError("dup", dupErr)
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
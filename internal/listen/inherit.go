@@ -0,0 +1,116 @@
+package listen
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// FirstFd is the first descriptor passed by the parent process, after stdin, stdout and stderr.
+const FirstFd = 3
+
+// UnknownName is the name of passed descriptors without the name, as named by systemd.
+const UnknownName = "unknown"
+
+// ParseSystemdEnv parses variables of the systemd socket activation: LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES.
+// It returns zero count if descriptors are not passed to the process with the pid.
+func ParseSystemdEnv(pid int, getenv func(string) string) (int, []string, error) {
+	if getenv("LISTEN_PID") != strconv.Itoa(pid) {
+		return 0, nil, nil
+	}
+
+	count, err := ParseFdCount(getenv("LISTEN_FDS"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return count, ParseNames(getenv("LISTEN_FDNAMES"), count), nil
+}
+
+// ParseFdCount parses the number of passed descriptors.
+func ParseFdCount(value string) (int, error) {
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("plow: invalid number of passed descriptors %q", value)
+	}
+	return count, nil
+}
+
+// ParseNames parses colon separated names of count descriptors,
+// missing and empty names are [UnknownName].
+func ParseNames(value string, count int) []string {
+	names := make([]string, count)
+	var parsed []string
+	if value != "" {
+		parsed = strings.Split(value, ":")
+	}
+	for i := range names {
+		if i < len(parsed) && parsed[i] != "" {
+			names[i] = parsed[i]
+		} else {
+			names[i] = UnknownName
+		}
+	}
+	return names
+}
+
+// Inherit creates listeners of count descriptors passed by the parent process
+// starting at [FirstFd], listeners are grouped by names.
+//
+// Passed descriptors are closed, the listeners have their own duplicates.
+func Inherit(count int, names []string) (map[string][]net.Listener, error) {
+	listeners := make(map[string][]net.Listener)
+	for i := range count {
+		file := os.NewFile(uintptr(FirstFd+i), names[i])
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, group := range listeners {
+				for _, listener := range group {
+					listener.Close()
+				}
+			}
+			return nil, fmt.Errorf("plow: inherit descriptor %d: %w", FirstFd+i, err)
+		}
+		listeners[names[i]] = append(listeners[names[i]], listener)
+	}
+	return listeners, nil
+}
+
+// Files returns duplicated descriptors of the listener to pass to the child process,
+// the [Multi] listener has the descriptor for each merged listener.
+//
+// Unix domain socket listeners do not remove the socket file on close
+// anymore, so the socket keeps working in the child process.
+func Files(listener net.Listener) ([]*os.File, error) {
+	if multi, ok := listener.(*Multi); ok {
+		var files []*os.File
+		for _, listener := range multi.Listeners() {
+			inner, err := Files(listener)
+			if err != nil {
+				for _, file := range files {
+					file.Close()
+				}
+				return nil, err
+			}
+			files = append(files, inner...)
+		}
+		return files, nil
+	}
+
+	if unixListener, ok := listener.(*net.UnixListener); ok {
+		unixListener.SetUnlinkOnClose(false)
+	}
+
+	conn, ok := listener.(syscall.Conn)
+	if !ok {
+		return nil, fmt.Errorf("plow: listener %T cannot be passed to the child process", listener)
+	}
+	file, err := dupFile(conn, listener.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	return []*os.File{file}, nil
+}
@@ -0,0 +1,84 @@
+package listen
+
+import (
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestParseSystemdEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    map[string]string
+		count  int
+		names  []string
+		hasErr bool
+	}{
+		{"NotActivated", map[string]string{}, 0, nil, false},
+		{"OtherProcess", map[string]string{"LISTEN_PID": "2", "LISTEN_FDS": "1"}, 0, nil, false},
+		{"Unnamed", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "2"}, 2, []string{"unknown", "unknown"}, false},
+		{"Named", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "3", "LISTEN_FDNAMES": "http:http:admin"}, 3, []string{"http", "http", "admin"}, false},
+		{"PartiallyNamed", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "3", "LISTEN_FDNAMES": "http::"}, 3, []string{"http", "unknown", "unknown"}, false},
+		{"InvalidCount", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "two"}, 0, nil, true},
+		{"NegativeCount", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "-1"}, 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, names, err := ParseSystemdEnv(1, func(key string) string {
+				return tt.env[key]
+			})
+			if (err != nil) != tt.hasErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if count != tt.count || !slices.Equal(names, tt.names) {
+				t.Errorf("expected %d %v, got %d %v", tt.count, tt.names, count, names)
+			}
+		})
+	}
+}
+
+func TestFiles(t *testing.T) {
+	tcp, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+
+	files, err := Files(tcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(files))
+	}
+
+	// The duplicate accepts connections of the same socket
+	dup, err := net.FileListener(files[0])
+	files[0].Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dup.Close()
+	if dup.Addr().String() != tcp.Addr().String() {
+		t.Errorf("expected %s, got %s", tcp.Addr(), dup.Addr())
+	}
+
+	unix, err := net.Listen("unix", t.TempDir()+"/test.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	multi := NewMulti([]net.Listener{tcp, unix})
+	defer multi.Close()
+
+	files, err = Files(multi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		file.Close()
+	}
+	if len(files) != 2 {
+		t.Errorf("expected 2 files, got %d", len(files))
+	}
+}
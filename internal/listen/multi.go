@@ -0,0 +1,98 @@
+package listen
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// NewMulti creates [Multi] accepting connections of all listeners,
+// each listener is accepted by its own goroutine.
+func NewMulti(listeners []net.Listener) *Multi {
+	if len(listeners) == 0 {
+		panic("plow: no listeners")
+	}
+
+	multi := &Multi{
+		listeners: listeners,
+		conns:     make(chan acceptResult),
+		done:      make(chan struct{}),
+	}
+	for _, listener := range listeners {
+		go multi.acceptLoop(listener)
+	}
+	return multi
+}
+
+// Multi is the [net.Listener] merging connections of several listeners,
+// such as sockets bound to the same address with SO_REUSEPORT.
+type Multi struct {
+	listeners []net.Listener
+	conns     chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+func (multi *Multi) acceptLoop(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+		}
+
+		select {
+		case multi.conns <- acceptResult{conn, err}:
+			if err != nil {
+				return
+			}
+		case <-multi.done:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// Listeners returns the merged listeners.
+func (multi *Multi) Listeners() []net.Listener {
+	return multi.listeners
+}
+
+// Accept waits for the connection of any listener,
+// it returns the error of the first listener which has failed.
+func (multi *Multi) Accept() (net.Conn, error) {
+	select {
+	case res := <-multi.conns:
+		return res.conn, res.err
+	case <-multi.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes all listeners.
+func (multi *Multi) Close() error {
+	multi.closeOnce.Do(func() {
+		close(multi.done)
+		var errs []error
+		for _, listener := range multi.listeners {
+			errs = append(errs, listener.Close())
+		}
+		multi.closeErr = errors.Join(errs...)
+	})
+	return multi.closeErr
+}
+
+// Addr returns the address of the first listener.
+func (multi *Multi) Addr() net.Addr {
+	return multi.listeners[0].Addr()
+}
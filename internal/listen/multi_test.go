@@ -0,0 +1,66 @@
+package listen
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMulti(t *testing.T) {
+	var listeners []net.Listener
+	for range 3 {
+		listener, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	multi := NewMulti(listeners)
+	if multi.Addr() != listeners[0].Addr() {
+		t.Errorf("expected address of the first listener, got %s", multi.Addr())
+	}
+
+	for _, listener := range listeners {
+		client, err := net.Dial("tcp4", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := multi.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.LocalAddr().String() != listener.Addr().String() {
+			t.Errorf("expected connection of %s, got %s", listener.Addr(), conn.LocalAddr())
+		}
+		conn.Close()
+		client.Close()
+	}
+
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := multi.Accept()
+		accepted <- err
+	}()
+
+	if err := multi.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-accepted:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("expected closed error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected accept to be unblocked by close")
+	}
+
+	for _, listener := range listeners {
+		if _, err := net.Dial("tcp4", listener.Addr().String()); err == nil {
+			t.Errorf("expected %s to be closed", listener.Addr())
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package listen
+
+import (
+	"context"
+	"net"
+)
+
+// ReusePort creates count listeners bound to the same address with SO_REUSEPORT,
+// so the kernel balances incoming connections between them.
+//
+// If the port of the address is zero, the port chosen for the first listener is used by others.
+func ReusePort(network, address string, count int) ([]net.Listener, error) {
+	if count <= 0 {
+		count = 1
+	}
+
+	config := net.ListenConfig{Control: reusePortControl}
+	listeners := make([]net.Listener, 0, count)
+	for range count {
+		listener, err := config.Listen(context.Background(), network, address)
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+		address = listener.Addr().String()
+	}
+	return listeners, nil
+}
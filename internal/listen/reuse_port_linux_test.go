@@ -0,0 +1,33 @@
+package listen
+
+import (
+	"net"
+	"testing"
+)
+
+func TestReusePort(t *testing.T) {
+	listeners, err := ReusePort("tcp4", "127.0.0.1:0", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+
+	if len(listeners) != 3 {
+		t.Fatalf("expected 3 listeners, got %d", len(listeners))
+	}
+	for _, listener := range listeners[1:] {
+		if listener.Addr().String() != listeners[0].Addr().String() {
+			t.Errorf("expected %s, got %s", listeners[0].Addr(), listener.Addr())
+		}
+	}
+
+	// Without SO_REUSEPORT the address is in use
+	if listener, err := net.Listen("tcp4", listeners[0].Addr().String()); err == nil {
+		listener.Close()
+		t.Error("expected error of address in use")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package listen
+
+import (
+	"errors"
+	"syscall"
+)
+
+func reusePortControl(network, address string, conn syscall.RawConn) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,6 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+
+package listen
+
+// soReusePort is SO_REUSEPORT which is missing in the frozen syscall package.
+const soReusePort = 0x200
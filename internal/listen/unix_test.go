@@ -0,0 +1,49 @@
+package listen
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sock")
+
+	listener, err := Unix(path, 0o660)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o660 {
+		t.Errorf("expected mode 0660, got %o", info.Mode().Perm())
+	}
+
+	if _, err = Unix(path, 0o660); err == nil {
+		t.Error("expected error of socket in use")
+	}
+
+	// The socket file of the crashed process is left
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	listener, err = Unix(path, 0)
+	if err != nil {
+		t.Fatalf("expected stale socket to be removed, got %v", err)
+	}
+	listener.Close()
+
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected socket file to be removed on close")
+	}
+
+	regular := filepath.Join(t.TempDir(), "regular")
+	os.WriteFile(regular, nil, 0o600)
+	if _, err = Unix(regular, 0); err == nil {
+		t.Error("expected error of regular file")
+	}
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import "net"
+
+// NewCountingConn returns [net.Conn] which adds bytes read and written to the counters.
+func NewCountingConn(conn net.Conn, read, written *Counter) net.Conn {
+	return &countingConn{Conn: conn, read: read, written: written}
+}
+
+type countingConn struct {
+	net.Conn
+	read, written *Counter
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.read.Add(uint64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.written.Add(uint64(n))
+	}
+	return n, err
+}
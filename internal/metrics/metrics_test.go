@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteHistogram(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	var buf bytes.Buffer
+	WriteHeader(&buf, "duration_seconds", "Request duration.", TypeHistogram)
+	WriteHistogram(&buf, "duration_seconds", h, "class", "2xx")
+
+	expected := `# HELP duration_seconds Request duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{class="2xx",le="0.1"} 1
+duration_seconds_bucket{class="2xx",le="1"} 3
+duration_seconds_bucket{class="2xx",le="+Inf"} 4
+duration_seconds_sum{class="2xx"} 6.05
+duration_seconds_count{class="2xx"} 4
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected exposition:\n%s", buf.String())
+	}
+}
+
+func TestWriteSample(t *testing.T) {
+	var counter Counter
+	counter.Add(41)
+	counter.Inc()
+
+	var gauge Gauge
+	gauge.Add(2)
+	gauge.Add(-3)
+
+	var buf bytes.Buffer
+	WriteSample(&buf, "requests_total", float64(counter.Value()))
+	WriteSample(&buf, "connections", float64(gauge.Value()), "state", "active")
+
+	expected := "requests_total 42\nconnections{state=\"active\"} -1\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected exposition:\n%s", buf.String())
+	}
+}
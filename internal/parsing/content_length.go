@@ -4,11 +4,20 @@ import (
 	"errors"
 	"github.com/oesand/plow/specs"
 	"strconv"
+	"strings"
 )
 
 var ErrParsing = errors.New("cannot parse value")
 
-func ParseContentLength(header *specs.Header) (isChunked bool, size int64, err error) {
+// ParseContentLength determines the body framing by "Transfer-Encoding" and "Content-Length" headers.
+//
+// In the strict mode ambiguous framing fails with a distinct error, such as
+// [specs.ErrContentLengthWithTransferEncoding], instead of preferring "Transfer-Encoding".
+func ParseContentLength(header *specs.Header, strict bool) (isChunked bool, size int64, err error) {
+	if strict {
+		return parseStrictContentLength(header)
+	}
+
 	if te, has := header.TryGet("Transfer-Encoding"); has {
 		switch te {
 		case "chunked":
@@ -25,3 +34,41 @@ func ParseContentLength(header *specs.Header) (isChunked bool, size int64, err e
 	}
 	return
 }
+
+func parseStrictContentLength(header *specs.Header) (bool, int64, error) {
+	te, hasTe := header.TryGet("Transfer-Encoding")
+	cl, hasCl := header.TryGet("Content-Length")
+	if hasTe && hasCl {
+		return false, 0, specs.ErrContentLengthWithTransferEncoding
+	}
+
+	if hasTe {
+		codings := strings.Split(te, ",")
+		for i, coding := range codings {
+			coding = strings.TrimSpace(coding)
+			if strings.EqualFold(coding, "chunked") != (i == len(codings)-1) {
+				// RFC 9112, section 6.3: the final coding must be chunked,
+				// otherwise the length of the body cannot be determined
+				return false, 0, specs.ErrChunkedNotLast
+			}
+		}
+		if len(codings) > 1 {
+			return false, 0, specs.ErrUnknownTransferEncoding
+		}
+		return true, 0, nil
+	}
+
+	if hasCl {
+		// Only digits are allowed, signs and whitespace are parsed differently by implementations
+		if cl == "" || strings.TrimLeft(cl, "0123456789") != "" {
+			return false, 0, ErrParsing
+		}
+		size, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil {
+			return false, 0, ErrParsing
+		}
+		return false, size, nil
+	}
+
+	return false, 0, nil
+}
@@ -1,6 +1,7 @@
 package parsing
 
 import (
+	"errors"
 	"github.com/oesand/plow/specs"
 	"testing"
 )
@@ -71,7 +72,7 @@ func TestParseContentLength(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotIsChunked, gotSize, err := ParseContentLength(tt.header)
+			gotIsChunked, gotSize, err := ParseContentLength(tt.header, false)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ParseContentLength() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -85,3 +86,48 @@ func TestParseContentLength(t *testing.T) {
 		})
 	}
 }
+
+func TestParseContentLength_Strict(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        map[string]string
+		wantIsChunked bool
+		wantSize      int64
+		wantErr       error
+	}{
+		{name: "Empty", header: map[string]string{}},
+		{name: "Content-Length", header: map[string]string{"Content-Length": "100"}, wantSize: 100},
+		{name: "Chunked", header: map[string]string{"Transfer-Encoding": "chunked"}, wantIsChunked: true},
+		{name: "Chunked case insensitive", header: map[string]string{"Transfer-Encoding": "Chunked"}, wantIsChunked: true},
+		{
+			name:    "Transfer-Encoding and Content-Length",
+			header:  map[string]string{"Transfer-Encoding": "chunked", "Content-Length": "100"},
+			wantErr: specs.ErrContentLengthWithTransferEncoding,
+		},
+		{name: "Chunked not last", header: map[string]string{"Transfer-Encoding": "chunked, gzip"}, wantErr: specs.ErrChunkedNotLast},
+		{name: "Not chunked", header: map[string]string{"Transfer-Encoding": "gzip"}, wantErr: specs.ErrChunkedNotLast},
+		{name: "Unsupported coding", header: map[string]string{"Transfer-Encoding": "gzip, chunked"}, wantErr: specs.ErrUnknownTransferEncoding},
+		{name: "Signed Content-Length", header: map[string]string{"Content-Length": "+100"}, wantErr: ErrParsing},
+		{name: "Empty Content-Length", header: map[string]string{"Content-Length": ""}, wantErr: ErrParsing},
+		{name: "Overflow Content-Length", header: map[string]string{"Content-Length": "99999999999999999999"}, wantErr: ErrParsing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := specs.NewHeader()
+			for name, value := range tt.header {
+				header.Set(name, value)
+			}
+
+			gotIsChunked, gotSize, err := ParseContentLength(header, true)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseContentLength() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotIsChunked != tt.wantIsChunked {
+				t.Errorf("ParseContentLength() gotIsChunked = %v, want %v", gotIsChunked, tt.wantIsChunked)
+			}
+			if gotSize != tt.wantSize {
+				t.Errorf("ParseContentLength() gotSize = %v, want %v", gotSize, tt.wantSize)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package parsing
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"github.com/oesand/plow/internal/stream"
 	"github.com/oesand/plow/specs"
@@ -9,7 +10,15 @@ import (
 	"strings"
 )
 
-func ParseHeaders(ctx context.Context, reader *bufio.Reader, lineLimit int64, totalLimit int64) (*specs.Header, error) {
+// ParseHeaders reads header fields up to the empty line.
+//
+// In the strict mode any ambiguous field line fails with a distinct error
+// (see [specs.ErrObsoleteLineFolding] and others) instead of being tolerated or skipped.
+func ParseHeaders(ctx context.Context, reader *bufio.Reader, lineLimit int64, totalLimit int64, strict bool) (*specs.Header, error) {
+	if strict {
+		return parseStrictHeaders(ctx, reader, lineLimit, totalLimit)
+	}
+
 	var totalLen int64
 
 	// The first line cannot start with a leading space.
@@ -156,3 +165,79 @@ func parseHeaderKVLine(line []byte) ([]byte, []byte, bool) {
 	}
 	return k, v, writeVal
 }
+
+func parseStrictHeaders(ctx context.Context, reader *bufio.Reader, lineLimit int64, totalLimit int64) (*specs.Header, error) {
+	header := specs.NewHeader()
+
+	var totalLen int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		line, err := stream.ReadStrictLine(reader, lineLimit)
+		if err != nil {
+			return nil, err
+		} else if len(line) == 0 {
+			return header, nil
+		}
+
+		totalLen += int64(len(line))
+		if totalLimit > 0 && totalLen > totalLimit {
+			return nil, specs.ErrTooLarge
+		}
+
+		// RFC 9112, section 5.2: obsolete line folding must be rejected
+		// if the message is not sent to a user agent
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, specs.ErrObsoleteLineFolding
+		}
+
+		key, value, err := parseStrictHeaderKVLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case strings.EqualFold(key, "Content-Length"):
+			// RFC 9112, section 6.3: duplicates may be smuggled past another parser
+			if header.Has(key) || strings.Contains(value, ",") {
+				return nil, specs.ErrConflictingContentLength
+			}
+		case strings.EqualFold(key, "Transfer-Encoding"):
+			// Multiple field lines are combined into the list of codings
+			if prev, has := header.TryGet(key); has {
+				value = prev + ", " + value
+			}
+		}
+		applyKVHeader(header, key, value)
+	}
+}
+
+func parseStrictHeaderKVLine(line []byte) (string, string, error) {
+	colon := bytes.IndexByte(line, ':')
+	if colon <= 0 {
+		return "", "", specs.ErrInvalidHeaderName
+	}
+
+	// RFC 9112, section 5.1: no whitespace is allowed between the field name and colon
+	name := line[:colon]
+	if last := name[len(name)-1]; last == ' ' || last == '\t' {
+		return "", "", specs.ErrSpaceBeforeColon
+	}
+	for _, b := range name {
+		if !isTokenChar(b) {
+			return "", "", specs.ErrInvalidHeaderName
+		}
+	}
+
+	value := bytes.Trim(line[colon+1:], " \t")
+	for _, b := range value {
+		// RFC 9110, section 5.5: field-vchar, obs-text or whitespace
+		if b < ' ' && b != '\t' || b == 0x7f {
+			return "", "", specs.ErrInvalidHeaderValue
+		}
+	}
+
+	return string(name), string(value), nil
+}
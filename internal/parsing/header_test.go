@@ -132,7 +132,7 @@ func TestParseHeaders(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			reader := bufio.NewReader(strings.NewReader(tt.text))
-			got, err := ParseHeaders(ctx, reader, 0, 0)
+			got, err := ParseHeaders(ctx, reader, 0, 0, false)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ParseHeaders() error = %v, wantErr %v", err, tt.wantErr)
 			}
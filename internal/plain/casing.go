@@ -1,6 +1,10 @@
 package plain
 
 func TitleCase(content string) string {
+	// Names are usually in the title case already, so they are returned without the copy
+	if isTitleCase(content) {
+		return content
+	}
 	return string(TitleCaseBytes([]byte(content)))
 }
 
@@ -16,13 +20,28 @@ func TitleCaseBytes(input []byte) []byte {
 		}
 
 		output[i] = b
-		switch b {
-		case '\t', '\n', '\v', '\f', '\r', ' ', 0x85, 0xA0, '-', '_':
-			capNext = true
-		default:
-			capNext = false
-		}
+		capNext = isWordSeparator(b)
 	}
 
 	return output
 }
+
+func isTitleCase(content string) bool {
+	capNext := true
+	for i := 0; i < len(content); i++ {
+		b := content[i]
+		if 'a' <= b && b <= 'z' && capNext || 'A' <= b && b <= 'Z' && !capNext {
+			return false
+		}
+		capNext = isWordSeparator(b)
+	}
+	return true
+}
+
+func isWordSeparator(b byte) bool {
+	switch b {
+	case '\t', '\n', '\v', '\f', '\r', ' ', 0x85, 0xA0, '-', '_':
+		return true
+	}
+	return false
+}
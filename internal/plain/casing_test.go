@@ -33,6 +33,9 @@ func Test_TitleCase(t *testing.T) {
 			if got := TitleCaseBytes([]byte(tt.input)); !reflect.DeepEqual(got, []byte(tt.want)) {
 				t.Errorf("toTitleCaseBytes() = %v, want %v", string(got), tt.want)
 			}
+			if got := TitleCase(tt.input); got != tt.want {
+				t.Errorf("TitleCase() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
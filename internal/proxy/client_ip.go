@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+
+	"github.com/oesand/plow/specs"
+)
+
+// ResolveClientIP resolves the original client IP from the header set by trusted proxies,
+// such as "X-Forwarded-For", "X-Real-IP" or "Forwarded" (RFC 7239).
+//
+// Hops are walked from the nearest one while they are trusted,
+// so addresses prepended by the client itself are never reached.
+// Returns the peer if it is not trusted or the header is missing.
+func ResolveClientIP(peer net.IP, header *specs.Header, headerName string, trusted Networks) net.IP {
+	if peer == nil || !trusted.Contains(peer) {
+		return peer
+	}
+
+	value := header.Get(headerName)
+	if value == "" {
+		return peer
+	}
+
+	var hops []string
+	if strings.EqualFold(headerName, "Forwarded") {
+		hops = parseForwardedFor(value)
+	} else {
+		hops = strings.Split(value, ",")
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseHopIP(hops[i])
+		if ip == nil {
+			// Unknown or obfuscated hop cannot be trusted any further
+			break
+		}
+		client = ip
+		if !trusted.Contains(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// parseForwardedFor returns values of "for" parameters of the "Forwarded" header elements.
+func parseForwardedFor(value string) []string {
+	var hops []string
+	for _, element := range strings.Split(value, ",") {
+		var hop string
+		for _, pair := range strings.Split(element, ";") {
+			name, val, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			if strings.EqualFold(name, "for") {
+				hop = val
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// parseHopIP parses the hop such as "192.0.2.1", "192.0.2.1:4711" or "\"[2001:db8::1]:4711\"".
+func parseHopIP(hop string) net.IP {
+	hop = strings.Trim(strings.TrimSpace(hop), "\"")
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	hop = strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]")
+	return net.ParseIP(hop)
+}
+
+// AddrIP returns IP of the address, or nil if the address has no IP.
+func AddrIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.IPAddr:
+		return addr.IP
+	case *ResolvedAddr:
+		if addr.IP != nil {
+			return addr.IP
+		}
+		return net.ParseIP(addr.Domain)
+	}
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
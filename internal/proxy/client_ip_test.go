@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/oesand/plow/specs"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := ParseNetworks([]string{"10.0.0.0/8", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		peer       string
+		headerName string
+		value      string
+		expected   string
+	}{
+		{"no header", "10.0.0.1", "X-Forwarded-For", "", "10.0.0.1"},
+		{"untrusted peer", "192.0.2.9", "X-Forwarded-For", "203.0.113.7", "192.0.2.9"},
+		{"single hop", "10.0.0.1", "X-Forwarded-For", "203.0.113.7", "203.0.113.7"},
+		{"trusted chain", "10.0.0.1", "X-Forwarded-For", "203.0.113.7, 10.1.1.1, 10.2.2.2", "203.0.113.7"},
+		{"spoofed prefix", "10.0.0.1", "X-Forwarded-For", "1.2.3.4, 203.0.113.7", "203.0.113.7"},
+		{"invalid hop", "10.0.0.1", "X-Forwarded-For", "203.0.113.7, unknown, 10.1.1.1", "10.1.1.1"},
+		{"hop with port", "10.0.0.1", "X-Forwarded-For", "203.0.113.7:4711", "203.0.113.7"},
+		{"real ip", "10.0.0.1", "X-Real-IP", "203.0.113.7", "203.0.113.7"},
+		{"forwarded", "10.0.0.1", "Forwarded", "for=203.0.113.7;proto=https, for=10.1.1.1", "203.0.113.7"},
+		{"forwarded ipv6", "2001:db8::1", "Forwarded", "for=\"[2001:db9::5]:4711\";by=10.0.0.1", "2001:db9::5"},
+		{"forwarded obfuscated", "10.0.0.1", "Forwarded", "for=203.0.113.7, for=_hidden", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := specs.NewHeader()
+			if tt.value != "" {
+				header.Set(tt.headerName, tt.value)
+			}
+
+			ip := ResolveClientIP(net.ParseIP(tt.peer), header, tt.headerName, trusted)
+			if !ip.Equal(net.ParseIP(tt.expected)) {
+				t.Errorf("expected %s, got %s", tt.expected, ip)
+			}
+		})
+	}
+}
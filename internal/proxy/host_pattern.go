@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// HostPattern matches hosts in the NO_PROXY notation:
+//   - "*" - matches any host
+//   - "example.com" - matches the domain and its subdomains
+//   - ".example.com", "*.example.com" - matches only subdomains
+//   - "10.0.0.1", "::1" - matches the IP address
+//   - "10.0.0.0/8" - matches IP addresses in the CIDR range
+//
+// Any pattern except CIDR may be suffixed with ":port"
+// to match only the specified port.
+type HostPattern struct {
+	any    bool
+	domain string
+	exact  bool
+	ip     net.IP
+	ipNet  *net.IPNet
+	port   uint16
+}
+
+// ParseHostPattern parses single pattern, returns false if pattern is invalid.
+func ParseHostPattern(pattern string) (HostPattern, bool) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return HostPattern{}, false
+	}
+	if pattern == "*" {
+		return HostPattern{any: true}, true
+	}
+
+	if strings.Contains(pattern, "/") {
+		_, ipNet, err := net.ParseCIDR(pattern)
+		if err != nil {
+			return HostPattern{}, false
+		}
+		return HostPattern{ipNet: ipNet}, true
+	}
+
+	var hp HostPattern
+	host := pattern
+	if h, p, err := net.SplitHostPort(pattern); err == nil {
+		port, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return HostPattern{}, false
+		}
+		host, hp.port = h, uint16(port)
+	}
+
+	if ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")); ip != nil {
+		hp.ip = ip
+		return hp, true
+	}
+
+	if strings.HasPrefix(host, "*.") {
+		host = host[1:]
+	}
+	if strings.HasPrefix(host, ".") {
+		hp.domain = host
+	} else {
+		hp.domain = "." + host
+		hp.exact = true
+	}
+	if len(hp.domain) < 2 {
+		return HostPattern{}, false
+	}
+
+	return hp, true
+}
+
+// Match checks whether host and port matches the pattern.
+// Host must be in lowercase, IPv6 can be wrapped in brackets.
+func (hp HostPattern) Match(host string, port uint16) bool {
+	if hp.any {
+		return true
+	}
+	if hp.port != 0 && hp.port != port {
+		return false
+	}
+
+	if hp.IsIP() {
+		ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+		return ip != nil && hp.MatchIP(ip, port)
+	}
+
+	host = strings.TrimSuffix(host, ".")
+	if hp.exact && host == hp.domain[1:] {
+		return true
+	}
+	return strings.HasSuffix(host, hp.domain)
+}
+
+// IsIP reports whether the pattern is the IP address or the CIDR range.
+func (hp HostPattern) IsIP() bool {
+	return hp.ip != nil || hp.ipNet != nil
+}
+
+// MatchIP checks whether the IP address and port matches the IP or CIDR pattern,
+// other patterns never match.
+func (hp HostPattern) MatchIP(ip net.IP, port uint16) bool {
+	if !hp.IsIP() || (hp.port != 0 && hp.port != port) {
+		return false
+	}
+	if hp.ipNet != nil {
+		return hp.ipNet.Contains(ip)
+	}
+	return hp.ip.Equal(ip)
+}
+
+// HostPatterns list of patterns which matches a host if any of the patterns matches.
+type HostPatterns []HostPattern
+
+// ParseHostPatterns parses comma or space separated list of patterns
+// like NO_PROXY environment variable, invalid patterns are skipped.
+func ParseHostPatterns(list string) HostPatterns {
+	var patterns HostPatterns
+	for _, raw := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		if hp, ok := ParseHostPattern(raw); ok {
+			patterns = append(patterns, hp)
+		}
+	}
+	return patterns
+}
+
+// Match checks whether host and port matches any of the patterns.
+func (patterns HostPatterns) Match(host string, port uint16) bool {
+	host = strings.ToLower(host)
+	for _, hp := range patterns {
+		if hp.Match(host, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasIP reports whether any of the patterns is the IP address or the CIDR range.
+func (patterns HostPatterns) HasIP() bool {
+	for _, hp := range patterns {
+		if hp.IsIP() {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchIP checks whether the IP address and port matches any of the IP or CIDR patterns.
+func (patterns HostPatterns) MatchIP(ip net.IP, port uint16) bool {
+	for _, hp := range patterns {
+		if hp.MatchIP(ip, port) {
+			return true
+		}
+	}
+	return false
+}
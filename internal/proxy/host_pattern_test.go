@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+)
+
+func TestHostPatterns_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns string
+		host     string
+		port     uint16
+		want     bool
+	}{
+		{name: "Any", patterns: "*", host: "example.com", port: 80, want: true},
+		{name: "Empty", patterns: "", host: "example.com", port: 80, want: false},
+		{name: "Domain exact", patterns: "example.com", host: "example.com", port: 80, want: true},
+		{name: "Domain subdomain", patterns: "example.com", host: "api.example.com", port: 80, want: true},
+		{name: "Domain case", patterns: "Example.COM", host: "API.example.com", port: 80, want: true},
+		{name: "Domain other", patterns: "example.com", host: "notexample.com", port: 80, want: false},
+		{name: "Dot prefix subdomain", patterns: ".example.com", host: "api.example.com", port: 80, want: true},
+		{name: "Dot prefix exact", patterns: ".example.com", host: "example.com", port: 80, want: false},
+		{name: "Wildcard prefix", patterns: "*.example.com", host: "a.b.example.com", port: 443, want: true},
+		{name: "Domain port match", patterns: "example.com:8080", host: "example.com", port: 8080, want: true},
+		{name: "Domain port mismatch", patterns: "example.com:8080", host: "example.com", port: 80, want: false},
+		{name: "IPv4", patterns: "10.0.0.1", host: "10.0.0.1", port: 80, want: true},
+		{name: "IPv4 other", patterns: "10.0.0.1", host: "10.0.0.2", port: 80, want: false},
+		{name: "IPv6", patterns: "::1", host: "[::1]", port: 80, want: true},
+		{name: "IPv6 with port", patterns: "[::1]:8080", host: "::1", port: 8080, want: true},
+		{name: "CIDR", patterns: "10.0.0.0/8", host: "10.20.30.40", port: 80, want: true},
+		{name: "CIDR outside", patterns: "10.0.0.0/8", host: "11.0.0.1", port: 80, want: false},
+		{name: "CIDR domain", patterns: "10.0.0.0/8", host: "example.com", port: 80, want: false},
+		{name: "IPv6 CIDR", patterns: "fd00::/8", host: "[fd00::1]", port: 80, want: true},
+		{name: "List", patterns: "localhost, 127.0.0.0/8 .internal", host: "db.internal", port: 5432, want: true},
+		{name: "List none", patterns: "localhost,127.0.0.0/8", host: "example.com", port: 80, want: false},
+		{name: "Invalid skipped", patterns: "10.0.0.0/99,example.com", host: "example.com", port: 80, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseHostPatterns(tt.patterns).Match(tt.host, tt.port); got != tt.want {
+				t.Errorf("ParseHostPatterns(%q).Match(%q, %d) = %v, want %v",
+					tt.patterns, tt.host, tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostPatterns_MatchIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns string
+		ip       string
+		port     uint16
+		want     bool
+	}{
+		{name: "IPv4", patterns: "10.0.0.1", ip: "10.0.0.1", port: 80, want: true},
+		{name: "CIDR", patterns: "10.0.0.0/8", ip: "10.20.30.40", port: 80, want: true},
+		{name: "CIDR outside", patterns: "10.0.0.0/8", ip: "11.0.0.1", port: 80, want: false},
+		{name: "IPv6 CIDR", patterns: "fd00::/8", ip: "fd00::1", port: 80, want: true},
+		{name: "Port mismatch", patterns: "10.0.0.1:8080", ip: "10.0.0.1", port: 80, want: false},
+		{name: "Domain skipped", patterns: "example.com", ip: "10.0.0.1", port: 80, want: false},
+		{name: "Any skipped", patterns: "*", ip: "10.0.0.1", port: 80, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patterns := ParseHostPatterns(tt.patterns)
+			if got := patterns.MatchIP(net.ParseIP(tt.ip), tt.port); got != tt.want {
+				t.Errorf("ParseHostPatterns(%q).MatchIP(%q, %d) = %v, want %v",
+					tt.patterns, tt.ip, tt.port, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+
+	"github.com/oesand/plow/specs"
+)
+
+// Networks is a list of IP ranges, such as trusted load balancers or proxies.
+type Networks []*net.IPNet
+
+// ParseNetworks parses IP addresses and CIDR ranges, such as "10.0.0.1" or "10.0.0.0/8".
+func ParseNetworks(list []string) (Networks, error) {
+	networks := make(Networks, 0, len(list))
+	for _, raw := range list {
+		raw = strings.TrimSpace(raw)
+		if !strings.Contains(raw, "/") {
+			ip := net.ParseIP(raw)
+			if ip == nil {
+				return nil, specs.NewOpError("proxy", "invalid network %q", raw)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(raw)
+		if err != nil {
+			return nil, specs.NewOpError("proxy", "invalid network %q", raw)
+		}
+		networks = append(networks, ipNet)
+	}
+	return networks, nil
+}
+
+// Contains checks whether the ip is in any of the networks,
+// IPv4-mapped IPv6 addresses are matched as IPv4.
+func (networks Networks) Contains(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, ipNet := range networks {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsAddr checks whether the IP of the address is in any of the networks.
+func (networks Networks) ContainsAddr(addr net.Addr) bool {
+	ip := AddrIP(addr)
+	return ip != nil && networks.Contains(ip)
+}
@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/oesand/plow/specs"
+)
+
+// Commands of the PROXY protocol header.
+const (
+	// ProtocolCommandLocal denotes a connection established by the proxy itself,
+	// such as a health check, the original addresses are not provided.
+	ProtocolCommandLocal byte = 0x0
+	// ProtocolCommandProxy denotes a connection relayed on behalf of the client.
+	ProtocolCommandProxy byte = 0x1
+)
+
+const (
+	protocolV1MaxLength = 107
+	protocolV2HeadSize  = 16
+)
+
+var (
+	protocolV1Prefix    = []byte("PROXY ")
+	protocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// ProtocolHeader is the PROXY protocol header sent by a TCP load balancer
+// before the proxied connection data.
+type ProtocolHeader struct {
+	// Version of the protocol, 1 for the text format or 2 for the binary format.
+	Version byte
+
+	// Command is [ProtocolCommandProxy] or [ProtocolCommandLocal],
+	// the text format always uses [ProtocolCommandProxy].
+	Command byte
+
+	// SourceAddr is the address of the original client,
+	// nil if the addresses are unknown or not provided.
+	SourceAddr net.Addr
+
+	// DestAddr is the address which the original client connected to,
+	// nil if the addresses are unknown or not provided.
+	DestAddr net.Addr
+
+	// TLVs contains the additional type-length-value fields of the binary format,
+	// such as ALPN, authority or unique connection id.
+	TLVs []ProtocolTLV
+}
+
+// ProtocolTLV is a type-length-value field of the PROXY protocol header.
+type ProtocolTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// TLV returns the value of the first field with the type, or nil if not present.
+func (header *ProtocolHeader) TLV(typ byte) []byte {
+	for _, tlv := range header.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value
+		}
+	}
+	return nil
+}
+
+// ReadProtocolHeader reads the PROXY protocol header of version 1 or 2.
+//
+// Returns [specs.ErrProxyProtocol] if the reader does not start with a valid header.
+func ReadProtocolHeader(reader *bufio.Reader) (*ProtocolHeader, error) {
+	signature, err := reader.Peek(len(protocolV2Signature))
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(signature, protocolV2Signature) {
+		return readProtocolV2(reader)
+	}
+	if bytes.HasPrefix(signature, protocolV1Prefix) {
+		return readProtocolV1(reader)
+	}
+	return nil, specs.ErrProxyProtocol
+}
+
+// readProtocolV1 reads the text header such as "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func readProtocolV1(reader *bufio.Reader) (*ProtocolHeader, error) {
+	var line []byte
+	for len(line) < protocolV1MaxLength {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, specs.ErrProxyProtocol
+	}
+
+	header := &ProtocolHeader{Version: 1, Command: ProtocolCommandProxy}
+	fields := strings.Split(string(line[len(protocolV1Prefix):len(line)-2]), " ")
+	switch fields[0] {
+	case "UNKNOWN":
+		// The receiver must ignore anything presented before the CRLF
+		return header, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, specs.ErrProxyProtocol
+	}
+	if len(fields) != 5 {
+		return nil, specs.ErrProxyProtocol
+	}
+
+	isV4 := fields[0] == "TCP4"
+	srcIP, dstIP := parseProtocolIP(fields[1], isV4), parseProtocolIP(fields[2], isV4)
+	srcPort, srcOk := parseProtocolPort(fields[3])
+	dstPort, dstOk := parseProtocolPort(fields[4])
+	if srcIP == nil || dstIP == nil || !srcOk || !dstOk {
+		return nil, specs.ErrProxyProtocol
+	}
+
+	header.SourceAddr = &net.TCPAddr{IP: srcIP, Port: srcPort}
+	header.DestAddr = &net.TCPAddr{IP: dstIP, Port: dstPort}
+	return header, nil
+}
+
+func parseProtocolIP(value string, isV4 bool) net.IP {
+	if isV4 == strings.Contains(value, ":") {
+		return nil
+	}
+	return net.ParseIP(value)
+}
+
+func parseProtocolPort(value string) (int, bool) {
+	// Leading zeros are not allowed by the specification
+	if value == "" || len(value) > 1 && value[0] == '0' {
+		return 0, false
+	}
+	port, err := strconv.ParseUint(value, 10, 16)
+	return int(port), err == nil
+}
+
+// readProtocolV2 reads the binary header with address block and TLVs.
+func readProtocolV2(reader *bufio.Reader) (*ProtocolHeader, error) {
+	head := make([]byte, protocolV2HeadSize)
+	if _, err := io.ReadFull(reader, head); err != nil {
+		return nil, err
+	}
+
+	versionCommand, family := head[12], head[13]
+	if versionCommand>>4 != 2 {
+		return nil, specs.ErrProxyProtocol
+	}
+	header := &ProtocolHeader{Version: 2, Command: versionCommand & 0xF}
+	if header.Command != ProtocolCommandLocal && header.Command != ProtocolCommandProxy {
+		return nil, specs.ErrProxyProtocol
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(head[14:16]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+
+	var addrLen int
+	var ipLen int
+	switch family >> 4 {
+	case 0x0: // AF_UNSPEC
+	case 0x1: // AF_INET
+		addrLen, ipLen = 12, net.IPv4len
+	case 0x2: // AF_INET6
+		addrLen, ipLen = 36, net.IPv6len
+	case 0x3: // AF_UNIX
+		addrLen = 216
+	default:
+		return nil, specs.ErrProxyProtocol
+	}
+	if len(payload) < addrLen {
+		return nil, specs.ErrProxyProtocol
+	}
+
+	// Addresses are ignored for the LOCAL command and for unsupported transports
+	if header.Command == ProtocolCommandProxy && ipLen > 0 && family&0xF == 0x1 {
+		srcIP := net.IP(bytes.Clone(payload[:ipLen]))
+		dstIP := net.IP(bytes.Clone(payload[ipLen : 2*ipLen]))
+		header.SourceAddr = &net.TCPAddr{IP: srcIP, Port: int(binary.BigEndian.Uint16(payload[2*ipLen:]))}
+		header.DestAddr = &net.TCPAddr{IP: dstIP, Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:]))}
+	}
+
+	tlvs := payload[addrLen:]
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return nil, specs.ErrProxyProtocol
+		}
+		length := int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < 3+length {
+			return nil, specs.ErrProxyProtocol
+		}
+		header.TLVs = append(header.TLVs, ProtocolTLV{
+			Type:  tlvs[0],
+			Value: tlvs[3 : 3+length],
+		})
+		tlvs = tlvs[3+length:]
+	}
+
+	return header, nil
+}
+
+// NewProtocolConn returns [net.Conn] which reports addresses of the PROXY protocol header
+// and reads the data buffered by the reader after the header first.
+func NewProtocolConn(conn net.Conn, reader *bufio.Reader, header *ProtocolHeader) net.Conn {
+	pc := &protocolConn{Conn: conn, header: header, reader: conn}
+	if buffered := reader.Buffered(); buffered > 0 {
+		data, _ := reader.Peek(buffered)
+		pc.reader = io.MultiReader(bytes.NewReader(bytes.Clone(data)), conn)
+	}
+	return pc
+}
+
+type protocolConn struct {
+	net.Conn
+	header *ProtocolHeader
+	reader io.Reader
+}
+
+func (c *protocolConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (c *protocolConn) RemoteAddr() net.Addr {
+	if c.header.SourceAddr != nil {
+		return c.header.SourceAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *protocolConn) LocalAddr() net.Addr {
+	if c.header.DestAddr != nil {
+		return c.header.DestAddr
+	}
+	return c.Conn.LocalAddr()
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/oesand/plow/specs"
+)
+
+func protocolV2(command, family byte, addrs []byte, tlvs ...ProtocolTLV) []byte {
+	var payload []byte
+	payload = append(payload, addrs...)
+	for _, tlv := range tlvs {
+		payload = append(payload, tlv.Type)
+		payload = binary.BigEndian.AppendUint16(payload, uint16(len(tlv.Value)))
+		payload = append(payload, tlv.Value...)
+	}
+
+	data := append([]byte{}, protocolV2Signature...)
+	data = append(data, 0x20|command, family)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(payload)))
+	return append(data, payload...)
+}
+
+func TestReadProtocolHeader(t *testing.T) {
+	inet := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xDC, 0x04, 0x01, 0xBB}
+	inet6 := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0xDC, 0x04, 0x01, 0xBB)
+
+	tests := []struct {
+		name    string
+		raw     []byte
+		version byte
+		command byte
+		src     string
+		dst     string
+		tlvs    []ProtocolTLV
+		err     error
+	}{
+		{
+			name: "v1 TCP4", raw: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"),
+			version: 1, command: ProtocolCommandProxy, src: "192.0.2.1:56324", dst: "198.51.100.1:443",
+		},
+		{
+			name: "v1 TCP6", raw: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"),
+			version: 1, command: ProtocolCommandProxy, src: "[2001:db8::1]:56324", dst: "[2001:db8::2]:443",
+		},
+		{
+			name: "v1 UNKNOWN", raw: []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"),
+			version: 1, command: ProtocolCommandProxy,
+		},
+		{name: "v1 family mismatch", raw: []byte("PROXY TCP4 2001:db8::1 2001:db8::2 1 2\r\n"), err: specs.ErrProxyProtocol},
+		{name: "v1 invalid port", raw: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 056324 443\r\n"), err: specs.ErrProxyProtocol},
+		{name: "v1 missing fields", raw: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n"), err: specs.ErrProxyProtocol},
+		{name: "v1 bare LF", raw: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n"), err: specs.ErrProxyProtocol},
+		{name: "v1 too long", raw: []byte("PROXY UNKNOWN " + strings.Repeat("x", 100) + "\r\n"), err: specs.ErrProxyProtocol},
+		{
+			name: "v2 INET with TLVs",
+			raw: protocolV2(ProtocolCommandProxy, 0x11, inet,
+				ProtocolTLV{Type: 0x01, Value: []byte("h2")},
+				ProtocolTLV{Type: 0x02, Value: []byte("example.com")}),
+			version: 2, command: ProtocolCommandProxy, src: "192.0.2.1:56324", dst: "198.51.100.1:443",
+			tlvs: []ProtocolTLV{{Type: 0x01, Value: []byte("h2")}, {Type: 0x02, Value: []byte("example.com")}},
+		},
+		{
+			name: "v2 INET6", raw: protocolV2(ProtocolCommandProxy, 0x21, inet6),
+			version: 2, command: ProtocolCommandProxy, src: "[2001:db8::1]:56324", dst: "[2001:db8::2]:443",
+		},
+		{
+			name: "v2 LOCAL", raw: protocolV2(ProtocolCommandLocal, 0x11, inet),
+			version: 2, command: ProtocolCommandLocal,
+		},
+		{
+			name: "v2 UNSPEC", raw: protocolV2(ProtocolCommandProxy, 0x00, nil),
+			version: 2, command: ProtocolCommandProxy,
+		},
+		{name: "v2 short address", raw: protocolV2(ProtocolCommandProxy, 0x11, inet[:8]), err: specs.ErrProxyProtocol},
+		{name: "v2 invalid command", raw: protocolV2(0x2, 0x11, inet), err: specs.ErrProxyProtocol},
+		{name: "v2 truncated TLV", raw: protocolV2(ProtocolCommandProxy, 0x11, append(inet, 0x01, 0x00, 0x05, 'h')), err: specs.ErrProxyProtocol},
+		{name: "not a header", raw: []byte("GET / HTTP/1.1\r\n\r\n"), err: specs.ErrProxyProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := ReadProtocolHeader(bufio.NewReader(bytes.NewReader(tt.raw)))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected error %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+
+			if header.Version != tt.version || header.Command != tt.command {
+				t.Errorf("unexpected version %d or command %d", header.Version, header.Command)
+			}
+			if addrString(header.SourceAddr) != tt.src || addrString(header.DestAddr) != tt.dst {
+				t.Errorf("unexpected addresses %v -> %v", header.SourceAddr, header.DestAddr)
+			}
+			if len(header.TLVs) != len(tt.tlvs) {
+				t.Fatalf("unexpected TLVs %v", header.TLVs)
+			}
+			for _, tlv := range tt.tlvs {
+				if !bytes.Equal(header.TLV(tlv.Type), tlv.Value) {
+					t.Errorf("unexpected TLV %#x value %q", tlv.Type, header.TLV(tlv.Type))
+				}
+			}
+		})
+	}
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func TestNewProtocolConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		client.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\n"))
+		client.Write([]byte("\r\n"))
+		client.Close()
+	}()
+
+	reader := bufio.NewReader(server)
+	header, err := ReadProtocolHeader(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := NewProtocolConn(server, reader, header)
+	if conn.RemoteAddr().String() != "192.0.2.1:56324" || conn.LocalAddr().String() != "198.51.100.1:443" {
+		t.Errorf("unexpected addresses %s -> %s", conn.RemoteAddr(), conn.LocalAddr())
+	}
+
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "GET / HTTP/1.1\r\n\r\n" {
+		t.Errorf("unexpected data after header %q", data)
+	}
+}
+
+func TestNetworks_ContainsAddr(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", "192.0.2.1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr net.Addr
+		want bool
+	}{
+		{addr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 80}, want: true},
+		{addr: &net.TCPAddr{IP: net.ParseIP("::ffff:10.1.2.3"), Port: 80}, want: true},
+		{addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 80}, want: true},
+		{addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 80}, want: false},
+		{addr: &net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 80}, want: true},
+		{addr: &net.UnixAddr{Name: "/tmp/socket", Net: "unix"}, want: false},
+		{addr: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := networks.ContainsAddr(tt.addr); got != tt.want {
+			t.Errorf("ContainsAddr(%v) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+
+	if _, err = ParseNetworks([]string{"10.0.0.0/99"}); err == nil {
+		t.Error("expected error for invalid network")
+	}
+}
@@ -2,7 +2,7 @@ package proxy
 
 import (
 	"bytes"
-	"github.com/armon/go-socks5"
+	"github.com/oesand/plow/socks5"
 	"net"
 	"strconv"
 	"testing"
@@ -62,16 +62,12 @@ func TestDialSocks5_AllAuthMethods(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			proxyConf := &socks5.Config{}
+			server := socks5.DefaultServer()
 			if tt.creds != nil {
-				proxyConf.Credentials = &socks5.StaticCredentials{
-					tt.creds.Username: tt.creds.Password,
+				server.Authenticate = func(username, password string) bool {
+					return username == tt.creds.Username && password == tt.creds.Password
 				}
 			}
-			server, err := socks5.New(proxyConf)
-			if err != nil {
-				t.Fatal(err)
-			}
 
 			proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
 			if err != nil {
@@ -151,13 +147,9 @@ func TestDialSocks5_AuthErrors(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			server, err := socks5.New(&socks5.Config{
-				Credentials: &socks5.StaticCredentials{
-					"username": "password",
-				},
-			})
-			if err != nil {
-				t.Fatal(err)
+			server := socks5.DefaultServer()
+			server.Authenticate = func(username, password string) bool {
+				return username == "username" && password == "password"
 			}
 
 			proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
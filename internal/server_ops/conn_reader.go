@@ -0,0 +1,181 @@
+package server_ops
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// aLongTimeAgo is the deadline which aborts the pending read immediately
+var aLongTimeAgo = time.Unix(1, 0)
+
+// NewConnReader returns [ConnReader] of the connection,
+// the background read is run by the spawn function or by the new goroutine if it is nil.
+func NewConnReader(conn net.Conn, spawn func(task func())) *ConnReader {
+	cr := &ConnReader{conn: conn, spawn: spawn}
+	cr.cond = sync.NewCond(&cr.mutex)
+	return cr
+}
+
+// ConnReader reads the connection and detects the close of the peer
+// by the background read while the request is handled, see StartBackgroundRead.
+type ConnReader struct {
+	conn  net.Conn
+	spawn func(task func())
+
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	inRead   bool
+	aborting bool
+	hasByte  bool
+	byteBuf  [1]byte
+
+	// err is the sticky error of the background read, such as io.EOF
+	err error
+}
+
+// StartBackgroundRead starts reading one byte of the connection in background
+// to call onClose when the peer closes the connection.
+//
+// It must be called once the request is consumed, the byte received in the meantime,
+// such as of the next pipelined request, is returned by the next Read.
+func (cr *ConnReader) StartBackgroundRead(onClose func()) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	if cr.inRead || cr.hasByte || cr.err != nil {
+		return
+	}
+	cr.inRead = true
+	cr.conn.SetReadDeadline(time.Time{})
+	if cr.spawn != nil {
+		cr.spawn(func() { cr.backgroundRead(onClose) })
+	} else {
+		go cr.backgroundRead(onClose)
+	}
+}
+
+func (cr *ConnReader) backgroundRead(onClose func()) {
+	n, err := cr.conn.Read(cr.byteBuf[:])
+
+	cr.mutex.Lock()
+	netErr, isNetErr := err.(net.Error)
+	isTimeout := isNetErr && netErr.Timeout()
+
+	// The deadline may be set by the handler while the request is still handled,
+	// such as by RequestController, so the read is restarted unless it is aborted
+	for n == 0 && isTimeout && !cr.aborting {
+		cr.conn.SetReadDeadline(time.Time{})
+		cr.mutex.Unlock()
+
+		n, err = cr.conn.Read(cr.byteBuf[:])
+
+		cr.mutex.Lock()
+		netErr, isNetErr = err.(net.Error)
+		isTimeout = isNetErr && netErr.Timeout()
+	}
+
+	if n == 1 {
+		cr.hasByte = true
+	}
+	// Timeouts are caused by the server, such as by AbortPendingRead,
+	// they do not mean the peer is gone
+	closed := err != nil && !isTimeout
+	if closed {
+		cr.err = err
+	}
+	cr.inRead = false
+	cr.mutex.Unlock()
+	cr.cond.Broadcast()
+
+	if closed {
+		onClose()
+	}
+}
+
+// AbortPendingRead stops the background read and waits for it to return,
+// the read deadline of the connection is cleared.
+func (cr *ConnReader) AbortPendingRead() {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+	cr.abortPendingRead()
+}
+
+func (cr *ConnReader) abortPendingRead() {
+	if !cr.inRead {
+		return
+	}
+	cr.aborting = true
+	cr.conn.SetReadDeadline(aLongTimeAgo)
+	for cr.inRead {
+		cr.cond.Wait()
+	}
+	cr.aborting = false
+	cr.conn.SetReadDeadline(time.Time{})
+}
+
+func (cr *ConnReader) Read(p []byte) (int, error) {
+	cr.mutex.Lock()
+	cr.abortPendingRead()
+
+	if cr.err != nil {
+		err := cr.err
+		cr.mutex.Unlock()
+		return 0, err
+	}
+	if len(p) == 0 {
+		cr.mutex.Unlock()
+		return 0, nil
+	}
+	if cr.hasByte {
+		p[0] = cr.byteBuf[0]
+		cr.hasByte = false
+		cr.mutex.Unlock()
+		return 1, nil
+	}
+	cr.mutex.Unlock()
+
+	return cr.conn.Read(p)
+}
+
+// HijackConn returns the connection for the hijack handler
+// which reads the byte received by the background read first.
+func (cr *ConnReader) HijackConn() net.Conn {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	cr.abortPendingRead()
+	if !cr.hasByte && cr.err == nil {
+		return cr.conn
+	}
+	return &hijackedConn{Conn: cr.conn, reader: cr}
+}
+
+type hijackedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *hijackedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// NotifyEOFReader returns [io.Reader] which calls onEOF once the reader returns [io.EOF].
+func NotifyEOFReader(reader io.Reader, onEOF func()) io.Reader {
+	return &notifyEOFReader{reader: reader, onEOF: onEOF}
+}
+
+type notifyEOFReader struct {
+	reader io.Reader
+	onEOF  func()
+}
+
+func (r *notifyEOFReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err == io.EOF && r.onEOF != nil {
+		r.onEOF()
+		r.onEOF = nil
+	}
+	return n, err
+}
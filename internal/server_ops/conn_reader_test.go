@@ -0,0 +1,92 @@
+package server_ops
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnReader_PipelinedByte(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	cr := NewConnReader(server, nil)
+	cr.StartBackgroundRead(func() {
+		t.Error("unexpected close")
+	})
+
+	go client.Write([]byte("GET"))
+
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(cr, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "GET" {
+		t.Errorf("unexpected data %q", buf)
+	}
+}
+
+func TestConnReader_Abort(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	cr := NewConnReader(server, nil)
+	cr.StartBackgroundRead(func() {
+		t.Error("unexpected close")
+	})
+	cr.AbortPendingRead()
+
+	go client.Write([]byte("x"))
+	server.SetReadDeadline(time.Now().Add(time.Second))
+
+	buf := make([]byte, 1)
+	if n, err := cr.Read(buf); n != 1 || err != nil {
+		t.Fatalf("unexpected read %d %v", n, err)
+	}
+}
+
+func TestConnReader_Close(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	closed := make(chan struct{})
+	cr := NewConnReader(server, nil)
+	cr.StartBackgroundRead(func() {
+		close(closed)
+	})
+	client.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close is not detected")
+	}
+	if _, err := cr.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestConnReader_CloseAfterDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	closed := make(chan struct{})
+	cr := NewConnReader(server, nil)
+	cr.StartBackgroundRead(func() {
+		close(closed)
+	})
+
+	// The deadline set by the handler must not stop the detection
+	server.SetReadDeadline(time.Now())
+	time.Sleep(20 * time.Millisecond)
+	client.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close is not detected")
+	}
+}
@@ -0,0 +1,31 @@
+package server_ops
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/oesand/plow/specs"
+)
+
+type cachedDate struct {
+	unix  int64
+	value string
+}
+
+var currentDate atomic.Pointer[cachedDate]
+
+// DateHeader returns the time formatted for the "Date" header,
+// the value is formatted once per second and shared by responses.
+func DateHeader(now time.Time) string {
+	unix := now.Unix()
+	if date := currentDate.Load(); date != nil && date.unix == unix {
+		return date.value
+	}
+
+	date := &cachedDate{
+		unix:  unix,
+		value: now.UTC().Format(specs.TimeFormat),
+	}
+	currentDate.Store(date)
+	return date.value
+}
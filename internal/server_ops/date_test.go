@@ -0,0 +1,26 @@
+package server_ops
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oesand/plow/specs"
+)
+
+func TestDateHeader(t *testing.T) {
+	zone := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2025, time.April, 1, 15, 0, 0, 0, zone)
+
+	expected := now.UTC().Format(specs.TimeFormat)
+	if got := DateHeader(now); got != expected {
+		t.Errorf("DateHeader() = %s, want %s", got, expected)
+	}
+	if got := DateHeader(now.Add(500 * time.Millisecond)); got != expected {
+		t.Errorf("DateHeader() in the same second = %s, want %s", got, expected)
+	}
+
+	next := now.Add(time.Second)
+	if got, expected := DateHeader(next), next.UTC().Format(specs.TimeFormat); got != expected {
+		t.Errorf("DateHeader() in the next second = %s, want %s", got, expected)
+	}
+}
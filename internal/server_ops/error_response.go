@@ -13,18 +13,35 @@ var closeHeaders = specs.NewHeader(func(header *specs.Header) {
 type ErrorResponse struct {
 	Code specs.StatusCode
 	Text string
+
+	// Err is the cause of the response, if any
+	Err error
+
+	// Header optionally contains additional header fields, such as "Retry-After"
+	Header *specs.Header
 }
 
 func (resp *ErrorResponse) Error() string {
 	return "<" + string(resp.Code.Formatted()) + ">: " + resp.Text
 }
 
+func (resp *ErrorResponse) Unwrap() error {
+	return resp.Err
+}
+
 func (resp *ErrorResponse) WriteTo(writer io.Writer) (int64, error) {
 	code := resp.Code
 	if code == 0 {
 		code = specs.StatusCodeInternalServerError
 	}
-	size, err := WriteResponseHead(writer, false, code, closeHeaders)
+	header := closeHeaders
+	if resp.Header != nil {
+		header = resp.Header.Clone()
+		for key, value := range closeHeaders.All() {
+			header.Set(key, value)
+		}
+	}
+	size, err := WriteResponseHead(writer, false, code, header)
 	if err != nil {
 		return 0, err
 	}
@@ -2,14 +2,36 @@ package server_ops
 
 import (
 	"context"
+	"crypto/tls"
 	"github.com/oesand/plow/internal"
+	"github.com/oesand/plow/internal/encoding"
+	"github.com/oesand/plow/internal/stream"
 	"github.com/oesand/plow/specs"
 	"io"
 	"net"
+	"sync"
 )
 
 type HijackHandler func(ctx context.Context, conn net.Conn)
 
+var requestPool = sync.Pool{
+	New: func() any {
+		return new(HttpRequest)
+	},
+}
+
+// AcquireRequest returns the empty request of the pool.
+func AcquireRequest() *HttpRequest {
+	return requestPool.Get().(*HttpRequest)
+}
+
+// ReleaseRequest resets the request and returns it to the pool,
+// the request must not be used after.
+func ReleaseRequest(req *HttpRequest) {
+	*req = HttpRequest{}
+	requestPool.Put(req)
+}
+
 type HttpRequest struct {
 	_ internal.NoCopy
 
@@ -17,11 +39,25 @@ type HttpRequest struct {
 
 	protoMajor, protoMinor uint16
 	remoteAddr             net.Addr
+	peerAddr               net.Addr
 	method                 specs.HttpMethod
 	url                    *specs.Url
 	header                 *specs.Header
 
-	BodyReader io.Reader
+	// TLSState of the connection if the request is received over TLS
+	TLSState *tls.ConnectionState
+
+	BodyReader    io.Reader
+	ChunkedReader *encoding.ChunkedReader
+	ContentLength int64
+
+	// ContentEncoding of the body that is decoded by Body if decoding is enabled
+	ContentEncoding string
+	MaxBodySize     int64
+
+	decodeBody  bool
+	rawBody     *stream.LimitedReader
+	decodedBody *stream.LimitedReader
 }
 
 func (req *HttpRequest) ProtoVersion() (major, minor uint16) {
@@ -32,6 +68,26 @@ func (req *HttpRequest) RemoteAddr() net.Addr {
 	return req.remoteAddr
 }
 
+// SetClientAddr replaces the address reported by RemoteAddr,
+// the address of the connection peer stays available by PeerAddr.
+func (req *HttpRequest) SetClientAddr(addr net.Addr) {
+	if req.peerAddr == nil {
+		req.peerAddr = req.remoteAddr
+	}
+	req.remoteAddr = addr
+}
+
+func (req *HttpRequest) PeerAddr() net.Addr {
+	if req.peerAddr != nil {
+		return req.peerAddr
+	}
+	return req.remoteAddr
+}
+
+func (req *HttpRequest) TLS() *tls.ConnectionState {
+	return req.TLSState
+}
+
 func (req *HttpRequest) Hijack(handler HijackHandler) {
 	req.hijacker = handler
 }
@@ -53,5 +109,82 @@ func (req *HttpRequest) Header() *specs.Header {
 }
 
 func (req *HttpRequest) Body() io.Reader {
-	return req.BodyReader
+	if req.BodyReader == nil {
+		return nil
+	}
+
+	if req.rawBody == nil {
+		req.rawBody = &stream.LimitedReader{
+			R:    req.BodyReader,
+			N:    req.MaxBodySize,
+			Size: req.ContentLength,
+		}
+	}
+	if !req.decodeBody {
+		return req.rawBody
+	}
+
+	// The limit is applied to the decoded size as well to defeat "zip bombs"
+	if req.decodedBody == nil {
+		req.decodedBody = &stream.LimitedReader{
+			R: encoding.NewDecodingReader(req.ContentEncoding, req.rawBody),
+			N: req.MaxBodySize,
+		}
+	}
+	return req.decodedBody
+}
+
+func (req *HttpRequest) LimitBody(size int64) {
+	req.MaxBodySize = size
+	if req.rawBody != nil {
+		req.rawBody.N = size
+	}
+	if req.decodedBody != nil {
+		req.decodedBody.N = size
+	}
+}
+
+// BodyTooLarge reports whether the body exceeds the limit,
+// either by the declared length or while reading.
+func (req *HttpRequest) BodyTooLarge() bool {
+	if req.BodyReader == nil {
+		return false
+	}
+	if req.MaxBodySize > 0 && req.ContentLength > req.MaxBodySize {
+		return true
+	}
+	return req.rawBody != nil && req.rawBody.Exceeded() ||
+		req.decodedBody != nil && req.decodedBody.Exceeded()
+}
+
+// SetContentEncoding sets the encoding of the body and whether Body decodes it.
+// The unsupported encoding is not an error until the decoded body is requested,
+// so handlers can disable decoding before, see UnsupportedEncoding.
+func (req *HttpRequest) SetContentEncoding(contentEncoding string, decode bool) {
+	req.ContentEncoding = contentEncoding
+	req.decodeBody = decode
+}
+
+// UnsupportedEncoding reports whether the decoded body of the unsupported encoding is requested,
+// reading of such body fails with [specs.ErrUnknownContentEncoding].
+func (req *HttpRequest) UnsupportedEncoding() bool {
+	return req.decodedBody != nil && !encoding.IsKnownEncoding(req.ContentEncoding)
+}
+
+func (req *HttpRequest) DecodeBody(enabled bool) error {
+	if req.ContentEncoding == "" {
+		return nil
+	}
+	if enabled && !encoding.IsKnownEncoding(req.ContentEncoding) {
+		return specs.ErrUnknownContentEncoding
+	}
+	req.decodeBody = enabled
+	return nil
+}
+
+func (req *HttpRequest) Trailer() *specs.Header {
+	if req.ChunkedReader == nil {
+		return nil
+	}
+	return req.ChunkedReader.Trailer()
 }
@@ -0,0 +1,128 @@
+package server_ops
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/oesand/plow/specs"
+)
+
+// NewMinRateReader returns [MinRateReader] of the reader of the connection which requires
+// the client to send at least rate bytes per second after the grace period.
+func NewMinRateReader(conn net.Conn, reader io.Reader, rate int64, grace time.Duration) *MinRateReader {
+	return &MinRateReader{
+		conn:   conn,
+		reader: reader,
+		rate:   rate,
+		grace:  grace,
+	}
+}
+
+// MinRateReader reads the connection and fails with [specs.ErrSlowClient]
+// if the client sends data slower than the minimum rate.
+//
+// Only the time spent waiting in reads is accounted, so the time
+// of the handler between reads of the body is not counted against the client.
+// The rate is checked only while the reader is armed.
+type MinRateReader struct {
+	conn   net.Conn
+	reader io.Reader
+	rate   int64
+	grace  time.Duration
+
+	armed    bool
+	waited   time.Duration
+	read     int64
+	exceeded bool
+
+	// deadline can be changed while reading, see SetDeadline
+	mutex    sync.Mutex
+	deadline time.Time
+}
+
+// Arm starts accounting of the rate from zero,
+// the deadline is the read deadline of the connection set by the server
+// which is kept if it is earlier than the rate requires.
+func (r *MinRateReader) Arm(deadline time.Time) {
+	if r == nil {
+		return
+	}
+	r.armed = true
+	r.waited = 0
+	r.read = 0
+
+	r.mutex.Lock()
+	r.deadline = deadline
+	r.mutex.Unlock()
+}
+
+// SetDeadline replaces the read deadline of the connection set by the server,
+// it is safe to call while reading.
+func (r *MinRateReader) SetDeadline(deadline time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.deadline = deadline
+	r.conn.SetReadDeadline(deadline)
+}
+
+// Disarm stops accounting of the rate and restores the read deadline of the connection.
+func (r *MinRateReader) Disarm() {
+	if r == nil || !r.armed {
+		return
+	}
+	r.armed = false
+
+	r.mutex.Lock()
+	r.conn.SetReadDeadline(r.deadline)
+	r.mutex.Unlock()
+}
+
+// Exceeded reports whether the client was slower than the minimum rate.
+func (r *MinRateReader) Exceeded() bool {
+	return r != nil && r.exceeded
+}
+
+func (r *MinRateReader) Read(p []byte) (int, error) {
+	if r.exceeded {
+		return 0, specs.ErrSlowClient
+	}
+	if !r.armed {
+		return r.reader.Read(p)
+	}
+
+	// The client must have sent all the data read so far
+	// within the grace period and the time at the minimum rate
+	allowed := r.grace + time.Duration(float64(r.read)/float64(r.rate)*float64(time.Second))
+	start := time.Now()
+	deadline := start.Add(allowed - r.waited)
+
+	r.mutex.Lock()
+	limitedByRate := r.deadline.IsZero() || deadline.Before(r.deadline)
+	if !limitedByRate {
+		deadline = r.deadline
+	}
+	r.conn.SetReadDeadline(deadline)
+	r.mutex.Unlock()
+
+	n, err := r.reader.Read(p)
+	r.waited += time.Since(start)
+	r.read += int64(n)
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() && limitedByRate && !r.deadlinePassed() {
+		r.exceeded = true
+		return n, specs.ErrSlowClient
+	}
+	return n, err
+}
+
+// deadlinePassed reports whether the read deadline has passed, such as the one
+// moved by SetDeadline while reading, so the timeout is not caused by the rate.
+func (r *MinRateReader) deadlinePassed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return !r.deadline.IsZero() && !r.deadline.After(time.Now())
+}
@@ -10,17 +10,31 @@ import (
 	"github.com/oesand/plow/specs"
 	"golang.org/x/net/http/httpguts"
 	"net"
+	"strconv"
+	"strings"
 )
 
+// ReadRequest reads the request line and header fields.
+//
+// In the strict mode the message head which may be interpreted differently by
+// intermediaries is rejected with [ErrorResponse] wrapping the distinct cause.
+//
+// The request is taken from the pool, it can be returned by [ReleaseRequest] once handled.
 func ReadRequest(
 	ctx context.Context, remoteAddr net.Addr,
-	reader *bufio.Reader, lineLimit int64, totalLimit int64,
+	reader *bufio.Reader, lineLimit int64, totalLimit int64, strict bool,
 ) (*HttpRequest, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	line, err := stream.ReadBufferLine(reader, lineLimit)
+	var line []byte
+	var err error
+	if strict {
+		line, err = stream.ReadStrictLine(reader, lineLimit)
+	} else {
+		line, err = stream.ReadBufferLine(reader, lineLimit)
+	}
 	if err != nil {
 		if errors.Is(err, specs.ErrTooLarge) {
 			return nil, &ErrorResponse{
@@ -28,6 +42,9 @@ func ReadRequest(
 				Text: "http: too large header",
 			}
 		}
+		if errors.Is(err, specs.ErrBareLineFeed) {
+			return nil, MalformedRequestError(err)
+		}
 		return nil, err
 	}
 
@@ -61,11 +78,31 @@ func ReadRequest(
 		}
 	}
 
+	// RFC 7230, section 5.3: authority-form is used only by CONNECT,
+	// asterisk-form only by OPTIONS, other requests use origin-form or absolute-form.
+	var validTarget bool
+	switch {
+	case method == specs.HttpMethodConnect:
+		validTarget = url.Scheme == "" && url.Path == "" && url.Host != "" && url.Port != 0
+	case rawurl == "*":
+		validTarget = method == specs.HttpMethodOptions || method == specs.MethodPreface
+	case url.Host != "":
+		validTarget = url.Scheme == "http" || url.Scheme == "https"
+	default:
+		validTarget = strings.HasPrefix(url.Path, "/")
+	}
+	if !validTarget {
+		return nil, &ErrorResponse{
+			Code: specs.StatusCodeBadRequest,
+			Text: fmt.Sprintf("http: invalid request target \"%s\"", rawurl),
+		}
+	}
+
 	if err = ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	header, err := parsing.ParseHeaders(ctx, reader, lineLimit, totalLimit)
+	header, err := parsing.ParseHeaders(ctx, reader, lineLimit, totalLimit, strict)
 	if err != nil {
 		if errors.Is(err, specs.ErrTooLarge) {
 			return nil, &ErrorResponse{
@@ -73,6 +110,9 @@ func ReadRequest(
 				Text: "http: too large header",
 			}
 		}
+		if strict && isMalformedError(err) {
+			return nil, MalformedRequestError(err)
+		}
 		return nil, err
 	}
 
@@ -83,7 +123,13 @@ func ReadRequest(
 	//	GET http://www.google.com/index.html HTTP/1.1
 	//	Host: doesnt matter
 	// the same. In the second case, any Host line is ignored.
-	if host, has := header.TryGet("Host"); has && len(host) > 0 && !httpguts.ValidHostHeader(host) {
+	if url.Host != "" && rawurl != "*" {
+		if url.Port != 0 {
+			header.Set("Host", url.Host+":"+strconv.FormatUint(uint64(url.Port), 10))
+		} else {
+			header.Set("Host", url.Host)
+		}
+	} else if host, has := header.TryGet("Host"); has && len(host) > 0 && !httpguts.ValidHostHeader(host) {
 		header.Set("Host", url.Host)
 	}
 
@@ -92,14 +138,31 @@ func ReadRequest(
 		header.Set("Cache-Control", "no-cache")
 	}
 
-	req := &HttpRequest{
-		method:     method,
-		protoMajor: protoMajor,
-		protoMinor: protoMinor,
-		remoteAddr: remoteAddr,
-		url:        url,
-		header:     header,
-	}
+	req := AcquireRequest()
+	req.method = method
+	req.protoMajor = protoMajor
+	req.protoMinor = protoMinor
+	req.remoteAddr = remoteAddr
+	req.url = url
+	req.header = header
 
 	return req, nil
 }
+
+func isMalformedError(err error) bool {
+	return errors.Is(err, specs.ErrBareLineFeed) ||
+		errors.Is(err, specs.ErrObsoleteLineFolding) ||
+		errors.Is(err, specs.ErrSpaceBeforeColon) ||
+		errors.Is(err, specs.ErrInvalidHeaderName) ||
+		errors.Is(err, specs.ErrInvalidHeaderValue) ||
+		errors.Is(err, specs.ErrConflictingContentLength)
+}
+
+// MalformedRequestError responds 400 "Bad Request" to the request rejected by the strict parsing.
+func MalformedRequestError(err error) *ErrorResponse {
+	return &ErrorResponse{
+		Code: specs.StatusCodeBadRequest,
+		Text: "http: malformed request",
+		Err:  err,
+	}
+}
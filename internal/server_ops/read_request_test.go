@@ -0,0 +1,253 @@
+package server_ops
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/oesand/plow/internal/parsing"
+	"github.com/oesand/plow/specs"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadRequest_RequestTarget(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		valid bool
+		host  string
+		url   string
+	}{
+		{
+			name:  "origin-form",
+			raw:   "GET /index.html?q=1 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			valid: true,
+			host:  "example.com",
+			url:   "/index.html?q=1",
+		},
+		{
+			name:  "absolute-form overrides host",
+			raw:   "GET http://example.com:8080/index.html HTTP/1.1\r\nHost: other.org\r\n\r\n",
+			valid: true,
+			host:  "example.com:8080",
+			url:   "http://example.com:8080/index.html",
+		},
+		{
+			name:  "authority-form for CONNECT",
+			raw:   "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n",
+			valid: true,
+			host:  "example.com:443",
+			url:   "example.com:443",
+		},
+		{
+			name:  "asterisk-form for OPTIONS",
+			raw:   "OPTIONS * HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			valid: true,
+			host:  "example.com",
+			url:   "*",
+		},
+		{
+			name: "CONNECT without port",
+			raw:  "CONNECT example.com HTTP/1.1\r\n\r\n",
+		},
+		{
+			name: "CONNECT with path",
+			raw:  "CONNECT http://example.com:443/ HTTP/1.1\r\n\r\n",
+		},
+		{
+			name: "authority-form for GET",
+			raw:  "GET example.com:443 HTTP/1.1\r\n\r\n",
+		},
+		{
+			name: "absolute-form with unsupported scheme",
+			raw:  "GET ftp://example.com/file HTTP/1.1\r\n\r\n",
+		},
+		{
+			name: "asterisk-form for GET",
+			raw:  "GET * HTTP/1.1\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tt.raw))
+			req, err := ReadRequest(context.Background(), &net.TCPAddr{}, reader, 1024, 8*1024, false)
+
+			if !tt.valid {
+				var respErr *ErrorResponse
+				if !errors.As(err, &respErr) || respErr.Code != specs.StatusCodeBadRequest {
+					t.Errorf("expected bad request error, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			if host := req.Header().Get("Host"); host != tt.host {
+				t.Errorf("expected host %q, got %q", tt.host, host)
+			}
+			if url := req.Url().String(); url != tt.url {
+				t.Errorf("expected url %q, got %q", tt.url, url)
+			}
+		})
+	}
+}
+
+// smugglingCorpus contains known request smuggling payloads,
+// each of them must be rejected by the strict parsing with the distinct error.
+var smugglingCorpus = []struct {
+	name string
+	raw  string
+	err  error
+}{
+	{
+		name: "CL.TE",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 13\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nSMUGGLED",
+		err:  specs.ErrContentLengthWithTransferEncoding,
+	},
+	{
+		name: "TE.CL",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n8\r\nSMUGGLED\r\n0\r\n\r\n",
+		err:  specs.ErrContentLengthWithTransferEncoding,
+	},
+	{
+		name: "CL.CL duplicate",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 8\r\nContent-Length: 7\r\n\r\n12345678",
+		err:  specs.ErrConflictingContentLength,
+	},
+	{
+		name: "CL.CL identical duplicate",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 8\r\nContent-Length: 8\r\n\r\n12345678",
+		err:  specs.ErrConflictingContentLength,
+	},
+	{
+		name: "CL list",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 8, 0\r\n\r\n12345678",
+		err:  specs.ErrConflictingContentLength,
+	},
+	{
+		name: "TE obfuscated by folding",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: x\r\n chunked\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrObsoleteLineFolding,
+	},
+	{
+		name: "TE with space before colon",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding : chunked\r\nContent-Length: 4\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrSpaceBeforeColon,
+	},
+	{
+		name: "TE with tab before colon",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding\t: chunked\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrSpaceBeforeColon,
+	},
+	{
+		name: "TE with invalid name byte",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer\x0bEncoding: chunked\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrInvalidHeaderName,
+	},
+	{
+		name: "header without colon",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding chunked\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrInvalidHeaderName,
+	},
+	{
+		name: "header with empty name",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\n: chunked\r\n\r\n",
+		err:  specs.ErrInvalidHeaderName,
+	},
+	{
+		name: "TE with NUL in value",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\x00\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrInvalidHeaderValue,
+	},
+	{
+		name: "TE with vertical tab in value",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding:\x0bchunked\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrInvalidHeaderValue,
+	},
+	{
+		name: "header with bare CR in value",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nX-Value: a\rTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrInvalidHeaderValue,
+	},
+	{
+		name: "bare LF in request line",
+		raw:  "POST / HTTP/1.1\nHost: a\r\n\r\n",
+		err:  specs.ErrBareLineFeed,
+	},
+	{
+		name: "bare LF in header",
+		raw:  "POST / HTTP/1.1\r\nHost: a\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrBareLineFeed,
+	},
+	{
+		name: "bare LF ending head",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\n\n",
+		err:  specs.ErrBareLineFeed,
+	},
+	{
+		name: "TE chunked not last",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked, identity\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrChunkedNotLast,
+	},
+	{
+		name: "TE chunked twice",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked, chunked\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrChunkedNotLast,
+	},
+	{
+		name: "TE chunked in separate lines not last",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: x\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrChunkedNotLast,
+	},
+	{
+		name: "TE without chunked",
+		raw:  "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: xchunked\r\n\r\n0\r\n\r\n",
+		err:  specs.ErrChunkedNotLast,
+	},
+}
+
+func TestReadRequest_SmugglingCorpus(t *testing.T) {
+	for _, tt := range smugglingCorpus {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tt.raw))
+			req, err := ReadRequest(context.Background(), &net.TCPAddr{}, reader, 1024, 8*1024, true)
+			if err == nil {
+				_, _, err = parsing.ParseContentLength(req.Header(), true)
+			}
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			for _, other := range smugglingCorpus {
+				if other.err != tt.err && errors.Is(err, other.err) {
+					t.Errorf("error %v must be distinct from %v", err, other.err)
+				}
+			}
+		})
+	}
+}
+
+func TestReadRequest_StrictValid(t *testing.T) {
+	raw := "POST /upload HTTP/1.1\r\nHost: example.com\r\nX-Empty:\r\nX-Text: caf\xc3\xa9 \t value\r\n" +
+		"Transfer-Encoding: chunked\r\n\r\n"
+
+	reader := bufio.NewReader(strings.NewReader(raw))
+	req, err := ReadRequest(context.Background(), &net.TCPAddr{}, reader, 1024, 8*1024, true)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if value := req.Header().Get("X-Text"); value != "caf\xc3\xa9 \t value" {
+		t.Errorf("unexpected header value %q", value)
+	}
+	if !req.Header().Has("X-Empty") {
+		t.Error("expected empty header")
+	}
+
+	isChunked, _, err := parsing.ParseContentLength(req.Header(), true)
+	if err != nil || !isChunked {
+		t.Errorf("expected chunked body, got %v %v", isChunked, err)
+	}
+}
@@ -1,7 +1,7 @@
 package server_ops
 
 import (
-	"bytes"
+	"bufio"
 	"github.com/oesand/plow/internal/parsing"
 	"github.com/oesand/plow/specs"
 	"io"
@@ -17,48 +17,60 @@ var (
 	httpV11 = []byte("HTTP/1.1")
 )
 
+// WriteResponseHead writes the status line and the header of the response.
+//
+// If the writer is [bufio.Writer], the head is appended to its free buffer,
+// so it is sent together with the body written next by a single write.
 func WriteResponseHead(writer io.Writer, is11 bool, code specs.StatusCode, header *specs.Header) (int64, error) {
+	var buf []byte
+	if bufWriter, ok := writer.(*bufio.Writer); ok {
+		buf = bufWriter.AvailableBuffer()
+	}
+	buf = AppendResponseHead(buf, is11, code, header)
+
+	i, err := writer.Write(buf)
+	if err != nil {
+		return -1, &specs.OpError{
+			Op:  "write",
+			Err: err,
+		}
+	}
+	return int64(i), nil
+}
+
+// AppendResponseHead appends the status line and the header of the response to the buffer.
+func AppendResponseHead(buf []byte, is11 bool, code specs.StatusCode, header *specs.Header) []byte {
 	if !code.IsValid() {
 		code = specs.StatusCodeOK
 	}
 
 	// Headline
-	var buf bytes.Buffer
 	if is11 {
-		buf.Write(httpV11)
+		buf = append(buf, httpV11...)
 	} else {
-		buf.Write(httpV10)
+		buf = append(buf, httpV10...)
 	}
 
-	buf.WriteRune(' ')
-	buf.Write(strconv.AppendUint(nil, uint64(code), 10))
-	buf.WriteRune(' ')
-	buf.Write(code.Detail())
+	buf = append(buf, ' ')
+	buf = strconv.AppendUint(buf, uint64(code), 10)
+	buf = append(buf, ' ')
+	buf = append(buf, code.Detail()...)
 
-	buf.Write(rawCrlf)
+	buf = append(buf, rawCrlf...)
 
 	// Headers
 	for key, value := range header.All() {
-		buf.WriteString(key)
-		buf.Write(rawColonSpace)
-		buf.WriteString(value)
-		buf.Write(rawCrlf)
+		buf = append(buf, key...)
+		buf = append(buf, rawColonSpace...)
+		buf = append(buf, value...)
+		buf = append(buf, rawCrlf...)
 	}
 
 	for cookie := range header.Cookies() {
-		buf.Write(rawSetCookie)
-		buf.Write(parsing.SetCookieBytes(&cookie))
-		buf.Write(rawCrlf)
+		buf = append(buf, rawSetCookie...)
+		buf = append(buf, parsing.SetCookieBytes(&cookie)...)
+		buf = append(buf, rawCrlf...)
 	}
 
-	buf.Write(rawCrlf)
-
-	i, err := buf.WriteTo(writer)
-	if err != nil {
-		return -1, &specs.OpError{
-			Op:  "write",
-			Err: err,
-		}
-	}
-	return i, nil
+	return append(buf, rawCrlf...)
 }
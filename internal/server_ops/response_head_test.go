@@ -1,6 +1,7 @@
 package server_ops
 
 import (
+	"bufio"
 	"bytes"
 	"github.com/oesand/plow/specs"
 	"strings"
@@ -102,6 +103,21 @@ func TestWriteResponseHead(t *testing.T) {
 			if gotText := writer.String(); gotText != tt.expected {
 				t.Errorf("WriteResponseHead() gotWriter = \n%v\nwant \n%v", gotText, tt.expected)
 			}
+
+			buffered := &bytes.Buffer{}
+			bufWriter := bufio.NewWriter(buffered)
+			n, err := WriteResponseHead(bufWriter, tt.is11, tt.code, tt.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bufWriter.Flush()
+			if gotText := buffered.String(); gotText != tt.expected || n != int64(len(tt.expected)) {
+				t.Errorf("WriteResponseHead() with bufio gotWriter = \n%v\nwant \n%v", gotText, tt.expected)
+			}
+
+			if gotText := string(AppendResponseHead([]byte("prefix"), tt.is11, tt.code, tt.header)); gotText != "prefix"+tt.expected {
+				t.Errorf("AppendResponseHead() got = \n%v\nwant \n%v", gotText, tt.expected)
+			}
 		})
 	}
 }
@@ -0,0 +1,31 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+)
+
+// BufferedConn returns [net.Conn] which reads the data buffered by the reader first,
+// the data is copied, so the reader can be reused after.
+func BufferedConn(conn net.Conn, reader *bufio.Reader) net.Conn {
+	buffered := reader.Buffered()
+	if buffered == 0 {
+		return conn
+	}
+	data, _ := reader.Peek(buffered)
+	return &bufferedConn{
+		Conn:   conn,
+		reader: io.MultiReader(bytes.NewReader(bytes.Clone(data)), conn),
+	}
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -8,15 +8,20 @@ import (
 
 var DefaultBufioReaderPool = BufioReaderPool{MaxSize: 1024}
 
+// BufioReaderPool reuses [bufio.Reader] buffers of the MaxSize,
+// or of the default size of [bufio.NewReader] if MaxSize is zero.
 type BufioReaderPool struct {
 	pool    sync.Pool
 	MaxSize int
 }
 
+// Get returns the reader of the pool reset to read from the reader,
+// or the new one if the pool is empty.
 func (rdp *BufioReaderPool) Get(reader io.Reader) *bufio.Reader {
 	if item := rdp.pool.Get(); item != nil {
 		rd := item.(*bufio.Reader)
 		rd.Reset(reader)
+		return rd
 	}
 	if rdp.MaxSize > 0 {
 		return bufio.NewReaderSize(reader, rdp.MaxSize)
@@ -24,6 +29,7 @@ func (rdp *BufioReaderPool) Get(reader io.Reader) *bufio.Reader {
 	return bufio.NewReader(reader)
 }
 
+// Put returns the reader to the pool, it must not be used after.
 func (rdp *BufioReaderPool) Put(reader *bufio.Reader) {
 	reader.Reset(nil)
 	rdp.pool.Put(reader)
@@ -8,15 +8,20 @@ import (
 
 var DefaultBufioWriterPool = BufioWriterPool{MaxSize: 1024}
 
+// BufioWriterPool reuses [bufio.Writer] buffers of the MaxSize,
+// or of the default size of [bufio.NewWriter] if MaxSize is zero.
 type BufioWriterPool struct {
 	pool    sync.Pool
 	MaxSize int
 }
 
+// Get returns the writer of the pool reset to write to the writer,
+// or the new one if the pool is empty.
 func (rdp *BufioWriterPool) Get(writer io.Writer) *bufio.Writer {
 	if item := rdp.pool.Get(); item != nil {
 		wr := item.(*bufio.Writer)
 		wr.Reset(writer)
+		return wr
 	}
 	if rdp.MaxSize > 0 {
 		return bufio.NewWriterSize(writer, rdp.MaxSize)
@@ -24,6 +29,8 @@ func (rdp *BufioWriterPool) Get(writer io.Writer) *bufio.Writer {
 	return bufio.NewWriter(writer)
 }
 
+// Put returns the writer to the pool, it must not be used after
+// and buffered data which is not flushed is discarded.
 func (rdp *BufioWriterPool) Put(writer *bufio.Writer) {
 	writer.Reset(nil)
 	rdp.pool.Put(writer)
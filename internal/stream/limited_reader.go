@@ -0,0 +1,51 @@
+package stream
+
+import (
+	"io"
+
+	"github.com/oesand/plow/specs"
+)
+
+// LimitedReader reads from R but fails with [specs.ErrTooLarge]
+// once more than N bytes are read, unlike [io.LimitedReader]
+// which silently stops at the limit.
+//
+// If N is zero or negative there is no limit. N may be changed before the limit is exceeded.
+type LimitedReader struct {
+	R io.Reader
+	N int64
+
+	// Size declares the size of the stream if it is known in advance,
+	// so reading fails at once if it exceeds the limit.
+	Size int64
+
+	read     int64
+	exceeded bool
+}
+
+func (r *LimitedReader) Read(p []byte) (int, error) {
+	if r.exceeded || r.N > 0 && (r.Size > r.N || r.read > r.N) {
+		r.exceeded = true
+		return 0, specs.ErrTooLarge
+	}
+
+	if r.N > 0 && int64(len(p)) > r.N-r.read {
+		// Read one byte more than allowed to detect exceeding of the limit
+		p = p[:r.N-r.read+1]
+	}
+
+	n, err := r.R.Read(p)
+	r.read += int64(n)
+	if r.N > 0 && r.read > r.N {
+		n -= int(r.read - r.N)
+		r.read = r.N
+		r.exceeded = true
+		err = specs.ErrTooLarge
+	}
+	return n, err
+}
+
+// Exceeded reports whether reading has failed because of the limit.
+func (r *LimitedReader) Exceeded() bool {
+	return r.exceeded
+}
@@ -3,6 +3,7 @@ package stream
 import (
 	"bufio"
 	"github.com/oesand/plow/specs"
+	"io"
 )
 
 func ReadBufferLine(reader *bufio.Reader, limit int64) ([]byte, error) {
@@ -23,3 +24,36 @@ func ReadBufferLine(reader *bufio.Reader, limit int64) ([]byte, error) {
 	}
 	return line, nil
 }
+
+// ReadStrictLine reads a line which must be terminated by CRLF,
+// unlike [ReadBufferLine] it fails with [specs.ErrBareLineFeed] on a bare LF.
+func ReadStrictLine(reader *bufio.Reader, limit int64) ([]byte, error) {
+	var line []byte
+	for {
+		part, err := reader.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			if err == io.EOF && (len(line) > 0 || len(part) > 0) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		// Allow the limit for the line content without CRLF
+		if limit > 0 && int64(len(line))+int64(len(part)) > limit+2 {
+			return nil, specs.ErrTooLarge
+		}
+
+		if err == nil && line == nil {
+			line = part
+			break
+		}
+		line = append(line, part...)
+		if err == nil {
+			break
+		}
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, specs.ErrBareLineFeed
+	}
+	return line[:len(line)-2], nil
+}
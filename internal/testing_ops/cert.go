@@ -1,8 +1,17 @@
 package testing_ops
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
+	"sync"
+	"time"
 )
 
 var LocalhostCert = []byte(`-----BEGIN CERTIFICATE-----
@@ -62,3 +71,92 @@ func NewTlsCert() tls.Certificate {
 	}
 	return cert
 }
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// loadTestCA creates the CA issuing test certificates once per process.
+var loadTestCA = sync.OnceValue(func() *testCA {
+	key := generateKey()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Plow Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	cert := createCert(template, template, key, key)
+	return &testCA{cert: cert, key: key}
+})
+
+// CertPool returns the pool which trusts certificates created by [NewClientCert] and [NewServerCert].
+func CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(loadTestCA().cert)
+	return pool
+}
+
+// NewClientCert creates the client certificate issued by the test CA.
+func NewClientCert(commonName string, dnsNames ...string) tls.Certificate {
+	return issueCert(x509.ExtKeyUsageClientAuth, commonName, dnsNames)
+}
+
+// NewServerCert creates the server certificate for the names issued by the test CA.
+func NewServerCert(commonName string, dnsNames ...string) tls.Certificate {
+	return issueCert(x509.ExtKeyUsageServerAuth, commonName, dnsNames)
+}
+
+// CertPEM encodes the certificate created by [NewClientCert] or [NewServerCert] to PEM.
+func CertPEM(cert tls.Certificate) (certPEM, keyPEM []byte) {
+	keyDer, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		panic(fmt.Sprintf("plow: failed to marshal key: %s", err))
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+	return
+}
+
+func issueCert(usage x509.ExtKeyUsage, commonName string, dnsNames []string) tls.Certificate {
+	ca := loadTestCA()
+	key := generateKey()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	cert := createCert(template, ca.cert, key, ca.key)
+	return tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  key,
+		Leaf:        cert,
+	}
+}
+
+func generateKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("plow: failed to generate key: %s", err))
+	}
+	return key
+}
+
+func createCert(template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		panic(fmt.Sprintf("plow: failed to create certificate: %s", err))
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(fmt.Sprintf("plow: failed to parse certificate: %s", err))
+	}
+	return cert
+}
@@ -0,0 +1,55 @@
+package workers
+
+import (
+	"time"
+)
+
+// DefaultIdleTimeout is the time the idle worker waits for the next task before it exits.
+const DefaultIdleTimeout = 10 * time.Second
+
+// NewPool creates [Pool] whose idle workers exit after the idle timeout,
+// or after [DefaultIdleTimeout] if it is zero.
+func NewPool(idleTimeout time.Duration) *Pool {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	return &Pool{
+		tasks:       make(chan func()),
+		idleTimeout: idleTimeout,
+	}
+}
+
+// Pool runs tasks by goroutines which are reused by later tasks,
+// so goroutines with already grown stacks serve connections and requests.
+//
+// The number of workers is not limited, the new goroutine is started
+// if there is no idle one.
+type Pool struct {
+	tasks       chan func()
+	idleTimeout time.Duration
+}
+
+// Go runs the task by the idle worker or by the new one.
+func (pool *Pool) Go(task func()) {
+	select {
+	case pool.tasks <- task:
+	default:
+		go pool.work(task)
+	}
+}
+
+func (pool *Pool) work(task func()) {
+	timer := time.NewTimer(pool.idleTimeout)
+	defer timer.Stop()
+
+	for {
+		task()
+
+		timer.Reset(pool.idleTimeout)
+		select {
+		case task = <-pool.tasks:
+		case <-timer.C:
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package workers
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool_Go(t *testing.T) {
+	pool := NewPool(time.Second)
+
+	var wg sync.WaitGroup
+	var count atomic.Int32
+	for range 100 {
+		wg.Add(1)
+		pool.Go(func() {
+			defer wg.Done()
+			count.Add(1)
+		})
+	}
+	wg.Wait()
+
+	if got := count.Load(); got != 100 {
+		t.Errorf("tasks done = %d, want 100", got)
+	}
+}
+
+func TestPool_ReusesWorker(t *testing.T) {
+	pool := NewPool(time.Second)
+
+	done := make(chan struct{})
+	pool.Go(func() { done <- struct{}{} })
+	<-done
+
+	// The worker becomes idle after the task returns
+	var reused bool
+	for range 100 {
+		select {
+		case pool.tasks <- func() { done <- struct{}{} }:
+			reused = true
+		default:
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		break
+	}
+	if !reused {
+		t.Fatal("idle worker is not reused")
+	}
+	<-done
+}
+
+func TestPool_IdleTimeout(t *testing.T) {
+	pool := NewPool(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	pool.Go(func() { close(done) })
+	<-done
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case pool.tasks <- func() {}:
+		t.Fatal("idle worker is not exited")
+	default:
+	}
+}
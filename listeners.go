@@ -0,0 +1,66 @@
+package plow
+
+import (
+	"io/fs"
+	"net"
+	"os"
+
+	"github.com/oesand/plow/internal/listen"
+)
+
+// ListenReusePort creates count listeners bound to the same TCP network address
+// with SO_REUSEPORT and merges them into one [net.Listener],
+// so the kernel balances incoming connections between count accept loops.
+//
+// If the port of the address is zero, the same free port is used by all listeners.
+// Closing the returned listener closes all of them.
+//
+// SO_REUSEPORT is supported only on Linux, on other systems [errors.ErrUnsupported] is returned.
+func ListenReusePort(network, addr string, count int) (net.Listener, error) {
+	listeners, err := listen.ReusePort(network, addr, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) == 1 {
+		return listeners[0], nil
+	}
+	return listen.NewMulti(listeners), nil
+}
+
+// ListenUnix listens on the Unix domain socket at the path
+// and sets the permissions of the socket file to the mode, if not zero.
+//
+// The stale socket file left by the crashed process is removed,
+// but the path of the socket served by another process is refused.
+// The socket file is removed when the listener is closed.
+func ListenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	return listen.Unix(path, mode)
+}
+
+// MultiListener merges listeners into one [net.Listener], accepting each of them by its own goroutine,
+// so one [Server] can serve several sockets, such as ones of [SystemdListeners].
+//
+// Closing the returned listener closes all of them.
+func MultiListener(listeners ...net.Listener) net.Listener {
+	return listen.NewMulti(listeners)
+}
+
+// SystemdListeners returns listeners passed by the systemd socket activation,
+// grouped by names set with FileDescriptorName= of the socket units, by default "unknown".
+//
+// It returns nil if the process is not activated by sockets.
+// The variables of the activation are removed, so they are not passed to child processes.
+func SystemdListeners() (map[string][]net.Listener, error) {
+	count, names, err := listen.ParseSystemdEnv(os.Getpid(), os.Getenv)
+	unsetSystemdEnv()
+	if err != nil || count == 0 {
+		return nil, err
+	}
+	return listen.Inherit(count, names)
+}
+
+func unsetSystemdEnv() {
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+}
@@ -0,0 +1,90 @@
+package plow
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/oesand/plow/specs"
+)
+
+func TestServer_ListenReusePort(t *testing.T) {
+	listener, err := ListenReusePort("tcp4", "127.0.0.1:0", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+	go server.Serve(listener)
+	defer server.Shutdown()
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for range 20 {
+		resp, err := client.Get("http://" + listener.Addr().String())
+		if err != nil {
+			t.Fatal("req:", err)
+		}
+		checkHttpResponseBody(t, resp, []byte("okay"))
+	}
+}
+
+func TestServer_ListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plow.sock")
+	listener, err := ListenUnix(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, request.RemoteAddr().Network())
+	}))
+	go server.Serve(listener)
+	defer server.Shutdown()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+		DisableKeepAlives: true,
+	}}
+	resp, err := client.Get("http://localhost/")
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	checkHttpResponseBody(t, resp, []byte("unix"))
+}
+
+func TestServer_MultiListener(t *testing.T) {
+	first, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ListenUnix(filepath.Join(t.TempDir(), "plow.sock"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+	go server.Serve(MultiListener(first, second))
+	defer server.Shutdown()
+
+	for _, listener := range []net.Listener{first, second} {
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, listener.Addr().Network(), listener.Addr().String())
+			},
+			DisableKeepAlives: true,
+		}}
+		resp, err := client.Get("http://localhost/")
+		if err != nil {
+			t.Fatal("req:", err)
+		}
+		checkHttpResponseBody(t, resp, []byte("okay"))
+	}
+}
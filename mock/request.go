@@ -1,6 +1,7 @@
 package mock
 
 import (
+	"crypto/tls"
 	"github.com/oesand/plow"
 	"github.com/oesand/plow/internal/proxy"
 	"github.com/oesand/plow/specs"
@@ -38,6 +39,8 @@ type RequestBuilder struct {
 	url        *specs.Url
 	header     *specs.Header
 	body       io.Reader
+	trailer    *specs.Header
+	tlsState   *tls.ConnectionState
 
 	req *request
 }
@@ -87,6 +90,15 @@ func (b *RequestBuilder) ConfHeader(conf func(*specs.Header)) *RequestBuilder {
 	return b
 }
 
+// Trailer returns the trailer for the request.
+// If the trailer is nil, it initializes a new Header.
+func (b *RequestBuilder) Trailer() *specs.Header {
+	if b.trailer == nil {
+		b.trailer = specs.NewHeader()
+	}
+	return b.trailer
+}
+
 // Hijacker returns the hijack handler for the request.
 func (b *RequestBuilder) Hijacker() plow.HijackHandler {
 	return b.hijacker
@@ -98,6 +110,12 @@ func (b *RequestBuilder) Body(body io.ReadCloser) *RequestBuilder {
 	return b
 }
 
+// TLS sets the TLS connection state for the request, see plow.TLSState.
+func (b *RequestBuilder) TLS(state *tls.ConnectionState) *RequestBuilder {
+	b.tlsState = state
+	return b
+}
+
 // Request returns a plow.Request based on the current state of the RequestBuilder.
 func (b *RequestBuilder) Request() plow.Request {
 	if b.header == nil {
@@ -140,3 +158,11 @@ func (r request) Header() *specs.Header {
 func (r request) Body() io.Reader {
 	return r.b.body
 }
+
+func (r request) Trailer() *specs.Header {
+	return r.b.trailer
+}
+
+func (r request) TLS() *tls.ConnectionState {
+	return r.b.tlsState
+}
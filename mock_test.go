@@ -104,7 +104,7 @@ func newTestServer(handler func(req Request) (specs.StatusCode, *specs.Header, [
 	url, err := serveTcpTest(ctx, func(conn net.Conn) {
 		bufioReader := bufio.NewReader(conn)
 
-		req, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), bufioReader, 1024, 8*1024)
+		req, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), bufioReader, 1024, 8*1024, false)
 		if err != nil {
 			panic(err)
 		}
@@ -0,0 +1,100 @@
+package mux
+
+import (
+	"context"
+	"crypto/x509"
+	"slices"
+
+	"github.com/oesand/plow"
+	"github.com/oesand/plow/internal"
+	"github.com/oesand/plow/specs"
+)
+
+var certIdentityKey = internal.FlagKey{Key: "mux.cert.identity.key"}
+
+// CertIdentityFromContext returns the identity of the caller
+// authenticated by [ClientCertAuth], or false if not authenticated.
+func CertIdentityFromContext(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(certIdentityKey).(string)
+	return identity, ok
+}
+
+// CertIdentityFunc maps the verified client certificate to the identity of the caller,
+// it returns false if the certificate is not known.
+type CertIdentityFunc func(cert *x509.Certificate) (string, bool)
+
+// CertSubjects creates [CertIdentityFunc] which maps the common name
+// of the certificate subject to the identity.
+func CertSubjects(identities map[string]string) CertIdentityFunc {
+	return func(cert *x509.Certificate) (string, bool) {
+		identity, ok := identities[cert.Subject.CommonName]
+		return identity, ok
+	}
+}
+
+// CertSANs creates [CertIdentityFunc] which maps the subject alternative names
+// of the certificate to the identity: DNS names, URIs (such as SPIFFE IDs),
+// email addresses and IP addresses, the first known name is used.
+func CertSANs(identities map[string]string) CertIdentityFunc {
+	return func(cert *x509.Certificate) (string, bool) {
+		names := slices.Clone(cert.DNSNames)
+		for _, uri := range cert.URIs {
+			names = append(names, uri.String())
+		}
+		names = append(names, cert.EmailAddresses...)
+		for _, ip := range cert.IPAddresses {
+			names = append(names, ip.String())
+		}
+
+		for _, name := range names {
+			if identity, ok := identities[name]; ok {
+				return identity, true
+			}
+		}
+		return "", false
+	}
+}
+
+// ClientCertAuth creates a [Middleware] which authenticates callers by TLS client certificates
+// verified by the [plow.Server], the identity is available by [CertIdentityFromContext]
+// and routes can be restricted to identities with the [CertIdentities] flag.
+//
+// Requests without the verified certificate are responded with 401 "Unauthorized",
+// requests with the unknown certificate are responded with 403 "Forbidden".
+//
+// The server must request and verify client certificates, for example with
+// tls.Config.ClientAuth set to [tls.RequireAndVerifyClientCert] and tls.Config.ClientCAs.
+func ClientCertAuth(identify CertIdentityFunc) Middleware {
+	if identify == nil {
+		panic("plow: nil identity function")
+	}
+
+	return func(ctx context.Context, request plow.Request, next NextFunc) plow.Response {
+		state := plow.TLSState(request)
+		if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+			return plow.TextResponse(specs.StatusCodeUnauthorized, specs.ContentTypePlain, "Client certificate required")
+		}
+
+		identity, ok := identify(state.VerifiedChains[0][0])
+		if !ok {
+			return plow.TextResponse(specs.StatusCodeForbidden, specs.ContentTypePlain, "Client certificate is not allowed")
+		}
+		return next(context.WithValue(ctx, certIdentityKey, identity))
+	}
+}
+
+// CertIdentities is a route flag which allows the route only for the listed identities
+// authenticated by [ClientCertAuth], other requests are responded with 403 "Forbidden".
+type CertIdentities []string
+
+// applyCertIdentities checks the identity of the request by all [CertIdentities] flags of the route,
+// it returns the response if the identity is not allowed.
+func applyCertIdentities(ctx context.Context, route Route) plow.Response {
+	for allowed := range FlagsOfType[CertIdentities](route) {
+		identity, ok := CertIdentityFromContext(ctx)
+		if !ok || !slices.Contains(allowed, identity) {
+			return plow.TextResponse(specs.StatusCodeForbidden, specs.ContentTypePlain, "Forbidden")
+		}
+	}
+	return nil
+}
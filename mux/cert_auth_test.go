@@ -0,0 +1,105 @@
+package mux
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/oesand/plow"
+	"github.com/oesand/plow/mock"
+	"github.com/oesand/plow/specs"
+)
+
+func verifiedState(cert *x509.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		Version:        tls.VersionTLS13,
+		VerifiedChains: [][]*x509.Certificate{{cert}},
+	}
+}
+
+func TestMux_ClientCertAuth(t *testing.T) {
+	handler := plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+		identity, _ := CertIdentityFromContext(ctx)
+		return plow.TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, identity)
+	})
+
+	mx := New().
+		Use(ClientCertAuth(CertSubjects(map[string]string{
+			"billing-1": "billing",
+			"orders-1":  "orders",
+		}))).
+		Route(specs.HttpMethodGet, "/whoami", handler).
+		Route(specs.HttpMethodGet, "/invoices", handler, CertIdentities{"billing"})
+
+	tests := []struct {
+		name   string
+		path   string
+		state  *tls.ConnectionState
+		status specs.StatusCode
+	}{
+		{"NoTLS", "/whoami", nil, specs.StatusCodeUnauthorized},
+		{"NotVerified", "/whoami", &tls.ConnectionState{Version: tls.VersionTLS13}, specs.StatusCodeUnauthorized},
+		{"Unknown", "/whoami", verifiedState(&x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}}), specs.StatusCodeForbidden},
+		{"Known", "/whoami", verifiedState(&x509.Certificate{Subject: pkix.Name{CommonName: "orders-1"}}), specs.StatusCodeOK},
+		{"AllowedIdentity", "/invoices", verifiedState(&x509.Certificate{Subject: pkix.Name{CommonName: "billing-1"}}), specs.StatusCodeOK},
+		{"DeniedIdentity", "/invoices", verifiedState(&x509.Certificate{Subject: pkix.Name{CommonName: "orders-1"}}), specs.StatusCodeForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mock.DefaultRequest().Url(specs.MustParseUrl(tt.path)).TLS(tt.state).Request()
+			resp := mx.Handle(context.Background(), req)
+			if resp.StatusCode() != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, resp.StatusCode())
+			}
+		})
+	}
+}
+
+func TestMux_CertIdentitiesWithoutAuth(t *testing.T) {
+	mx := New().
+		Route(specs.HttpMethodGet, "/invoices", plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+			return plow.EmptyResponse(specs.StatusCodeOK)
+		}), CertIdentities{"billing"})
+
+	resp := mx.Handle(context.Background(), mock.DefaultRequest().Url(specs.MustParseUrl("/invoices")).Request())
+	if resp.StatusCode() != specs.StatusCodeForbidden {
+		t.Errorf("expected 403, got %d", resp.StatusCode())
+	}
+}
+
+func TestCertSANs(t *testing.T) {
+	identify := CertSANs(map[string]string{
+		"billing.internal":                         "billing",
+		"spiffe://cluster.local/ns/prod/sa/orders": "orders",
+		"ops@example.com":                          "ops",
+		"10.0.0.7":                                 "agent",
+	})
+
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate
+		identity string
+		ok       bool
+	}{
+		{"DNS", &x509.Certificate{DNSNames: []string{"other.internal", "billing.internal"}}, "billing", true},
+		{"URI", &x509.Certificate{URIs: []*url.URL{{Scheme: "spiffe", Host: "cluster.local", Path: "/ns/prod/sa/orders"}}}, "orders", true},
+		{"Email", &x509.Certificate{EmailAddresses: []string{"ops@example.com"}}, "ops", true},
+		{"IP", &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.0.0.7")}}, "agent", true},
+		{"Unknown", &x509.Certificate{DNSNames: []string{"other.internal"}}, "", false},
+		{"Empty", &x509.Certificate{}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, ok := identify(tt.cert)
+			if identity != tt.identity || ok != tt.ok {
+				t.Errorf("expected %q %v, got %q %v", tt.identity, tt.ok, identity, ok)
+			}
+		})
+	}
+}
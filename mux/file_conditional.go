@@ -0,0 +1,78 @@
+package mux
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oesand/plow"
+	"github.com/oesand/plow/specs"
+)
+
+// checkPreconditions evaluates conditional headers of the request by RFC 9110 section 13.2.2,
+// it returns [specs.StatusCodeUndefined] if the file must be served.
+func checkPreconditions(req plow.Request, etag string, modTime time.Time) specs.StatusCode {
+	header := req.Header()
+
+	if ifMatch, has := header.TryGet("If-Match"); has {
+		if !matchETag(ifMatch, etag, false) {
+			return specs.StatusCodePreconditionFailed
+		}
+	} else if since, ok := parseHttpTime(header.Get("If-Unmodified-Since")); ok && !isZeroTime(modTime) {
+		if modTime.Truncate(time.Second).After(since) {
+			return specs.StatusCodePreconditionFailed
+		}
+	}
+
+	if ifNoneMatch, has := header.TryGet("If-None-Match"); has {
+		if matchETag(ifNoneMatch, etag, true) {
+			return specs.StatusCodeNotModified
+		}
+	} else if since, ok := parseHttpTime(header.Get("If-Modified-Since")); ok && !isZeroTime(modTime) {
+		if !modTime.Truncate(time.Second).After(since) {
+			return specs.StatusCodeNotModified
+		}
+	}
+
+	return specs.StatusCodeUndefined
+}
+
+// checkIfRange reports whether the "Range" header must be applied,
+// it is so if "If-Range" is absent or matches the current representation.
+func checkIfRange(req plow.Request, etag string, modTime time.Time) bool {
+	ifRange := req.Header().Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		return !strings.HasPrefix(ifRange, "W/") && ifRange == etag
+	}
+	since, ok := parseHttpTime(ifRange)
+	return ok && !isZeroTime(modTime) && modTime.Truncate(time.Second).Equal(since)
+}
+
+// matchETag reports whether the list of entity tags contains the etag,
+// weak comparison ignores the "W/" prefix, strong one never matches weak tags.
+func matchETag(list, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func parseHttpTime(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(value)
+	return t, err == nil
+}
@@ -0,0 +1,188 @@
+package mux
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/oesand/plow"
+)
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// httpRange specifies the byte range to be sent to the client.
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return "bytes " + strconv.FormatInt(r.start, 10) + "-" +
+		strconv.FormatInt(r.start+r.length-1, 10) + "/" + strconv.FormatInt(size, 10)
+}
+
+// parseRange parses the "Range" header value in "bytes" unit,
+// ranges which start beyond the size are skipped,
+// if no ranges left then errRangeNotSatisfiable is returned.
+func parseRange(value string, size int64) ([]httpRange, error) {
+	const prefix = "bytes="
+	if len(value) < len(prefix) || !strings.EqualFold(value[:len(prefix)], prefix) {
+		return nil, errors.New("invalid range unit")
+	}
+
+	var ranges []httpRange
+	var skipped bool
+	for _, spec := range strings.Split(value[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, errors.New("invalid range")
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r httpRange
+		if first == "" {
+			// suffix-range: the last N bytes
+			suffix, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if suffix == 0 || size == 0 {
+				skipped = true
+				continue
+			}
+			if suffix > size {
+				suffix = size
+			}
+			r.start, r.length = size-suffix, suffix
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errors.New("invalid range")
+			}
+
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, errors.New("invalid range")
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+
+			if start >= size {
+				skipped = true
+				continue
+			}
+			r.start, r.length = start, end-start+1
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		if skipped {
+			return nil, errRangeNotSatisfiable
+		}
+		return nil, errors.New("invalid range")
+	}
+	return ranges, nil
+}
+
+func rangesSize(ranges []httpRange) int64 {
+	var size int64
+	for _, r := range ranges {
+		size += r.length
+	}
+	return size
+}
+
+func newBoundary() string {
+	return multipart.NewWriter(io.Discard).Boundary()
+}
+
+// fileResponse writes the file content or its ranges,
+// the file is closed when the body is written.
+type fileResponse struct {
+	plow.Response
+	file          fs.File
+	size          int64
+	contentLength int64
+	contentType   string
+	ranges        []httpRange
+	boundary      string
+}
+
+func (resp *fileResponse) WriteBody(writer io.Writer) error {
+	defer resp.file.Close()
+
+	switch len(resp.ranges) {
+	case 0:
+		_, err := io.CopyN(writer, resp.file, resp.size)
+		return err
+	case 1:
+		return resp.writeRange(writer, resp.ranges[0])
+	}
+
+	mw := multipart.NewWriter(writer)
+	if err := mw.SetBoundary(resp.boundary); err != nil {
+		return err
+	}
+	for _, r := range resp.ranges {
+		part, err := mw.CreatePart(resp.partHeader(r))
+		if err != nil {
+			return err
+		}
+		if err = resp.writeRange(part, r); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func (resp *fileResponse) ContentLength() int64 {
+	return resp.contentLength
+}
+
+func (resp *fileResponse) writeRange(writer io.Writer, r httpRange) error {
+	if _, err := resp.file.(io.Seeker).Seek(r.start, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.CopyN(writer, resp.file, r.length)
+	return err
+}
+
+func (resp *fileResponse) partHeader(r httpRange) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Type":  {resp.contentType},
+		"Content-Range": {r.contentRange(resp.size)},
+	}
+}
+
+// multipartLength calculates the size of "multipart/byteranges" body.
+func (resp *fileResponse) multipartLength() int64 {
+	var counter countingWriter
+	mw := multipart.NewWriter(&counter)
+	mw.SetBoundary(resp.boundary)
+	for _, r := range resp.ranges {
+		mw.CreatePart(resp.partHeader(r))
+		counter += countingWriter(r.length)
+	}
+	mw.Close()
+	return int64(counter)
+}
+
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
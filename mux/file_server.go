@@ -0,0 +1,319 @@
+package mux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oesand/plow"
+	"github.com/oesand/plow/internal"
+	"github.com/oesand/plow/internal/encoding"
+	"github.com/oesand/plow/specs"
+)
+
+// FileServer creates a [FileHandler] that serves files from the fsys
+// with "index.html" index file and precompressed siblings enabled.
+//
+// When routed with wildcard parameter, such as "/static/{*}",
+// the parameter value is used as file path, otherwise the whole request path.
+func FileServer(fsys fs.FS) *FileHandler {
+	return &FileHandler{
+		FS:            fsys,
+		IndexFiles:    []string{"index.html"},
+		Precompressed: true,
+	}
+}
+
+// FileHandler is a [plow.Handler] that serves files from [fs.FS].
+//
+// It supports conditional requests by "ETag" and "Last-Modified",
+// single and multiple byte ranges for files implementing [io.Seeker]
+// and rejects paths escaping the root of the file system.
+type FileHandler struct {
+	_ internal.NoCopy
+
+	// FS specifies the file system to serve files from.
+	FS fs.FS
+
+	// IndexFiles specifies names of files which are served
+	// when a directory is requested, in order of priority.
+	IndexFiles []string
+
+	// DirectoryListing enables listing of directories which have no index file,
+	// otherwise [specs.StatusCodeNotFound] is answered.
+	DirectoryListing bool
+
+	// Precompressed enables serving of ".br" and ".gz" siblings
+	// of the requested file according to the "Accept-Encoding" header.
+	Precompressed bool
+
+	// CacheControl optionally specifies the value of the "Cache-Control" header.
+	CacheControl string
+}
+
+var precompressedSiblings = []struct {
+	encoding string
+	ext      string
+}{
+	{specs.ContentEncodingBrotli, ".br"},
+	{specs.ContentEncodingGzip, ".gz"},
+}
+
+// Handle implements the [plow.Handler] interface.
+func (fh *FileHandler) Handle(ctx context.Context, req plow.Request) plow.Response {
+	if fh.FS == nil {
+		panic("plow: nil file system")
+	}
+
+	method := req.Method()
+	if method != specs.HttpMethodGet && method != specs.HttpMethodHead {
+		return plow.EmptyResponse(specs.StatusCodeMethodNotAllowed, func(resp plow.Response) {
+			resp.Header().Set("Allow", "GET, HEAD")
+		})
+	}
+
+	url := req.Url()
+	filePath, ok := url.Query["*"]
+	if !ok {
+		filePath = url.Path
+	}
+
+	name, ok := cleanFilePath(filePath)
+	if !ok {
+		return plow.TextResponse(specs.StatusCodeBadRequest, specs.ContentTypePlain, "invalid file path")
+	}
+
+	info, err := fs.Stat(fh.FS, name)
+	if err != nil {
+		return fileErrorResponse(err)
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(url.Path, "/") {
+			// The location is relative to the last element, so the path such as "//example.com"
+			// does not redirect to another host
+			location := "./" + neturl.PathEscape(path.Base(url.Path)) + "/"
+			return plow.EmptyResponse(specs.StatusCodeMovedPermanently, func(resp plow.Response) {
+				resp.Header().Set("Location", location)
+			})
+		}
+
+		for _, index := range fh.IndexFiles {
+			indexName := path.Join(name, index)
+			if indexInfo, err := fs.Stat(fh.FS, indexName); err == nil && indexInfo.Mode().IsRegular() {
+				return fh.serveFile(req, indexName, indexInfo)
+			}
+		}
+
+		if !fh.DirectoryListing {
+			return fileErrorResponse(fs.ErrNotExist)
+		}
+		return fh.serveDir(name, info)
+	}
+
+	if !info.Mode().IsRegular() {
+		return fileErrorResponse(fs.ErrNotExist)
+	}
+	return fh.serveFile(req, name, info)
+}
+
+func (fh *FileHandler) serveFile(req plow.Request, name string, info fs.FileInfo) plow.Response {
+	header := specs.NewHeader()
+
+	servedName, servedInfo, servedEncoding := name, info, ""
+	if fh.Precompressed {
+		var offers []string
+		siblings := make(map[string]fs.FileInfo)
+		for _, sibling := range precompressedSiblings {
+			siblingInfo, err := fs.Stat(fh.FS, name+sibling.ext)
+			if err == nil && siblingInfo.Mode().IsRegular() {
+				offers = append(offers, sibling.encoding)
+				siblings[sibling.encoding] = siblingInfo
+			}
+		}
+
+		if len(offers) > 0 {
+			header.Set("Vary", "Accept-Encoding")
+			if acceptEncoding, has := req.Header().TryGet("Accept-Encoding"); has {
+				servedEncoding = encoding.Negotiate(acceptEncoding, offers)
+			}
+			for _, sibling := range precompressedSiblings {
+				if sibling.encoding == servedEncoding {
+					servedName, servedInfo = name+sibling.ext, siblings[servedEncoding]
+				}
+			}
+		}
+	}
+
+	modTime := servedInfo.ModTime()
+	etag := fmt.Sprintf("\"%x-%x\"", modTime.UnixNano(), servedInfo.Size())
+	header.Set("ETag", etag)
+	if !isZeroTime(modTime) {
+		header.Set("Last-Modified", modTime.UTC().Format(specs.TimeFormat))
+	}
+	if fh.CacheControl != "" {
+		header.Set("Cache-Control", fh.CacheControl)
+	}
+
+	if code := checkPreconditions(req, etag, modTime); code != specs.StatusCodeUndefined {
+		return plow.EmptyResponse(code, func(resp plow.Response) {
+			if code == specs.StatusCodeNotModified {
+				copyHeader(resp.Header(), header)
+			}
+		})
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = fh.sniffContentType(name)
+	}
+
+	file, err := fh.FS.Open(servedName)
+	if err != nil {
+		return fileErrorResponse(err)
+	}
+
+	if servedEncoding != "" {
+		header.Set("Content-Encoding", servedEncoding)
+	}
+	header.Set("Accept-Ranges", "bytes")
+
+	size := servedInfo.Size()
+	resp := &fileResponse{
+		file:          file,
+		size:          size,
+		contentLength: size,
+		contentType:   contentType,
+	}
+
+	_, seekable := file.(io.Seeker)
+	if rangeHeader := req.Header().Get("Range"); rangeHeader != "" && seekable && checkIfRange(req, etag, modTime) {
+		ranges, err := parseRange(rangeHeader, size)
+		switch {
+		case errors.Is(err, errRangeNotSatisfiable):
+			file.Close()
+			return plow.EmptyResponse(specs.StatusCodeRequestedRangeNotSatisfiable, func(resp plow.Response) {
+				resp.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+			})
+		case err == nil && rangesSize(ranges) <= size:
+			resp.ranges = ranges
+		}
+	}
+
+	code := specs.StatusCodeOK
+	switch len(resp.ranges) {
+	case 0:
+		header.Set("Content-Type", contentType)
+	case 1:
+		code = specs.StatusCodePartialContent
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Range", resp.ranges[0].contentRange(size))
+		resp.contentLength = resp.ranges[0].length
+	default:
+		code = specs.StatusCodePartialContent
+		resp.boundary = newBoundary()
+		header.Set("Content-Type", "multipart/byteranges; boundary="+resp.boundary)
+		resp.contentLength = resp.multipartLength()
+	}
+	header.Set("Content-Length", strconv.FormatInt(resp.contentLength, 10))
+
+	resp.Response = plow.EmptyResponse(code, func(resp plow.Response) {
+		copyHeader(resp.Header(), header)
+	})
+
+	if req.Method() == specs.HttpMethodHead {
+		file.Close()
+		return resp.Response
+	}
+	return resp
+}
+
+func (fh *FileHandler) sniffContentType(name string) string {
+	file, err := fh.FS.Open(name)
+	if err != nil {
+		return specs.ContentTypeRaw
+	}
+	defer file.Close()
+
+	var buf [512]byte
+	n, _ := io.ReadFull(file, buf[:])
+	return http.DetectContentType(buf[:n])
+}
+
+func (fh *FileHandler) serveDir(name string, info fs.FileInfo) plow.Response {
+	entries, err := fs.ReadDir(fh.FS, name)
+	if err != nil {
+		return fileErrorResponse(err)
+	}
+
+	var b strings.Builder
+	b.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		href := (&neturl.URL{Path: entryName}).String()
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", html.EscapeString(href), html.EscapeString(entryName))
+	}
+	b.WriteString("</pre>\n")
+
+	return plow.TextResponse(specs.StatusCodeOK, specs.ContentTypeHTML+"; charset=utf-8", b.String(), func(resp plow.Response) {
+		if modTime := info.ModTime(); !isZeroTime(modTime) {
+			resp.Header().Set("Last-Modified", modTime.UTC().Format(specs.TimeFormat))
+		}
+	})
+}
+
+// cleanFilePath converts the request path, which is already unescaped, to the [fs.FS] name,
+// paths with ".." elements, backslashes or NUL characters are rejected.
+func cleanFilePath(name string) (string, bool) {
+	if strings.ContainsAny(name, "\\\x00") {
+		return "", false
+	}
+
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", false
+		}
+	}
+
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, fs.ValidPath(name)
+}
+
+func fileErrorResponse(err error) plow.Response {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return plow.TextResponse(specs.StatusCodeNotFound, specs.ContentTypePlain, "404 page not found")
+	case errors.Is(err, fs.ErrPermission):
+		return plow.TextResponse(specs.StatusCodeForbidden, specs.ContentTypePlain, "403 forbidden")
+	default:
+		return plow.TextResponse(specs.StatusCodeInternalServerError, specs.ContentTypePlain, "500 internal server error")
+	}
+}
+
+func copyHeader(dst, src *specs.Header) {
+	for name, value := range src.All() {
+		dst.Set(name, value)
+	}
+}
+
+var unixEpoch = time.Unix(0, 0)
+
+func isZeroTime(t time.Time) bool {
+	return t.IsZero() || t.Equal(unixEpoch)
+}
@@ -0,0 +1,407 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/oesand/plow"
+	"github.com/oesand/plow/mock"
+	"github.com/oesand/plow/specs"
+)
+
+var testModTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":        {Data: []byte("<h1>index</h1>"), ModTime: testModTime},
+		"data.txt":          {Data: []byte("0123456789abcdef"), ModTime: testModTime},
+		"blob":              {Data: []byte("%PDF-1.4 content"), ModTime: testModTime},
+		"app.js":            {Data: []byte("console.log('plain')"), ModTime: testModTime},
+		"app.js.gz":         {Data: []byte("gzip-content"), ModTime: testModTime},
+		"app.js.br":         {Data: []byte("brotli-content"), ModTime: testModTime},
+		"docs/readme.md":    {Data: []byte("# readme"), ModTime: testModTime},
+		"docs/<script>.txt": {Data: []byte("escaped"), ModTime: testModTime},
+		"100%.txt":          {Data: []byte("percent"), ModTime: testModTime},
+		"a%20b.txt":         {Data: []byte("escaped percent"), ModTime: testModTime},
+	}
+}
+
+func serveTestFile(t *testing.T, fh *FileHandler, method specs.HttpMethod, path string, conf func(*specs.Header)) (plow.Response, []byte) {
+	req := mock.DefaultRequest().
+		Method(method).
+		Url(specs.MustParseUrl(path)).
+		ConfHeader(func(header *specs.Header) {
+			if conf != nil {
+				conf(header)
+			}
+		}).
+		Request()
+
+	resp := fh.Handle(context.Background(), req)
+	if resp == nil {
+		t.Fatal("nil response")
+	}
+
+	var body bytes.Buffer
+	if writer, ok := resp.(plow.BodyWriter); ok {
+		if err := writer.WriteBody(&body); err != nil {
+			t.Fatal("write body:", err)
+		}
+	}
+	return resp, body.Bytes()
+}
+
+func TestFileServer_ServeFile(t *testing.T) {
+	fh := FileServer(newTestFS())
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{path: "/data.txt", contentType: "text/plain; charset=utf-8", body: "0123456789abcdef"},
+		{path: "/blob", contentType: "application/pdf", body: "%PDF-1.4 content"},
+		{path: "/", contentType: "text/html; charset=utf-8", body: "<h1>index</h1>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, body := serveTestFile(t, fh, specs.HttpMethodGet, tt.path, nil)
+			if resp.StatusCode() != specs.StatusCodeOK {
+				t.Fatalf("unexpected status code: %d", resp.StatusCode())
+			}
+			if got := resp.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("unexpected content type: %s", got)
+			}
+			if string(body) != tt.body {
+				t.Errorf("unexpected body: %q", body)
+			}
+			if resp.Header().Get("ETag") == "" || resp.Header().Get("Last-Modified") != testModTime.Format(specs.TimeFormat) {
+				t.Errorf("unexpected validators: %+v", resp.Header())
+			}
+		})
+	}
+}
+
+func TestFileServer_PercentInName(t *testing.T) {
+	fh := FileServer(newTestFS())
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{path: "/100%25.txt", body: "percent"},
+		{path: "/a%2520b.txt", body: "escaped percent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, body := serveTestFile(t, fh, specs.HttpMethodGet, tt.path, nil)
+			if resp.StatusCode() != specs.StatusCodeOK || string(body) != tt.body {
+				t.Errorf("unexpected response: %d %q", resp.StatusCode(), body)
+			}
+		})
+	}
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go plow.DefaultServer(fh).Serve(listener)
+
+	for _, tt := range tests {
+		t.Run("Server"+tt.path, func(t *testing.T) {
+			resp, err := http.Get("http://" + listener.Addr().String() + tt.path)
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || string(body) != tt.body {
+				t.Errorf("unexpected response: %d %q", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestFileServer_Head(t *testing.T) {
+	resp, body := serveTestFile(t, FileServer(newTestFS()), specs.HttpMethodHead, "/data.txt", nil)
+	if resp.StatusCode() != specs.StatusCodeOK || resp.Header().Get("Content-Length") != "16" || len(body) != 0 {
+		t.Errorf("unexpected response: %d %+v %q", resp.StatusCode(), resp.Header(), body)
+	}
+}
+
+func TestFileServer_NotFoundAndTraversal(t *testing.T) {
+	fh := FileServer(newTestFS())
+
+	tests := []struct {
+		path string
+		code specs.StatusCode
+	}{
+		{path: "/missing.txt", code: specs.StatusCodeNotFound},
+		{path: "/docs/", code: specs.StatusCodeNotFound},
+		{path: "/../data.txt", code: specs.StatusCodeBadRequest},
+		{path: "/docs/%2e%2e/data.txt", code: specs.StatusCodeBadRequest},
+		{path: "/docs/..%5cdata.txt", code: specs.StatusCodeBadRequest},
+		{path: "/data.txt%00", code: specs.StatusCodeBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, _ := serveTestFile(t, fh, specs.HttpMethodGet, tt.path, nil)
+			if resp.StatusCode() != tt.code {
+				t.Errorf("unexpected status code: %d, want %d", resp.StatusCode(), tt.code)
+			}
+		})
+	}
+
+	resp, _ := serveTestFile(t, fh, specs.HttpMethodPost, "/data.txt", nil)
+	if resp.StatusCode() != specs.StatusCodeMethodNotAllowed || resp.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("unexpected response: %d %+v", resp.StatusCode(), resp.Header())
+	}
+}
+
+func TestFileServer_Directory(t *testing.T) {
+	fh := FileServer(newTestFS())
+	fh.DirectoryListing = true
+
+	resp, _ := serveTestFile(t, fh, specs.HttpMethodGet, "/docs", nil)
+	if resp.StatusCode() != specs.StatusCodeMovedPermanently || resp.Header().Get("Location") != "./docs/" {
+		t.Errorf("unexpected redirect: %d %+v", resp.StatusCode(), resp.Header())
+	}
+
+	resp, body := serveTestFile(t, fh, specs.HttpMethodGet, "/docs/", nil)
+	if resp.StatusCode() != specs.StatusCodeOK {
+		t.Fatalf("unexpected status code: %d", resp.StatusCode())
+	}
+	for _, want := range []string{`<a href="readme.md">readme.md</a>`, `<a href="%3Cscript%3E.txt">&lt;script&gt;.txt</a>`} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("listing does not contain %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestFileServer_DirectoryRedirectToHost(t *testing.T) {
+	fh := FileServer(fstest.MapFS{
+		"evil.example/index.html": {Data: []byte("<h1>index</h1>"), ModTime: testModTime},
+		"a\nb/index.html":         {Data: []byte("<h1>index</h1>"), ModTime: testModTime},
+	})
+
+	for path, want := range map[string]string{
+		"//evil.example": "./evil.example/",
+		"/a\nb":          "./a%0Ab/",
+	} {
+		req := mock.DefaultRequest().Url(&specs.Url{Path: path}).Request()
+		resp := fh.Handle(context.Background(), req)
+		if resp.StatusCode() != specs.StatusCodeMovedPermanently || resp.Header().Get("Location") != want {
+			t.Errorf("unexpected redirect of %q: %d %+v", path, resp.StatusCode(), resp.Header())
+		}
+	}
+}
+
+func TestFileServer_WildcardRoute(t *testing.T) {
+	mx := New()
+	mx.Route(specs.HttpMethodGet, "/static/{*}", FileServer(newTestFS()))
+
+	req := mock.DefaultRequest().Url(specs.MustParseUrl("/static/docs/readme.md")).Request()
+	resp := mx.Handle(context.Background(), req)
+
+	var body bytes.Buffer
+	resp.(plow.BodyWriter).WriteBody(&body)
+	if resp.StatusCode() != specs.StatusCodeOK || body.String() != "# readme" {
+		t.Errorf("unexpected response: %d %q", resp.StatusCode(), body.String())
+	}
+}
+
+func TestFileServer_Conditional(t *testing.T) {
+	fh := FileServer(newTestFS())
+	resp, _ := serveTestFile(t, fh, specs.HttpMethodGet, "/data.txt", nil)
+	etag := resp.Header().Get("ETag")
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		code   specs.StatusCode
+	}{
+		{name: "If-None-Match", header: map[string]string{"If-None-Match": etag}, code: specs.StatusCodeNotModified},
+		{name: "If-None-Match weak", header: map[string]string{"If-None-Match": `"other", W/` + etag}, code: specs.StatusCodeNotModified},
+		{name: "If-None-Match mismatch", header: map[string]string{"If-None-Match": `"other"`}, code: specs.StatusCodeOK},
+		{name: "If-Modified-Since", header: map[string]string{"If-Modified-Since": testModTime.Format(specs.TimeFormat)}, code: specs.StatusCodeNotModified},
+		{name: "If-Modified-Since older", header: map[string]string{"If-Modified-Since": testModTime.Add(-time.Hour).Format(specs.TimeFormat)}, code: specs.StatusCodeOK},
+		{
+			name:   "If-None-Match takes precedence",
+			header: map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": testModTime.Format(specs.TimeFormat)},
+			code:   specs.StatusCodeOK,
+		},
+		{name: "If-Match mismatch", header: map[string]string{"If-Match": `"other"`}, code: specs.StatusCodePreconditionFailed},
+		{name: "If-Unmodified-Since older", header: map[string]string{"If-Unmodified-Since": testModTime.Add(-time.Hour).Format(specs.TimeFormat)}, code: specs.StatusCodePreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := serveTestFile(t, fh, specs.HttpMethodGet, "/data.txt", func(header *specs.Header) {
+				for name, value := range tt.header {
+					header.Set(name, value)
+				}
+			})
+			if resp.StatusCode() != tt.code {
+				t.Errorf("unexpected status code: %d, want %d", resp.StatusCode(), tt.code)
+			}
+			if tt.code == specs.StatusCodeNotModified && (len(body) != 0 || resp.Header().Get("ETag") != etag) {
+				t.Errorf("unexpected not modified response: %+v %q", resp.Header(), body)
+			}
+		})
+	}
+}
+
+func TestFileServer_Range(t *testing.T) {
+	fh := FileServer(newTestFS())
+	resp, _ := serveTestFile(t, fh, specs.HttpMethodGet, "/data.txt", nil)
+	etag := resp.Header().Get("ETag")
+
+	tests := []struct {
+		name         string
+		header       map[string]string
+		code         specs.StatusCode
+		contentRange string
+		body         string
+	}{
+		{name: "first-last", header: map[string]string{"Range": "bytes=2-5"}, code: specs.StatusCodePartialContent, contentRange: "bytes 2-5/16", body: "2345"},
+		{name: "open end", header: map[string]string{"Range": "bytes=10-"}, code: specs.StatusCodePartialContent, contentRange: "bytes 10-15/16", body: "abcdef"},
+		{name: "suffix", header: map[string]string{"Range": "bytes=-3"}, code: specs.StatusCodePartialContent, contentRange: "bytes 13-15/16", body: "def"},
+		{name: "end beyond size", header: map[string]string{"Range": "bytes=14-100"}, code: specs.StatusCodePartialContent, contentRange: "bytes 14-15/16", body: "ef"},
+		{name: "not satisfiable", header: map[string]string{"Range": "bytes=20-30"}, code: specs.StatusCodeRequestedRangeNotSatisfiable, contentRange: "bytes */16"},
+		{name: "invalid ignored", header: map[string]string{"Range": "bytes=5-2"}, code: specs.StatusCodeOK, body: "0123456789abcdef"},
+		{name: "If-Range matches", header: map[string]string{"Range": "bytes=0-1", "If-Range": etag}, code: specs.StatusCodePartialContent, contentRange: "bytes 0-1/16", body: "01"},
+		{name: "If-Range mismatch", header: map[string]string{"Range": "bytes=0-1", "If-Range": `"other"`}, code: specs.StatusCodeOK, body: "0123456789abcdef"},
+		{
+			name:         "If-Range date",
+			header:       map[string]string{"Range": "bytes=0-1", "If-Range": testModTime.Format(specs.TimeFormat)},
+			code:         specs.StatusCodePartialContent,
+			contentRange: "bytes 0-1/16",
+			body:         "01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := serveTestFile(t, fh, specs.HttpMethodGet, "/data.txt", func(header *specs.Header) {
+				for name, value := range tt.header {
+					header.Set(name, value)
+				}
+			})
+			if resp.StatusCode() != tt.code {
+				t.Errorf("unexpected status code: %d, want %d", resp.StatusCode(), tt.code)
+			}
+			if got := resp.Header().Get("Content-Range"); got != tt.contentRange {
+				t.Errorf("unexpected content range: %q, want %q", got, tt.contentRange)
+			}
+			if string(body) != tt.body {
+				t.Errorf("unexpected body: %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestFileServer_MultiRange(t *testing.T) {
+	resp, body := serveTestFile(t, FileServer(newTestFS()), specs.HttpMethodGet, "/data.txt", func(header *specs.Header) {
+		header.Set("Range", "bytes=0-1, 10-")
+	})
+	if resp.StatusCode() != specs.StatusCodePartialContent {
+		t.Fatalf("unexpected status code: %d", resp.StatusCode())
+	}
+	if got := resp.(plow.BodyWriter).ContentLength(); got != int64(len(body)) {
+		t.Errorf("content length %d mismatch body size %d", got, len(body))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("unexpected content type: %s", resp.Header().Get("Content-Type"))
+	}
+
+	expected := []struct{ contentRange, body string }{
+		{"bytes 0-1/16", "01"},
+		{"bytes 10-15/16", "abcdef"},
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for _, want := range expected {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatal("next part:", err)
+		}
+		data, _ := io.ReadAll(part)
+		if part.Header.Get("Content-Range") != want.contentRange || string(data) != want.body {
+			t.Errorf("unexpected part: %+v %q", part.Header, data)
+		}
+	}
+	if _, err = reader.NextPart(); err != io.EOF {
+		t.Errorf("expected end of parts, got %v", err)
+	}
+}
+
+func TestFileServer_Precompressed(t *testing.T) {
+	fh := FileServer(newTestFS())
+
+	tests := []struct {
+		acceptEncoding  string
+		contentEncoding string
+		body            string
+	}{
+		{acceptEncoding: "gzip, br", contentEncoding: "br", body: "brotli-content"},
+		{acceptEncoding: "gzip", contentEncoding: "gzip", body: "gzip-content"},
+		{acceptEncoding: "br;q=0, gzip", contentEncoding: "gzip", body: "gzip-content"},
+		{acceptEncoding: "gzip;q=0.5, identity", contentEncoding: "", body: "console.log('plain')"},
+		{acceptEncoding: "", contentEncoding: "", body: "console.log('plain')"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			resp, body := serveTestFile(t, fh, specs.HttpMethodGet, "/app.js", func(header *specs.Header) {
+				if tt.acceptEncoding != "" {
+					header.Set("Accept-Encoding", tt.acceptEncoding)
+				}
+			})
+			if got := resp.Header().Get("Content-Encoding"); got != tt.contentEncoding {
+				t.Errorf("unexpected content encoding: %q", got)
+			}
+			if got := resp.Header().Get("Content-Type"); got != "text/javascript; charset=utf-8" {
+				t.Errorf("unexpected content type: %q", got)
+			}
+			if resp.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("expected Vary header: %+v", resp.Header())
+			}
+			if string(body) != tt.body {
+				t.Errorf("unexpected body: %q", body)
+			}
+		})
+	}
+}
+
+func TestFileServer_ByHttpClient(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go plow.DefaultServer(FileServer(newTestFS())).Serve(listener)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+listener.Addr().String()+"/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-3")
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent ||
+		resp.Header.Get("Content-Encoding") != "gzip" ||
+		resp.Header.Get("Content-Range") != "bytes 0-3/12" ||
+		string(body) != "gzip" {
+		t.Errorf("unexpected response: %d %+v %q", resp.StatusCode, resp.Header, body)
+	}
+}
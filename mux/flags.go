@@ -0,0 +1,111 @@
+package mux
+
+import (
+	"context"
+	"time"
+
+	"github.com/oesand/plow"
+	"github.com/oesand/plow/specs"
+)
+
+// BodyDecoding is a route flag which overrides whether the request body
+// is decoded by the "Content-Encoding" header, see [plow.BodyDecoder].
+type BodyDecoding bool
+
+const (
+	// DecodeBody flag decodes the request body of the route
+	// even if decoding is disabled by the server.
+	DecodeBody BodyDecoding = true
+
+	// RawBody flag passes the request body of the route as is,
+	// for example to proxy it or to store it still compressed.
+	RawBody BodyDecoding = false
+)
+
+// applyBodyDecoding applies the last [BodyDecoding] flag of the route to the request,
+// it returns the response if the request body cannot be decoded.
+func applyBodyDecoding(route Route, request plow.Request) plow.Response {
+	decoder, ok := request.(plow.BodyDecoder)
+	if !ok {
+		return nil
+	}
+
+	var flag BodyDecoding
+	var found bool
+	for flag = range FlagsOfType[BodyDecoding](route) {
+		found = true
+	}
+	if !found {
+		return nil
+	}
+
+	if err := decoder.DecodeBody(bool(flag)); err != nil {
+		return plow.TextResponse(specs.StatusCodeUnsupportedMediaType, specs.ContentTypePlain,
+			"Unsupported Content-Encoding "+request.Header().Get("Content-Encoding"))
+	}
+	return nil
+}
+
+// BodyLimit is a route flag which overrides the maximum size in bytes
+// of the request body, see [plow.BodyLimiter].
+//
+// For example, uploads may need a larger limit than the server default.
+// If the limit is zero or negative the body is unlimited.
+//
+// The server checks the declared length of the body against the flag
+// before middlewares and the handler run, see [plow.BodyLimitProvider].
+type BodyLimit int64
+
+// applyBodyLimit applies the last [BodyLimit] flag of the route to the request.
+func applyBodyLimit(route Route, request plow.Request) {
+	limiter, ok := request.(plow.BodyLimiter)
+	if !ok {
+		return
+	}
+
+	var limit BodyLimit
+	var found bool
+	for limit = range FlagsOfType[BodyLimit](route) {
+		found = true
+	}
+	if found {
+		limiter.LimitBody(int64(limit))
+	}
+}
+
+// ReadTimeout is a route flag which sets the deadline for reading the request body
+// to the timeout from the time the route is matched, see [plow.RequestController].
+//
+// For example, uploads may need more time than [plow.Server.ReadTimeout].
+// If the timeout is zero or negative there is no deadline.
+type ReadTimeout time.Duration
+
+// WriteTimeout is a route flag which sets the deadline for writing the response
+// to the timeout from the time the route is matched, see [plow.RequestController].
+//
+// For example, large downloads may need more time than [plow.Server.WriteTimeout].
+// If the timeout is zero or negative there is no deadline.
+type WriteTimeout time.Duration
+
+// applyDeadlines applies the last [ReadTimeout] and [WriteTimeout] flags of the route
+// to the connection of the request.
+func applyDeadlines(ctx context.Context, route Route) {
+	controller := plow.RequestControllerFromContext(ctx)
+	if controller == nil {
+		return
+	}
+
+	for timeout := range FlagsOfType[ReadTimeout](route) {
+		controller.SetReadDeadline(deadlineAfter(time.Duration(timeout)))
+	}
+	for timeout := range FlagsOfType[WriteTimeout](route) {
+		controller.SetWriteDeadline(deadlineAfter(time.Duration(timeout)))
+	}
+}
+
+func deadlineAfter(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
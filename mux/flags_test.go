@@ -0,0 +1,265 @@
+package mux
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oesand/plow"
+	"github.com/oesand/plow/mock"
+	"github.com/oesand/plow/specs"
+)
+
+type flagsRequest struct {
+	plow.Request
+	supported bool
+	calls     []bool
+	limits    []int64
+}
+
+func (r *flagsRequest) DecodeBody(enabled bool) error {
+	if enabled && !r.supported {
+		return specs.ErrUnknownContentEncoding
+	}
+	r.calls = append(r.calls, enabled)
+	return nil
+}
+
+func (r *flagsRequest) LimitBody(size int64) {
+	r.limits = append(r.limits, size)
+}
+
+func TestMux_BodyDecoding(t *testing.T) {
+	okHandler := plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+		return plow.EmptyResponse(specs.StatusCodeOK)
+	})
+
+	mx := New().
+		Route(specs.HttpMethodPost, "/default", okHandler).
+		Route(specs.HttpMethodPost, "/raw", okHandler, RawBody).
+		Route(specs.HttpMethodPost, "/decode", okHandler, DecodeBody)
+
+	tests := []struct {
+		name      string
+		path      string
+		supported bool
+		code      specs.StatusCode
+		calls     []bool
+	}{
+		{name: "Default", path: "/default", supported: true, code: specs.StatusCodeOK},
+		{name: "Raw", path: "/raw", supported: true, code: specs.StatusCodeOK, calls: []bool{false}},
+		{name: "RawUnsupported", path: "/raw", code: specs.StatusCodeOK, calls: []bool{false}},
+		{name: "Decode", path: "/decode", supported: true, code: specs.StatusCodeOK, calls: []bool{true}},
+		{name: "DecodeUnsupported", path: "/decode", code: specs.StatusCodeUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &flagsRequest{
+				Request: mock.DefaultRequest().
+					Method(specs.HttpMethodPost).
+					Url(specs.MustParseUrl(tt.path)).
+					Request(),
+				supported: tt.supported,
+			}
+
+			resp := mx.Handle(context.Background(), request)
+			if resp.StatusCode() != tt.code {
+				t.Fatalf("unexpected status code: %d, want %d", resp.StatusCode(), tt.code)
+			}
+			if !slices.Equal(request.calls, tt.calls) {
+				t.Errorf("unexpected DecodeBody calls: %v, want %v", request.calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestMux_BodyDecodingServer(t *testing.T) {
+	handler := plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+		body, err := io.ReadAll(request.Body())
+		if err != nil {
+			return plow.TextResponse(specs.StatusCodeBadRequest, specs.ContentTypePlain, err.Error())
+		}
+		return plow.TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, string(body))
+	})
+	mx := New().
+		Route(specs.HttpMethodPost, "/raw", handler, RawBody).
+		Route(specs.HttpMethodPost, "/", handler)
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go plow.DefaultServer(mx).Serve(listener)
+
+	for _, tt := range []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/raw", http.StatusOK, "zstd-frame"},
+		{"/", http.StatusUnsupportedMediaType, ""},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "http://"+listener.Addr().String()+tt.path, strings.NewReader("zstd-frame"))
+			req.Header.Set("Content-Encoding", "zstd")
+
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.code || (tt.body != "" && string(body) != tt.body) {
+				t.Errorf("unexpected response: %d %q", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestMux_BodyLimit(t *testing.T) {
+	okHandler := plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+		return plow.EmptyResponse(specs.StatusCodeOK)
+	})
+
+	mx := New().
+		Route(specs.HttpMethodPost, "/json", okHandler).
+		Route(specs.HttpMethodPost, "/upload", okHandler, BodyLimit(64<<20)).
+		Route(specs.HttpMethodPost, "/stream", okHandler, BodyLimit(1<<20), BodyLimit(0))
+
+	tests := []struct {
+		path   string
+		limits []int64
+	}{
+		{path: "/json"},
+		{path: "/upload", limits: []int64{64 << 20}},
+		{path: "/stream", limits: []int64{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			request := &flagsRequest{
+				Request: mock.DefaultRequest().
+					Method(specs.HttpMethodPost).
+					Url(specs.MustParseUrl(tt.path)).
+					Request(),
+			}
+
+			mx.Handle(context.Background(), request)
+			if !slices.Equal(request.limits, tt.limits) {
+				t.Errorf("unexpected LimitBody calls: %v, want %v", request.limits, tt.limits)
+			}
+		})
+	}
+}
+
+func TestMux_BodyLimitServer(t *testing.T) {
+	var called atomic.Int32
+	handler := plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+		called.Add(1)
+		body, err := io.ReadAll(request.Body())
+		if err != nil {
+			return plow.TextResponse(specs.StatusCodeBadRequest, specs.ContentTypePlain, err.Error())
+		}
+		return plow.TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, string(body))
+	})
+	mx := New().
+		Use(func(ctx context.Context, request plow.Request, next NextFunc) plow.Response {
+			called.Add(1)
+			return next(ctx)
+		}).
+		Route(specs.HttpMethodPost, "/upload", handler, BodyLimit(1<<10)).
+		Route(specs.HttpMethodPost, "/", handler)
+
+	server := plow.DefaultServer(mx)
+	server.MaxBodySize = 16
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	body := strings.Repeat("upload ", 16)
+	for _, tt := range []struct {
+		path   string
+		code   int
+		called int32
+	}{
+		{"/upload", http.StatusOK, 2},
+		{"/", http.StatusRequestEntityTooLarge, 0},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			called.Store(0)
+
+			resp, err := http.Post("http://"+listener.Addr().String()+tt.path, "text/plain", strings.NewReader(body))
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.code {
+				t.Errorf("unexpected status code: %d, want %d", resp.StatusCode, tt.code)
+			}
+			if got := called.Load(); got != tt.called {
+				t.Errorf("unexpected calls of middleware and handler: %d, want %d", got, tt.called)
+			}
+		})
+	}
+}
+
+func TestMux_Deadlines(t *testing.T) {
+	handler := plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+		if _, err := io.ReadAll(request.Body()); err != nil {
+			return plow.EmptyResponse(specs.StatusCodeRequestTimeout)
+		}
+		return plow.EmptyResponse(specs.StatusCodeOK)
+	})
+	mx := New().
+		Route(specs.HttpMethodPost, "/upload", handler, ReadTimeout(2*time.Second)).
+		Route(specs.HttpMethodPost, "/", handler)
+
+	server := plow.DefaultServer(mx)
+	server.ReadTimeout = 200 * time.Millisecond
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	for _, tt := range []struct {
+		path string
+		code int
+	}{
+		{"/upload", 200},
+		{"/", 408},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			conn, err := net.Dial("tcp4", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			conn.Write([]byte("POST " + tt.path + " HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\nConnection: close\r\n\r\n"))
+			time.Sleep(400 * time.Millisecond)
+			conn.Write([]byte("body"))
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal("read response:", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.code {
+				t.Errorf("expected status %d, got %d", tt.code, resp.StatusCode)
+			}
+		})
+	}
+}
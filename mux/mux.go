@@ -100,48 +100,93 @@ func (mx *mux) Routes() iter.Seq[MuxRoute] {
 }
 
 func (mx *mux) Handle(ctx context.Context, request plow.Request) plow.Response {
+	// The middlewares may run the next handlers in another goroutine,
+	// so the lock is held only while the state is read
 	mx.mu.RLock()
-	defer mx.mu.RUnlock()
-
-	if len(mx.middlewares) > 0 {
-		nextMd, stop := iter.Pull(slices.Values(mx.middlewares))
-		defer stop()
-
-		var nextFunc NextFunc
-		nextFunc = func(ctx context.Context) plow.Response {
-			if md, ok := nextMd(); ok {
-				return md(ctx, request, nextFunc)
+	middlewares := mx.middlewares
+	mx.mu.RUnlock()
+
+	if len(middlewares) > 0 {
+		var nextFunc func(i int) NextFunc
+		nextFunc = func(i int) NextFunc {
+			return func(ctx context.Context) plow.Response {
+				if i < len(middlewares) {
+					return middlewares[i](ctx, request, nextFunc(i+1))
+				}
+				return mx.handle(ctx, request)
 			}
-			return mx.handle(ctx, request)
 		}
 
-		return nextFunc(ctx)
+		return nextFunc(0)(ctx)
 	}
 
 	return mx.handle(ctx, request)
 }
 
+// BodyLimit implements the [plow.BodyLimitProvider] interface,
+// it returns the last [BodyLimit] flag of the matched route.
+func (mx *mux) BodyLimit(request plow.Request) (int64, bool) {
+	mx.mu.RLock()
+	defer mx.mu.RUnlock()
+
+	for _, rt := range mx.routes[request.Method()] {
+		if ok, _ := rt.Match(request.Url().Path); !ok {
+			continue
+		}
+
+		var limit BodyLimit
+		var found bool
+		for limit = range FlagsOfType[BodyLimit](rt) {
+			found = true
+		}
+		if found {
+			return int64(limit), true
+		}
+		if provider, ok := rt.Handler().(plow.BodyLimitProvider); ok {
+			return provider.BodyLimit(request)
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
 func (mx *mux) handle(ctx context.Context, request plow.Request) plow.Response {
-	if mx.routes != nil {
-		url := request.Url()
-		routes := mx.routes[request.Method()]
-		for _, rt := range routes {
-			if ok, params := rt.Match(url.Path); ok {
-				for key, value := range params {
-					if url.Query == nil {
-						url.Query = make(specs.Query)
-					}
-					url.Query[key] = value
-				}
-				return rt.Handler().Handle(ctx, request)
+	url := request.Url()
+	rt, params, notFoundHandler := mx.match(request.Method(), url.Path)
+	if rt != nil {
+		for key, value := range params {
+			if url.Query == nil {
+				url.Query = make(specs.Query)
 			}
+			url.Query[key] = value
 		}
+		if resp := applyCertIdentities(ctx, rt); resp != nil {
+			return resp
+		}
+		applyDeadlines(ctx, rt)
+		applyBodyLimit(rt, request)
+		if resp := applyBodyDecoding(rt, request); resp != nil {
+			return resp
+		}
+		return rt.Handler().Handle(ctx, request)
 	}
 
-	if handler := mx.notFoundHandler; handler != nil {
+	if handler := notFoundHandler; handler != nil {
 		return handler.Handle(ctx, request)
 	}
 
 	return plow.TextResponse(specs.StatusCodeNotFound, specs.ContentTypePlain,
 		fmt.Sprintf("Not Found %s", request.Url().Path))
 }
+
+func (mx *mux) match(method specs.HttpMethod, path string) (*route, iter.Seq2[string, string], plow.Handler) {
+	mx.mu.RLock()
+	defer mx.mu.RUnlock()
+
+	for _, rt := range mx.routes[method] {
+		if ok, params := rt.Match(path); ok {
+			return rt, params, nil
+		}
+	}
+	return nil, nil, mx.notFoundHandler
+}
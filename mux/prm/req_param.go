@@ -2,6 +2,7 @@ package prm
 
 import (
 	"context"
+	"net"
 
 	"github.com/oesand/plow"
 )
@@ -17,3 +18,20 @@ type requestParameter struct{}
 func (rp *requestParameter) GetParamValue(_ context.Context, req plow.Request) (plow.Request, plow.Response) {
 	return req, nil
 }
+
+// ClientIPParam creates a new ParameterProvider for extracting the client IP of the request.
+// Behind trusted proxies it is the resolved client address, see plow.Server.TrustedProxies.
+// This is useful for rate limiting and audit logs.
+func ClientIPParam() ParameterProvider[net.IP] {
+	return &clientIPParameter{}
+}
+
+type clientIPParameter struct{}
+
+func (cp *clientIPParameter) GetParamValue(_ context.Context, req plow.Request) (net.IP, plow.Response) {
+	ip := plow.ClientIP(req)
+	if ip == nil {
+		return nil, ErrorResponse("client ip is unknown")
+	}
+	return ip, nil
+}
@@ -0,0 +1,44 @@
+package prm
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/oesand/plow/mock"
+)
+
+func TestClientIPParam(t *testing.T) {
+	tests := []struct {
+		name         string
+		network      string
+		domain       string
+		expectedIP   net.IP
+		expectedResp bool
+	}{
+		{"ipv4", "tcp", "192.0.2.1", net.ParseIP("192.0.2.1"), false},
+		{"ipv6", "tcp", "2001:db8::1", net.ParseIP("2001:db8::1"), false},
+		{"unix socket", "unix", "/tmp/plow.sock", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mock.DefaultRequest().
+				Addr(tt.network, tt.domain, 4711).
+				Request()
+
+			param := ClientIPParam()
+			value, resp := param.GetParamValue(context.Background(), req)
+
+			if tt.expectedResp && resp == nil {
+				t.Error("expected response, got nil")
+			}
+			if !tt.expectedResp && resp != nil {
+				t.Errorf("expected no response, got %v", resp)
+			}
+			if !value.Equal(tt.expectedIP) {
+				t.Errorf("expected %v, got %v", tt.expectedIP, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package mux
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/oesand/plow"
+	"github.com/oesand/plow/specs"
+)
+
+// Timeout creates a [Middleware] which cancels the context of the next handlers
+// after the timeout and responds 503 "Service Unavailable" instead of their response.
+//
+// The next handlers run in their own goroutine, so the 503 response is sent on time
+// even if they do not respect the context cancellation, pending reads of the request body
+// are failed by the timeout. The request is held by [plow.RequestController.Hold] until they return,
+// so the connection is closed once they return, and their response or panic is discarded.
+// They must not hijack the connection after the timeout.
+func Timeout(timeout time.Duration) Middleware {
+	if timeout <= 0 {
+		panic("plow: timeout must be positive")
+	}
+
+	return func(ctx context.Context, request plow.Request, next NextFunc) plow.Response {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+
+		stop := func() bool { return false }
+		release := func() {}
+		if controller := plow.RequestControllerFromContext(ctx); controller != nil {
+			stop = context.AfterFunc(ctx, func() {
+				controller.SetReadDeadline(time.Now())
+			})
+			release = controller.Hold()
+		}
+
+		var resp plow.Response
+		var panicErr any
+		var timedOut bool
+		finished := make(chan struct{})
+		go func() {
+			defer close(finished)
+			defer release()
+			defer func() {
+				panicErr = recover()
+				timedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+				stop()
+				cancel()
+			}()
+
+			resp = next(ctx)
+		}()
+
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			// The handlers are left running only on the timeout
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return responseHandlerTimeout()
+			}
+			<-finished
+		}
+
+		if panicErr != nil {
+			panic(panicErr)
+		}
+		if timedOut {
+			return responseHandlerTimeout()
+		}
+		return resp
+	}
+}
+
+func responseHandlerTimeout() plow.Response {
+	return plow.TextResponse(specs.StatusCodeServiceUnavailable, specs.ContentTypePlain, "Handler timeout",
+		func(resp plow.Response) {
+			resp.Header().Set("Connection", "close")
+		})
+}
@@ -0,0 +1,160 @@
+package mux
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/oesand/plow"
+	"github.com/oesand/plow/mock"
+	"github.com/oesand/plow/specs"
+)
+
+func TestMux_Timeout(t *testing.T) {
+	mx := New().
+		Use(Timeout(50*time.Millisecond)).
+		Route(specs.HttpMethodGet, "/fast", plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+			return plow.EmptyResponse(specs.StatusCodeOK)
+		})).
+		Route(specs.HttpMethodGet, "/slow", plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+			<-ctx.Done()
+			return plow.EmptyResponse(specs.StatusCodeOK)
+		}))
+
+	resp := mx.Handle(context.Background(), mock.DefaultRequest().Url(specs.MustParseUrl("/fast")).Request())
+	if resp.StatusCode() != specs.StatusCodeOK {
+		t.Errorf("expected 200, got %d", resp.StatusCode())
+	}
+
+	resp = mx.Handle(context.Background(), mock.DefaultRequest().Url(specs.MustParseUrl("/slow")).Request())
+	if resp.StatusCode() != specs.StatusCodeServiceUnavailable {
+		t.Errorf("expected 503, got %d", resp.StatusCode())
+	}
+	if resp.Header().Get("Connection") != "close" {
+		t.Error("expected connection to be closed")
+	}
+}
+
+func TestMux_TimeoutPendingBody(t *testing.T) {
+	mx := New().
+		Use(Timeout(100*time.Millisecond)).
+		Route(specs.HttpMethodPost, "/", plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+			io.ReadAll(request.Body())
+			return plow.EmptyResponse(specs.StatusCodeOK)
+		}))
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go plow.DefaultServer(mx).Serve(listener)
+
+	conn, err := net.Dial("tcp4", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The body is never sent, so the handler is blocked reading it
+	conn.Write([]byte("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\n\r\n"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("read response:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 || !resp.Close {
+		t.Errorf("expected 503 closing connection, got %d", resp.StatusCode)
+	}
+}
+
+func TestMux_TimeoutWithMinReadRate(t *testing.T) {
+	mx := New().
+		Use(Timeout(100*time.Millisecond)).
+		Route(specs.HttpMethodPost, "/", plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+			io.ReadAll(request.Body())
+			return plow.EmptyResponse(specs.StatusCodeOK)
+		}))
+
+	// The rate limits the pending read by the earlier deadline than ReadTimeout,
+	// the timeout of the middleware must not be taken for the slow client
+	server := plow.DefaultServer(mx)
+	server.ReadTimeout = 10 * time.Second
+	server.MinReadRate = 1024
+	server.MinReadRateGrace = 2 * time.Second
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	conn, err := net.Dial("tcp4", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\n\r\n"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("read response:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 || !resp.Close {
+		t.Errorf("expected 503 closing connection, got %d", resp.StatusCode)
+	}
+}
+
+func TestMux_TimeoutIgnoredByHandler(t *testing.T) {
+	handled := make(chan string, 1)
+	mx := New().
+		Use(Timeout(50*time.Millisecond)).
+		Route(specs.HttpMethodGet, "/", plow.HandlerFunc(func(ctx context.Context, request plow.Request) plow.Response {
+			// The handler does not respect the context
+			time.Sleep(300 * time.Millisecond)
+			handled <- request.Header().Get("X-Id")
+			return plow.EmptyResponse(specs.StatusCodeOK)
+		}))
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go plow.DefaultServer(mx).Serve(listener)
+
+	conn, err := net.Dial("tcp4", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nX-Id: abc\r\n\r\n"))
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("read response:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 || !resp.Close {
+		t.Errorf("expected 503 closing connection, got %d", resp.StatusCode)
+	}
+
+	// The request is not released while the handler is running
+	select {
+	case id := <-handled:
+		if id != "abc" {
+			t.Errorf("unexpected request header after the timeout: %q", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler is not finished")
+	}
+}
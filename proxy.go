@@ -0,0 +1,153 @@
+package plow
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oesand/plow/internal/proxy"
+	"github.com/oesand/plow/specs"
+)
+
+// ProxyFromEnvironment returns a proxy function (for use in a [Transport])
+// that selects proxy by the environment variables
+// HTTP_PROXY, HTTPS_PROXY, ALL_PROXY and NO_PROXY
+// (or the lowercase versions thereof), variables are read once on call.
+//
+// HTTPS_PROXY takes precedence over ALL_PROXY for https requests
+// and HTTP_PROXY takes precedence over ALL_PROXY for http requests.
+// Proxy urls may have "http", "https", "socks5" and "socks5h" schemes,
+// if the scheme is empty, "http" is assumed.
+//
+// NO_PROXY is a comma or space separated list of hosts that should
+// not be proxied, supported entries are:
+//   - "*" - disables proxy for all hosts
+//   - "example.com" - the domain and its subdomains
+//   - ".example.com", "*.example.com" - only subdomains
+//   - "10.0.0.1", "::1" - IP addresses
+//   - "10.0.0.0/8" - CIDR ranges
+//
+// Any entry except CIDR may be suffixed with ":port" to bypass only that port.
+func ProxyFromEnvironment() func(*specs.Url) (*specs.Url, error) {
+	return proxyFromEnv(os.Getenv)
+}
+
+func proxyFromEnv(getenv func(string) string) func(*specs.Url) (*specs.Url, error) {
+	lookup := func(name string) string {
+		if value := getenv(name); value != "" {
+			return value
+		}
+		return getenv(strings.ToLower(name))
+	}
+
+	var httpProxy, httpsProxy, allProxy *specs.Url
+	for _, env := range []struct {
+		name string
+		dest **specs.Url
+	}{
+		{"HTTP_PROXY", &httpProxy},
+		{"HTTPS_PROXY", &httpsProxy},
+		{"ALL_PROXY", &allProxy},
+	} {
+		url, err := parseEnvProxyUrl(env.name, lookup(env.name))
+		if err != nil {
+			return func(*specs.Url) (*specs.Url, error) {
+				return nil, err
+			}
+		}
+		*env.dest = url
+	}
+
+	if httpProxy == nil {
+		httpProxy = allProxy
+	}
+	if httpsProxy == nil {
+		httpsProxy = allProxy
+	}
+	noProxy := proxy.ParseHostPatterns(lookup("NO_PROXY"))
+
+	return func(url *specs.Url) (*specs.Url, error) {
+		if noProxy.Match(url.Host, url.Port) {
+			return nil, nil
+		}
+		if url.Scheme == "https" {
+			return cloneProxyUrl(httpsProxy), nil
+		}
+		return cloneProxyUrl(httpProxy), nil
+	}
+}
+
+func parseEnvProxyUrl(name, value string) (*specs.Url, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+
+	url, err := specs.ParseUrl(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url in %s: %w", name, err)
+	}
+	switch url.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme '%s' in %s", url.Scheme, name)
+	}
+	return url, nil
+}
+
+// ProxyRule maps hosts matched by Pattern to the Proxy
+// for use in [ProxyRules].
+type ProxyRule struct {
+	// Pattern comma or space separated list of host patterns
+	// in the same notation as NO_PROXY of [ProxyFromEnvironment].
+	Pattern string
+
+	// Proxy specifies the proxy url for matched hosts.
+	//
+	// If Proxy is nil, matched hosts are connected directly.
+	Proxy *specs.Url
+}
+
+// ProxyRules returns a proxy function (for use in a [Transport])
+// that selects the proxy of the first rule matching the request host.
+//
+// If no rule matches, fallback is used,
+// if fallback is nil, the request is connected directly.
+func ProxyRules(fallback func(*specs.Url) (*specs.Url, error), rules ...ProxyRule) func(*specs.Url) (*specs.Url, error) {
+	type compiledRule struct {
+		patterns proxy.HostPatterns
+		proxy    *specs.Url
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		patterns := proxy.ParseHostPatterns(rule.Pattern)
+		if len(patterns) == 0 {
+			panic(fmt.Sprintf("plow: invalid proxy rule pattern '%s'", rule.Pattern))
+		}
+		compiled = append(compiled, compiledRule{patterns, rule.Proxy})
+	}
+
+	return func(url *specs.Url) (*specs.Url, error) {
+		for _, rule := range compiled {
+			if rule.patterns.Match(url.Host, url.Port) {
+				return cloneProxyUrl(rule.proxy), nil
+			}
+		}
+		if fallback != nil {
+			return fallback(url)
+		}
+		return nil, nil
+	}
+}
+
+// cloneProxyUrl prevents shared url from being modified by [Transport]
+func cloneProxyUrl(url *specs.Url) *specs.Url {
+	if url == nil {
+		return nil
+	}
+	clone := *url
+	return &clone
+}
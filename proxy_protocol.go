@@ -0,0 +1,61 @@
+package plow
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"time"
+
+	"github.com/oesand/plow/internal"
+	"github.com/oesand/plow/internal/proxy"
+)
+
+// ProxyProtocolHeader is the PROXY protocol header sent by a TCP load balancer,
+// see [Server.ProxyProtocolTrusted].
+type ProxyProtocolHeader = proxy.ProtocolHeader
+
+// ProxyProtocolTLV is a type-length-value field of the PROXY protocol v2 header.
+type ProxyProtocolTLV = proxy.ProtocolTLV
+
+// Commands of the [ProxyProtocolHeader].
+const (
+	ProxyProtocolCommandLocal = proxy.ProtocolCommandLocal
+	ProxyProtocolCommandProxy = proxy.ProtocolCommandProxy
+)
+
+var proxyProtocolKey = internal.FlagKey{Key: "server.proxy.protocol.key"}
+
+// ProxyProtocolHeaderFromContext returns the PROXY protocol header received on the connection
+// of the request, or nil if the connection was not from the trusted load balancer.
+//
+// Used with the context passed to [Handler] by the [Server].
+func ProxyProtocolHeaderFromContext(ctx context.Context) *ProxyProtocolHeader {
+	header, _ := ctx.Value(proxyProtocolKey).(*ProxyProtocolHeader)
+	return header
+}
+
+// proxyHeaderTimeout limits reading of the PROXY protocol header
+// if the server has neither ReadHeaderTimeout nor ReadTimeout.
+const proxyHeaderTimeout = 5 * time.Second
+
+// readProxyHeader reads the PROXY protocol header from the connection,
+// the returned connection reports the addresses of the header.
+func (srv *Server) readProxyHeader(conn net.Conn) (net.Conn, *ProxyProtocolHeader, error) {
+	// The header is read before the connection is served,
+	// so it is always limited to not hold the connection slot forever
+	timeout := proxyHeaderTimeout
+	if srv.ReadHeaderTimeout > 0 {
+		timeout = srv.ReadHeaderTimeout
+	} else if srv.ReadTimeout > 0 {
+		timeout = srv.ReadTimeout
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	reader := bufio.NewReaderSize(conn, 256)
+	header, err := proxy.ReadProtocolHeader(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proxy.NewProtocolConn(conn, reader, header), header, nil
+}
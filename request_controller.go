@@ -0,0 +1,70 @@
+package plow
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oesand/plow/internal"
+	"github.com/oesand/plow/internal/server_ops"
+)
+
+var requestControllerKey = internal.FlagKey{Key: "server.request.controller.key"}
+
+// RequestControllerFromContext returns the [RequestController] of the request
+// being handled, or nil if the context is not passed by the [Server].
+func RequestControllerFromContext(ctx context.Context) *RequestController {
+	controller, _ := ctx.Value(requestControllerKey).(*RequestController)
+	return controller
+}
+
+// RequestController controls the connection of the request handled by the [Server],
+// for example to give an upload endpoint more time to read the body than [Server.ReadTimeout].
+//
+// Deadlines are reset by the server for each next request of the connection.
+// Methods are safe for concurrent use.
+type RequestController struct {
+	conn       net.Conn
+	rateReader *server_ops.MinRateReader
+	holds      sync.WaitGroup
+	held       atomic.Int32
+}
+
+// SetReadDeadline sets the deadline for reading the request body.
+// A zero value means no deadline.
+//
+// Setting the deadline in the past fails the pending and future body reads with a timeout error.
+func (rc *RequestController) SetReadDeadline(deadline time.Time) error {
+	if rc.rateReader != nil {
+		rc.rateReader.SetDeadline(deadline)
+		return nil
+	}
+	return rc.conn.SetReadDeadline(deadline)
+}
+
+// SetWriteDeadline sets the deadline for writing the response,
+// which is [Server.WriteTimeout] from the start of handling by default.
+// A zero value means no deadline.
+func (rc *RequestController) SetWriteDeadline(deadline time.Time) error {
+	return rc.conn.SetWriteDeadline(deadline)
+}
+
+// Hold keeps the request and the connection from being reused until release is called,
+// so the request can be used by the goroutine which runs after the handler returns.
+// The response is sent without waiting, but the next request of the connection
+// is not read and the connection is not closed until all holds are released.
+//
+// Hold must be called before the handler returns.
+func (rc *RequestController) Hold() (release func()) {
+	rc.held.Add(1)
+	rc.holds.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			rc.held.Add(-1)
+			rc.holds.Done()
+		})
+	}
+}
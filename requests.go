@@ -115,6 +115,9 @@ func (req *bufferRequest) ContentLength() int64 {
 //
 // if method unspecified then [specs.HttpMethodPost] will be set
 // if content type unspecified then [specs.ContentTypeRaw] will be set
+//
+// Request implements [TrailerWriter], so trailer fields
+// can be declared and set while the stream is copied.
 func StreamRequest(method specs.HttpMethod, url *specs.Url, contentType string, stream io.Reader, contentLength int64) ClientRequest {
 	if method == "" {
 		method = specs.HttpMethodPost
@@ -144,6 +147,7 @@ type streamRequest struct {
 	ClientRequest
 	stream        io.Reader
 	contentLength int64
+	trailer       *specs.Header
 }
 
 func (req *streamRequest) WriteBody(w io.Writer) error {
@@ -154,3 +158,10 @@ func (req *streamRequest) WriteBody(w io.Writer) error {
 func (req *streamRequest) ContentLength() int64 {
 	return req.contentLength
 }
+
+func (req *streamRequest) Trailer() *specs.Header {
+	if req.trailer == nil {
+		req.trailer = specs.NewHeader()
+	}
+	return req.trailer
+}
@@ -0,0 +1,107 @@
+package plow
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NetResolver returns a [Resolver] that looks up
+// addresses by the provided [net.Resolver].
+//
+// If resolver is nil, [net.DefaultResolver] is used.
+func NetResolver(resolver *net.Resolver) Resolver {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		return resolver.LookupIP(ctx, "ip", host)
+	})
+}
+
+// CachedResolver returns a [Resolver] that keeps successful
+// lookups of the provided resolver in memory for ttl.
+//
+// Failed lookups are never cached.
+// If resolver is nil, [NetResolver] with default parameters is used.
+func CachedResolver(resolver Resolver, ttl time.Duration) Resolver {
+	if ttl <= 0 {
+		panic("plow: cache ttl must be positive")
+	}
+	if resolver == nil {
+		resolver = NetResolver(nil)
+	}
+	return &cachedResolver{
+		resolver: resolver,
+		ttl:      ttl,
+		entries:  map[string]cachedResolverEntry{},
+	}
+}
+
+type cachedResolverEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+type cachedResolver struct {
+	resolver Resolver
+	ttl      time.Duration
+
+	entries map[string]cachedResolverEntry
+	mu      sync.RWMutex
+}
+
+func (cr *cachedResolver) Resolve(ctx context.Context, host string) ([]net.IP, error) {
+	key := strings.ToLower(host)
+	now := time.Now()
+
+	cr.mu.RLock()
+	entry, has := cr.entries[key]
+	cr.mu.RUnlock()
+
+	if has && now.Before(entry.expires) {
+		return entry.ips, nil
+	}
+
+	ips, err := cr.resolver.Resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	cr.mu.Lock()
+	for k, e := range cr.entries {
+		if !now.Before(e.expires) {
+			delete(cr.entries, k)
+		}
+	}
+	cr.entries[key] = cachedResolverEntry{
+		ips:     ips,
+		expires: now.Add(cr.ttl),
+	}
+	cr.mu.Unlock()
+
+	return ips, nil
+}
+
+// HostsResolver returns a [Resolver] with static host overrides
+// like the hosts file (/etc/hosts), hosts are matched case-insensitively.
+//
+// Hosts missing in the overrides are resolved by fallback.
+// If fallback is nil, [NetResolver] with default parameters is used.
+func HostsResolver(hosts map[string][]net.IP, fallback Resolver) Resolver {
+	if fallback == nil {
+		fallback = NetResolver(nil)
+	}
+	overrides := make(map[string][]net.IP, len(hosts))
+	for host, ips := range hosts {
+		overrides[strings.ToLower(host)] = ips
+	}
+	return ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		if ips, has := overrides[strings.ToLower(host)]; has {
+			return ips, nil
+		}
+		return fallback.Resolve(ctx, host)
+	})
+}
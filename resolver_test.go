@@ -0,0 +1,136 @@
+package plow
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oesand/plow/specs"
+)
+
+func TestCachedResolver(t *testing.T) {
+	var lookups atomic.Int32
+	resolver := CachedResolver(ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		lookups.Add(1)
+		if host == "fail.test" {
+			return nil, errors.New("lookup failed")
+		}
+		return []net.IP{net.IPv4(127, 0, 0, 1)}, nil
+	}), 50*time.Millisecond)
+
+	for range 3 {
+		ips, err := resolver.Resolve(context.Background(), "Example.test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ips) != 1 || !ips[0].Equal(net.IPv4(127, 0, 0, 1)) {
+			t.Fatalf("unexpected ips: %v", ips)
+		}
+	}
+	if got := lookups.Load(); got != 1 {
+		t.Fatalf("expected 1 lookup, got %d", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := resolver.Resolve(context.Background(), "example.test"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookups.Load(); got != 2 {
+		t.Fatalf("expected lookup after ttl expired, got %d", got)
+	}
+
+	for range 2 {
+		if _, err := resolver.Resolve(context.Background(), "fail.test"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if got := lookups.Load(); got != 4 {
+		t.Fatalf("failed lookups must not be cached, got %d", got)
+	}
+}
+
+func TestHostsResolver(t *testing.T) {
+	fallback := ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		return []net.IP{net.IPv4(10, 0, 0, 1)}, nil
+	})
+	resolver := HostsResolver(map[string][]net.IP{
+		"Service.Local": {net.ParseIP("::1")},
+	}, fallback)
+
+	ips, err := resolver.Resolve(context.Background(), "service.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("::1")) {
+		t.Errorf("unexpected override ips: %v", ips)
+	}
+
+	ips, err = resolver.Resolve(context.Background(), "other.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("unexpected fallback ips: %v", ips)
+	}
+}
+
+func TestTransport_Resolver(t *testing.T) {
+	testContent := []byte("resolved")
+	closeServer, url := newTestServer(func(req Request) (specs.StatusCode, *specs.Header, []byte) {
+		if host := req.Header().Get("Host"); !strings.HasPrefix(host, "service.test:") {
+			t.Errorf("unexpected host header: %s", host)
+		}
+		header := specs.NewHeader()
+		header.Set("Content-Length", "8")
+		return specs.StatusCodeOK, header, testContent
+	})
+	defer closeServer()
+
+	var resolved atomic.Bool
+	transport := DefaultTransport()
+	transport.Resolver = ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		if host != "service.test" {
+			t.Errorf("unexpected host: %s", host)
+		}
+		resolved.Store(true)
+		return []net.IP{net.IPv4(127, 0, 0, 1)}, nil
+	})
+
+	header := specs.NewHeader()
+	reqUrl := &specs.Url{Scheme: "http", Host: "service.test", Port: url.Port, Path: "/"}
+
+	resp, err := transport.RoundTrip(context.Background(), specs.HttpMethodGet, reqUrl, header, nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	if !resolved.Load() {
+		t.Error("resolver was not used")
+	}
+
+	addr, ok := ResponseRemoteAddr(resp).(*net.TCPAddr)
+	if !ok || !addr.IP.Equal(net.IPv4(127, 0, 0, 1)) || addr.Port != int(url.Port) {
+		t.Errorf("unexpected remote addr: %v", ResponseRemoteAddr(resp))
+	}
+
+	checkResponseBody(t, resp, testContent)
+}
+
+func TestTransport_ResolverError(t *testing.T) {
+	transport := DefaultTransport()
+	transport.Resolver = ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		return nil, nil
+	})
+
+	_, err := transport.RoundTrip(context.Background(), specs.HttpMethodGet,
+		specs.MustParseUrl("http://unknown.test"), specs.NewHeader(), nil)
+
+	var opErr *specs.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "dns" {
+		t.Fatalf("expected dns error, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package plow
+
+import "net"
+
+// ResponseRemoteAddr returns [net.Addr] of the server which the connection
+// of the [ClientResponse] was established with, such as the address
+// selected by [Transport.Resolver].
+//
+// If the request was made through a proxy it is the proxy address.
+// Returns nil if the response does not report the address.
+func ResponseRemoteAddr(resp ClientResponse) net.Addr {
+	if addrResp, ok := resp.(interface{ RemoteAddr() net.Addr }); ok {
+		return addrResp.RemoteAddr()
+	}
+	return nil
+}
@@ -132,6 +132,9 @@ func (resp *bufferResponse) ContentLength() int64 {
 //
 // if status code unspecified then [specs.StatusCodeOK] will be set
 // if content type unspecified then [specs.ContentTypeRaw] will be set
+//
+// Response implements [TrailerWriter], so trailer fields
+// can be declared and set while the stream is copied.
 func StreamResponse(statusCode specs.StatusCode, contentType string, stream io.Reader, contentLength int64, configure ...func(Response)) Response {
 	if stream == nil {
 		panic("plow: passed nil stream")
@@ -155,6 +158,7 @@ type streamResponse struct {
 	Response
 	stream        io.Reader
 	contentLength int64
+	trailer       *specs.Header
 }
 
 func (resp *streamResponse) WriteBody(writer io.Writer) error {
@@ -165,3 +169,10 @@ func (resp *streamResponse) WriteBody(writer io.Writer) error {
 func (resp *streamResponse) ContentLength() int64 {
 	return resp.contentLength
 }
+
+func (resp *streamResponse) Trailer() *specs.Header {
+	if resp.trailer == nil {
+		resp.trailer = specs.NewHeader()
+	}
+	return resp.trailer
+}
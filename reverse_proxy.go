@@ -0,0 +1,427 @@
+package plow
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oesand/plow/internal"
+	"github.com/oesand/plow/internal/encoding"
+	"github.com/oesand/plow/specs"
+)
+
+// Hop-by-hop headers. These are removed when sent to the upstream
+// or back to the client (RFC 7230, section 6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// NewReverseProxy creates a [ReverseProxy] that forwards
+// requests to the target url through the transport of [DefaultTransport]
+// without the body size limit and with the timeout for the response headers only,
+// so large and streamed bodies, such as downloads and server-sent events, are forwarded whole.
+//
+// Path of incoming request is appended to the target path
+// and query is merged with the target query.
+func NewReverseProxy(target *specs.Url) *ReverseProxy {
+	if target == nil {
+		panic("plow: passed nil target url")
+	}
+	return &ReverseProxy{
+		Target:    target,
+		Transport: proxyTransport(),
+	}
+}
+
+// proxyTransport creates [Transport] for proxies which forwards bodies of any size
+// and duration, the upstream must send the response headers in time.
+func proxyTransport() *Transport {
+	transport := DefaultTransport()
+	transport.MaxBodySize = 0
+	transport.ReadTimeout = 0
+	transport.WriteTimeout = 0
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	return transport
+}
+
+// ReverseProxy is a [Handler] that forwards incoming requests
+// to the upstream through the [RoundTripper] and sends its response back to the client.
+//
+// Bodies are streamed in both directions, hop-by-hop headers are stripped,
+// and "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto"
+// and "Forwarded" headers are added to the upstream request.
+//
+// Connections with "Upgrade" header (such as WebSocket) are passed through
+// to the upstream after it answers with [specs.StatusCodeSwitchingProtocols].
+type ReverseProxy struct {
+	_ internal.NoCopy
+
+	// Target specifies the upstream url for the requests.
+	//
+	// Target is required unless Rewrite sets the upstream host itself.
+	Target *specs.Url
+
+	// Transport specifies the mechanism by which upstream requests are made.
+	// If nil, the transport of [NewReverseProxy] is used.
+	Transport RoundTripper
+
+	// Rewrite optionally modifies the upstream url and header
+	// after they are built from the incoming request.
+	Rewrite func(req Request, url *specs.Url, header *specs.Header)
+
+	// ModifyResponse optionally modifies the upstream response header
+	// before it is sent to the client.
+	//
+	// If ModifyResponse returns an error, ErrorResponse is called with it.
+	ModifyResponse func(req Request, resp ClientResponse) error
+
+	// ErrorResponse optionally creates the response
+	// sent to the client when the upstream request fails.
+	//
+	// If nil, [specs.StatusCodeGatewayTimeout] is answered
+	// on timeouts and [specs.StatusCodeBadGateway] otherwise.
+	ErrorResponse func(req Request, err error) Response
+
+	// DisableForwardedHeaders disables adding of "X-Forwarded-*"
+	// and "Forwarded" headers to the upstream request.
+	DisableForwardedHeaders bool
+
+	mu sync.Mutex
+}
+
+// Handle implements the [Handler] interface.
+func (rp *ReverseProxy) Handle(ctx context.Context, req Request) Response {
+	// The body is forwarded as is together with its "Content-Encoding"
+	if decoder, ok := req.(BodyDecoder); ok {
+		decoder.DecodeBody(false)
+	}
+
+	url := rp.upstreamUrl(req)
+
+	header := req.Header().Clone()
+	upgrade := upgradeType(req.Header())
+	isChunked := strings.EqualFold(req.Header().Get("Transfer-Encoding"), "chunked")
+	removeHopHeaders(header)
+
+	if upgrade != "" {
+		header.Set("Connection", "Upgrade")
+		header.Set("Upgrade", upgrade)
+	}
+	if isChunked {
+		header.Set("Transfer-Encoding", "chunked")
+	}
+
+	if !rp.DisableForwardedHeaders {
+		setForwardedHeaders(req, header)
+	}
+
+	if rp.Rewrite != nil {
+		rp.Rewrite(req, url, header)
+	}
+	if url.Host == "" {
+		return rp.errorResponse(req, specs.NewOpError("proxy", "upstream url is not specified"))
+	}
+
+	var writer BodyWriter
+	if body := req.Body(); body != nil {
+		contentLength, _ := strconv.ParseInt(req.Header().Get("Content-Length"), 10, 64)
+		writer = &proxyRequestBody{
+			req:           req,
+			contentLength: contentLength,
+			trailer:       declaredTrailer(req.Header()),
+		}
+	}
+
+	var hijacker *TransportHijacker
+	if upgrade != "" {
+		var hijackCtx context.Context
+		hijacker, hijackCtx = WithTransportHijacker(ctx)
+		if hijackCtx != nil {
+			ctx = hijackCtx
+		}
+	}
+
+	resp, err := rp.transport().RoundTrip(ctx, req.Method(), url, header, writer)
+	if err != nil {
+		return rp.errorResponse(req, err)
+	}
+
+	if rp.ModifyResponse != nil {
+		if err = rp.ModifyResponse(req, resp); err != nil {
+			if body := resp.Body(); body != nil {
+				body.Close()
+			}
+			return rp.errorResponse(req, err)
+		}
+	}
+
+	respHeader := resp.Header().Clone()
+	respUpgrade := upgradeType(resp.Header())
+	removeHopHeaders(respHeader)
+
+	if resp.StatusCode() == specs.StatusCodeSwitchingProtocols {
+		if hijacker == nil || hijacker.Conn == nil || !strings.EqualFold(respUpgrade, upgrade) {
+			if hijacker != nil && hijacker.Conn != nil {
+				hijacker.Conn.Close()
+			}
+			return rp.errorResponse(req, specs.NewOpError("proxy", "upstream switched to unexpected protocol '%s'", respUpgrade))
+		}
+
+		upstreamConn := hijacker.Conn
+		req.Hijack(func(ctx context.Context, conn net.Conn) {
+			tunnelConns(ctx, conn, upstreamConn)
+		})
+
+		respHeader.Set("Connection", "Upgrade")
+		respHeader.Set("Upgrade", respUpgrade)
+		return &emptyResponse{statusCode: resp.StatusCode(), header: respHeader}
+	} else if hijacker != nil && hijacker.Conn != nil && resp.Body() == nil {
+		hijacker.Conn.Close()
+	}
+
+	body := resp.Body()
+	if body == nil {
+		return &emptyResponse{statusCode: resp.StatusCode(), header: respHeader}
+	}
+
+	var contentLength int64
+	if respHeader.Has("Content-Encoding") {
+		// Body is decoded by the transport, so the size is unknown.
+		respHeader.Del("Content-Encoding")
+		respHeader.Del("Content-Length")
+	} else {
+		contentLength, _ = strconv.ParseInt(respHeader.Get("Content-Length"), 10, 64)
+	}
+
+	if major, minor := req.ProtoVersion(); contentLength <= 0 && major == 1 && minor == 1 {
+		respHeader.Set("Transfer-Encoding", "chunked")
+	}
+
+	return &proxyResponse{
+		Response:      &emptyResponse{statusCode: resp.StatusCode(), header: respHeader},
+		resp:          resp,
+		contentLength: contentLength,
+		trailer:       declaredTrailer(resp.Header()),
+	}
+}
+
+func (rp *ReverseProxy) transport() RoundTripper {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.Transport == nil {
+		rp.Transport = proxyTransport()
+	}
+	return rp.Transport
+}
+
+func (rp *ReverseProxy) upstreamUrl(req Request) *specs.Url {
+	var url specs.Url
+	if rp.Target != nil {
+		url = *rp.Target
+	}
+	reqUrl := req.Url()
+
+	url.Path = joinUrlPath(url.Path, reqUrl.Path)
+
+	if reqUrl.Query.Any() {
+		query := make(specs.Query, len(url.Query)+len(reqUrl.Query))
+		for key, value := range url.Query {
+			query[key] = value
+		}
+		for key, value := range reqUrl.Query {
+			query[key] = value
+		}
+		url.Query = query
+	}
+
+	return &url
+}
+
+func (rp *ReverseProxy) errorResponse(req Request, err error) Response {
+	if rp.ErrorResponse != nil {
+		return rp.ErrorResponse(req, err)
+	}
+	return proxyErrorResponse(err)
+}
+
+func proxyErrorResponse(err error) Response {
+	code := specs.StatusCodeBadGateway
+	var netErr net.Error
+	if errors.Is(err, specs.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		code = specs.StatusCodeGatewayTimeout
+	}
+	return TextResponse(code, specs.ContentTypePlain, string(code.Detail()))
+}
+
+type proxyRequestBody struct {
+	req           Request
+	contentLength int64
+	trailer       *specs.Header
+}
+
+func (body *proxyRequestBody) WriteBody(writer io.Writer) error {
+	_, err := io.Copy(writer, body.req.Body())
+	if err == nil && body.trailer != nil {
+		copyTrailer(body.trailer, Trailer(body.req))
+	}
+	return err
+}
+
+func (body *proxyRequestBody) ContentLength() int64 {
+	return body.contentLength
+}
+
+func (body *proxyRequestBody) Trailer() *specs.Header {
+	return body.trailer
+}
+
+type proxyResponse struct {
+	Response
+	resp          ClientResponse
+	contentLength int64
+	trailer       *specs.Header
+}
+
+func (resp *proxyResponse) WriteBody(writer io.Writer) error {
+	body := resp.resp.Body()
+	defer body.Close()
+
+	_, err := io.Copy(writer, body)
+	if err == nil && resp.trailer != nil {
+		copyTrailer(resp.trailer, ResponseTrailer(resp.resp))
+	}
+	return err
+}
+
+func (resp *proxyResponse) ContentLength() int64 {
+	return resp.contentLength
+}
+
+func (resp *proxyResponse) Trailer() *specs.Header {
+	return resp.trailer
+}
+
+func removeHopHeaders(header *specs.Header) {
+	// RFC 7230, section 6.1: Remove headers listed in the "Connection" header.
+	for _, name := range strings.Split(header.Get("Connection"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			header.Del(name)
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+func upgradeType(header *specs.Header) string {
+	for _, token := range strings.Split(header.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+			return header.Get("Upgrade")
+		}
+	}
+	return ""
+}
+
+func declaredTrailer(header *specs.Header) *specs.Header {
+	names := header.Get("Trailer")
+	if names == "" {
+		return nil
+	}
+
+	trailer := specs.NewHeader()
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" && encoding.IsAllowedTrailer(name) {
+			trailer.Set(name, "")
+		}
+	}
+	if !trailer.Any() {
+		return nil
+	}
+	return trailer
+}
+
+func copyTrailer(dst, src *specs.Header) {
+	if src == nil {
+		return
+	}
+	for name, value := range src.All() {
+		dst.Set(name, value)
+	}
+}
+
+func setForwardedHeaders(req Request, header *specs.Header) {
+	// The chain is continued by the immediate peer, the client is already listed by trusted proxies
+	clientIP := PeerAddr(req).String()
+	if host, _, err := net.SplitHostPort(clientIP); err == nil {
+		clientIP = host
+	}
+
+	host := req.Header().Get("Host")
+	// Server requests are in the origin form without the scheme, so it is taken from the connection
+	proto := "http"
+	if TLSState(req) != nil {
+		proto = "https"
+	}
+
+	if prior := header.Get("X-Forwarded-For"); prior != "" {
+		header.Set("X-Forwarded-For", prior+", "+clientIP)
+	} else {
+		header.Set("X-Forwarded-For", clientIP)
+	}
+	if host != "" {
+		header.Set("X-Forwarded-Host", host)
+	}
+	header.Set("X-Forwarded-Proto", proto)
+
+	// RFC 7239, section 6: IPv6 address must be quoted and enclosed in square brackets.
+	forwardedFor := clientIP
+	if strings.Contains(clientIP, ":") {
+		forwardedFor = "\"[" + clientIP + "]\""
+	}
+	forwarded := "for=" + forwardedFor
+	if host != "" {
+		forwarded += ";host=\"" + host + "\""
+	}
+	forwarded += ";proto=" + proto
+
+	if prior := header.Get("Forwarded"); prior != "" {
+		header.Set("Forwarded", prior+", "+forwarded)
+	} else {
+		header.Set("Forwarded", forwarded)
+	}
+}
+
+func tunnelConns(ctx context.Context, conn, upstream net.Conn) {
+	defer upstream.Close()
+	conn.SetDeadline(time.Time{})
+
+	done := make(chan struct{}, 2)
+	copyConn := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		dst.Close()
+		done <- struct{}{}
+	}
+
+	go copyConn(upstream, conn)
+	go copyConn(conn, upstream)
+
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+}
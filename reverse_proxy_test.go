@@ -0,0 +1,406 @@
+package plow
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oesand/plow/internal/testing_ops"
+	"github.com/oesand/plow/specs"
+)
+
+func newReverseProxyTest(t *testing.T, proxy *ReverseProxy) string {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := DefaultServer(proxy)
+	go server.Serve(listener)
+
+	return "http://" + listener.Addr().String()
+}
+
+func TestReverseProxy_ForwardRequest(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/items" || r.URL.Query().Get("page") != "2" || r.URL.Query().Get("token") != "abc" {
+			t.Errorf("unexpected upstream url: %s", r.URL)
+		}
+
+		if r.Header.Get("X-Hello-World") != "xyz-123" {
+			t.Errorf("not found expected headers: %+v", r.Header)
+		}
+		if r.Header.Get("X-Hop") != "" || r.Header.Get("Keep-Alive") != "" {
+			t.Errorf("hop-by-hop headers must be removed: %+v", r.Header)
+		}
+
+		if r.Header.Get("X-Forwarded-For") != "10.0.0.1, 127.0.0.1" ||
+			r.Header.Get("X-Forwarded-Proto") != "http" ||
+			!strings.HasPrefix(r.Header.Get("X-Forwarded-Host"), "127.0.0.1:") {
+			t.Errorf("not found expected forwarded headers: %+v", r.Header)
+		}
+		if forwarded := r.Header.Get("Forwarded"); !strings.HasPrefix(forwarded, "for=127.0.0.1;host=") ||
+			!strings.HasSuffix(forwarded, ";proto=http") {
+			t.Errorf("unexpected forwarded header: %s", forwarded)
+		}
+
+		w.Header().Set("X-Upstream", "yes")
+		w.Write([]byte("upstream response"))
+	}))
+	defer upstream.Close()
+
+	proxy := NewReverseProxy(specs.MustParseUrlQuery(upstream.URL+"/api", specs.Query{"token": "abc"}))
+	url := newReverseProxyTest(t, proxy)
+
+	req, _ := http.NewRequest("GET", url+"/items?page=2", nil)
+	req.Header.Set("X-Hello-World", "xyz-123")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	req.Header.Set("X-Hop", "value")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("Connection", "X-Hop")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	if resp.Header.Get("X-Upstream") != "yes" {
+		t.Errorf("not found expected headers, %+v", resp.Header)
+	}
+
+	checkHttpResponseBody(t, resp, []byte("upstream response"))
+}
+
+func TestReverseProxy_ForwardedProtoTLS(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Forwarded-Proto") != "https" {
+			t.Errorf("unexpected X-Forwarded-Proto: %s", r.Header.Get("X-Forwarded-Proto"))
+		}
+		if forwarded := r.Header.Get("Forwarded"); !strings.HasSuffix(forwarded, ";proto=https") {
+			t.Errorf("unexpected forwarded header: %s", forwarded)
+		}
+		w.Write([]byte("upstream response"))
+	}))
+	defer upstream.Close()
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := DefaultServer(NewReverseProxy(specs.MustParseUrl(upstream.URL)))
+	go server.ServeTLSRaw(listener, testing_ops.NewTlsCert())
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	resp, err := client.Get("https://" + listener.Addr().String() + "/items")
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	checkHttpResponseBody(t, resp, []byte("upstream response"))
+}
+
+func TestReverseProxy_StreamBodiesWithTrailer(t *testing.T) {
+	requestBody := bytes.Repeat([]byte("request streamed "), 1024)
+	responseBody := bytes.Repeat([]byte("response streamed "), 1024)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, requestBody) {
+			t.Errorf("invalid upstream request body length %d", len(data))
+		}
+		if r.Trailer.Get("X-Checksum") != "req-123" {
+			t.Errorf("not found expected request trailer: %+v", r.Trailer)
+		}
+
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write(responseBody)
+		w.Header().Set("X-Checksum", "resp-123")
+	}))
+	defer upstream.Close()
+
+	url := newReverseProxyTest(t, NewReverseProxy(specs.MustParseUrl(upstream.URL)))
+
+	req, _ := http.NewRequest("POST", url, io.NopCloser(bytes.NewReader(requestBody)))
+	req.ContentLength = -1
+	req.Trailer = http.Header{"X-Checksum": {"req-123"}}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	checkHttpResponseBody(t, resp, responseBody)
+
+	if resp.Trailer.Get("X-Checksum") != "resp-123" {
+		t.Errorf("not found expected response trailer, %+v", resp.Trailer)
+	}
+}
+
+func TestReverseProxy_LargeChunkedResponse(t *testing.T) {
+	// The body is larger than the default limit of the transport
+	chunk := bytes.Repeat([]byte("0123456789abcdef"), 4<<10)
+	const chunks = 192
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for range chunks {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	url := newReverseProxyTest(t, NewReverseProxy(specs.MustParseUrl(upstream.URL)))
+
+	resp, err := http.Get(url + "/download")
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	defer resp.Body.Close()
+
+	size, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		t.Fatal("read:", err)
+	}
+	if expected := int64(len(chunk) * chunks); size != expected || expected <= DefaultTransport().MaxBodySize {
+		t.Errorf("unexpected body size: %d, want %d", size, expected)
+	}
+}
+
+func TestReverseProxy_EncodedRequestBody(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("compressed request"))
+	gz.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("unexpected content encoding: %s", r.Header.Get("Content-Encoding"))
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, compressed.Bytes()) {
+			t.Errorf("request body must be forwarded as is, got %q", data)
+		}
+	}))
+	defer upstream.Close()
+
+	url := newReverseProxyTest(t, NewReverseProxy(specs.MustParseUrl(upstream.URL)))
+
+	req, _ := http.NewRequest("POST", url, bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+func TestReverseProxy_UnsupportedRequestEncoding(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Encoding") != "zstd" || string(body) != "zstd-frame" {
+			t.Errorf("unexpected upstream request: %+v %q", r.Header, body)
+		}
+		w.Write([]byte("stored"))
+	}))
+	defer upstream.Close()
+
+	url := newReverseProxyTest(t, NewReverseProxy(specs.MustParseUrl(upstream.URL)))
+
+	req, _ := http.NewRequest("POST", url+"/upload", strings.NewReader("zstd-frame"))
+	req.Header.Set("Content-Encoding", "zstd")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	checkHttpResponseBody(t, resp, []byte("stored"))
+}
+
+func TestReverseProxy_Hooks(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rewritten" || r.Header.Get("X-Rewritten") != "yes" {
+			t.Errorf("request is not rewritten: %s %+v", r.URL, r.Header)
+		}
+		w.Write([]byte("okay"))
+	}))
+	defer upstream.Close()
+
+	proxy := &ReverseProxy{
+		Rewrite: func(req Request, url *specs.Url, header *specs.Header) {
+			target := specs.MustParseUrl(upstream.URL)
+			url.Scheme, url.Host, url.Port = target.Scheme, target.Host, target.Port
+			url.Path = "/rewritten"
+			header.Set("X-Rewritten", "yes")
+		},
+		ModifyResponse: func(req Request, resp ClientResponse) error {
+			resp.Header().Set("X-Modified", "yes")
+			return nil
+		},
+	}
+	url := newReverseProxyTest(t, proxy)
+
+	resp, err := http.Get(url + "/original")
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	if resp.Header.Get("X-Modified") != "yes" {
+		t.Errorf("response is not modified, %+v", resp.Header)
+	}
+
+	checkHttpResponseBody(t, resp, []byte("okay"))
+}
+
+func TestReverseProxy_BadGateway(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstreamUrl := "http://" + listener.Addr().String()
+	listener.Close()
+
+	url := newReverseProxyTest(t, NewReverseProxy(specs.MustParseUrl(upstreamUrl)))
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != int(specs.StatusCodeBadGateway) {
+		t.Errorf("invalid status code: %d", resp.StatusCode)
+	}
+}
+
+func TestReverseProxy_Upgrade(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			t.Errorf("not found expected upgrade header: %+v", r.Header)
+		}
+
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		buf.Flush()
+
+		line, err := buf.ReadString('\n')
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Write([]byte("echo: " + line))
+	}))
+	defer upstream.Close()
+
+	url := newReverseProxyTest(t, NewReverseProxy(specs.MustParseUrl(upstream.URL)))
+
+	conn, err := net.Dial("tcp4", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn.Write([]byte("GET /chat HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal("read response:", err)
+	}
+
+	if resp.StatusCode != int(specs.StatusCodeSwitchingProtocols) ||
+		!strings.EqualFold(resp.Header.Get("Upgrade"), "echo") {
+		t.Fatalf("unexpected response: %d %+v", resp.StatusCode, resp.Header)
+	}
+
+	conn.Write([]byte("hello\n"))
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal("read tunnel:", err)
+	}
+	if line != "echo: hello\n" {
+		t.Errorf("unexpected tunnel data: %q", line)
+	}
+}
+
+func TestReverseProxy_UpgradeBufferedData(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		// The first frame is sent in the same write as the response
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\ngreeting\n")
+		buf.Flush()
+
+		line, err := buf.ReadString('\n')
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Write([]byte("echo: " + line))
+	}))
+	defer upstream.Close()
+
+	url := newReverseProxyTest(t, NewReverseProxy(specs.MustParseUrl(upstream.URL)))
+
+	conn, err := net.Dial("tcp4", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// The first frame is sent in the same write as the request
+	conn.Write([]byte("GET /chat HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\nhello\n"))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal("read response:", err)
+	}
+	if resp.StatusCode != int(specs.StatusCodeSwitchingProtocols) {
+		t.Fatalf("unexpected response: %d %+v", resp.StatusCode, resp.Header)
+	}
+
+	for _, expected := range []string{"greeting\n", "echo: hello\n"} {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal("read tunnel:", err)
+		}
+		if line != expected {
+			t.Errorf("unexpected tunnel data: %q, want %q", line, expected)
+		}
+	}
+}
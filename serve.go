@@ -7,7 +7,9 @@ import (
 	"errors"
 	"github.com/oesand/plow/internal/catch"
 	"github.com/oesand/plow/internal/encoding"
+	"github.com/oesand/plow/internal/limit"
 	"github.com/oesand/plow/internal/parsing"
+	"github.com/oesand/plow/internal/proxy"
 	"github.com/oesand/plow/internal/server_ops"
 	"github.com/oesand/plow/internal/stream"
 	"github.com/oesand/plow/specs"
@@ -28,6 +30,10 @@ import (
 // Serve always returns a non-nil error.
 // After [Server.Shutdown], the returned error is [specs.ErrClosed].
 func (srv *Server) Serve(listener net.Listener) error {
+	return srv.serve(listener, nil)
+}
+
+func (srv *Server) serve(listener net.Listener, tlsConfig *tls.Config) error {
 	if listener == nil {
 		panic("plow: nil listener")
 	}
@@ -40,25 +46,58 @@ func (srv *Server) Serve(listener net.Listener) error {
 
 	srv.once.Do(srv.beforeOnce)
 
-	handler := srv.Handler
 	errorHandler := srv.ErrorHandler
 	if errorHandler == nil {
-		errorHandler, _ = handler.(ErrorHandler)
+		errorHandler, _ = srv.Handler.(ErrorHandler)
+	}
+
+	proxyTrusted, err := proxy.ParseNetworks(srv.ProxyProtocolTrusted)
+	if err != nil {
+		return err
+	}
+	trustedProxies, err := proxy.ParseNetworks(srv.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	config := &serveConfig{
+		handler:        srv.Handler,
+		trustedProxies: trustedProxies,
+		conns:          limit.NewSemaphore(srv.MaxConns),
+		connsPerIP:     limit.NewKeyedSemaphore(srv.MaxConnsPerIP),
+		requests:       limit.NewSemaphore(srv.MaxConcurrentRequests),
 	}
 
 	srv.listenerTrack.Add(1)
 	defer srv.listenerTrack.Done()
 
+	// Closing unblocks the pending accept, so connections
+	// are left to other processes sharing the socket
+	defer listener.Close()
+
+	serveDone := make(chan struct{})
+	defer close(serveDone)
+	go func() {
+		select {
+		case <-srv.shuttingDown:
+			listener.Close()
+		case <-serveDone:
+		}
+	}()
+
 	var attemptDelay time.Duration
 	var connTrack sync.WaitGroup
-	var err error
 
 	ctx, cancelCtx := context.WithCancel(context.Background())
 	for {
 		var conn net.Conn
-		conn, err = srv.accept(ctx, listener)
+		conn, err = listener.Accept()
 
 		if err != nil {
+			if srv.IsShutdown() {
+				err = specs.ErrClosed
+				break
+			}
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				if attemptDelay == 0 {
 					attemptDelay = 5 * time.Millisecond
@@ -75,16 +114,26 @@ func (srv *Server) Serve(listener net.Listener) error {
 		}
 
 		attemptDelay = 0
-		if srv.FilterConn != nil {
-			if allow := srv.FilterConn(conn.RemoteAddr()); !allow {
-				conn.Close()
-				continue
-			}
+		srv.Metrics.connAccepted()
+
+		// The connection slot is taken before the goroutine is started,
+		// so refused connections do not cost one
+		overLimit := !srv.acquire(config.conns)
+		if overLimit && srv.LimitPolicy != LimitPolicyReject {
+			srv.Metrics.connRefused()
+			conn.Close()
+			continue
 		}
 
 		connTrack.Add(1)
-		go func(conn net.Conn) {
+		srv.workers.Go(func() {
 			defer connTrack.Done()
+			if !overLimit {
+				defer config.conns.Release()
+			}
+
+			ctx := ctx
+			var tracked bool
 			defer func() {
 				if err := recover(); err != nil {
 					if errorHandler != nil {
@@ -95,9 +144,52 @@ func (srv *Server) Serve(listener net.Listener) error {
 					}
 				}
 				conn.Close()
+				if tracked {
+					srv.setState(conn, ConnStateClosed)
+				}
 			}()
 
-			if err := srv.handle(ctx, conn, handler); err != nil {
+			conn = srv.Metrics.countConn(conn)
+
+			if proxyTrusted.ContainsAddr(conn.RemoteAddr()) {
+				proxyConn, header, err := srv.readProxyHeader(conn)
+				if err != nil {
+					if errorHandler != nil {
+						errorHandler.HandleError(ctx, conn, err)
+					}
+					return
+				}
+				conn = proxyConn
+				ctx = context.WithValue(ctx, proxyProtocolKey, header)
+			}
+
+			if srv.FilterConn != nil {
+				if allow := srv.FilterConn(conn.RemoteAddr()); !allow {
+					srv.Metrics.connFiltered()
+					return
+				}
+			}
+
+			if !overLimit {
+				key, acquired := srv.acquireIP(config.connsPerIP, conn.RemoteAddr())
+				if !acquired && srv.LimitPolicy != LimitPolicyReject {
+					srv.Metrics.connRefused()
+					return
+				}
+				if acquired && key != "" {
+					defer config.connsPerIP.Release(key)
+				}
+				overLimit = !acquired
+			}
+
+			if tlsConfig != nil {
+				conn = tls.Server(conn, tlsConfig)
+			}
+
+			tracked = true
+			srv.setState(conn, ConnStateNew)
+
+			if err := srv.handle(ctx, conn, config, overLimit); err != nil {
 				if errorHandler != nil {
 					errorHandler.HandleError(ctx, conn, err)
 				} else {
@@ -110,7 +202,7 @@ func (srv *Server) Serve(listener net.Listener) error {
 					}
 				}
 			}
-		}(conn)
+		})
 	}
 
 	cancelCtx()
@@ -119,30 +211,13 @@ func (srv *Server) Serve(listener net.Listener) error {
 	return err
 }
 
-func (srv *Server) accept(ctx context.Context, listener net.Listener) (net.Conn, error) {
-	connRes := make(chan catch.ResultErrPair[net.Conn], 1)
-
-	go func() {
-		conn, err := listener.Accept()
-		connRes <- catch.ResultErrPair[net.Conn]{conn, err}
-	}()
-
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-srv.shuttingDown:
-		return nil, specs.ErrClosed
-	case res := <-connRes:
-		return res.Res, res.Err
-	}
-}
-
-func (srv *Server) handle(ctx context.Context, conn net.Conn, handler Handler) error {
+func (srv *Server) handle(ctx context.Context, conn net.Conn, config *serveConfig, overLimit bool) error {
 	var err error
 	if err = ctx.Err(); err != nil {
 		return err
 	}
 
+	var tlsState *tls.ConnectionState
 	if tlsConn, ok := conn.(*tls.Conn); ok {
 		if srv.TLSHandshakeTimeout > 0 {
 			conn.SetDeadline(time.Now().Add(srv.TLSHandshakeTimeout))
@@ -154,6 +229,7 @@ func (srv *Server) handle(ctx context.Context, conn net.Conn, handler Handler) e
 			// TLS, assume they're speaking plaintext HTTP and write a
 			// 400 response on the TLS conn underlying net.Conn.
 			var re tls.RecordHeaderError
+			srv.Metrics.tlsHandshakeFailed()
 			if errors.As(err, &re) && re.Conn != nil && server_ops.TlsRecordHeaderLikeHTTP(re.RecordHeader) {
 				return responseErrDowngradeHTTPS
 			}
@@ -164,10 +240,13 @@ func (srv *Server) handle(ctx context.Context, conn net.Conn, handler Handler) e
 			conn.SetDeadline(time.Time{})
 		}
 
-		proto := tlsConn.ConnectionState().NegotiatedProtocol
+		state := tlsConn.ConnectionState()
+		tlsState = &state
+		proto := state.NegotiatedProtocol
 
 		if srv.tlsNextProtos != nil {
 			if handler, ok := srv.tlsNextProtos[proto]; ok {
+				srv.setState(conn, ConnStateHijacked)
 				handler(tlsConn)
 				return nil
 			}
@@ -177,19 +256,61 @@ func (srv *Server) handle(ctx context.Context, conn net.Conn, handler Handler) e
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	if srv.ReadTimeout > 0 {
-		defer conn.SetReadDeadline(time.Time{})
-	}
+	// Deadlines may be changed by handlers with RequestController
+	defer conn.SetReadDeadline(time.Time{})
+	defer conn.SetWriteDeadline(time.Time{})
 
-	if srv.WriteTimeout > 0 {
-		defer conn.SetWriteDeadline(time.Time{})
+	// The close of the client is detected by the background read while the request is handled
+	connReader := server_ops.NewConnReader(conn, srv.workers.Go)
+	defer connReader.AbortPendingRead()
+
+	var reader io.Reader = connReader
+	var rateReader *server_ops.MinRateReader
+	if srv.MinReadRate > 0 {
+		grace := srv.MinReadRateGrace
+		if grace <= 0 {
+			grace = time.Second
+		}
+		rateReader = server_ops.NewMinRateReader(conn, connReader, srv.MinReadRate, grace)
+		reader = rateReader
 	}
 
-	bufioReader := stream.DefaultBufioReaderPool.Get(conn)
+	controller := &RequestController{conn: conn, rateReader: rateReader}
+	ctx = context.WithValue(ctx, requestControllerKey, controller)
+
+	bufioReader := stream.DefaultBufioReaderPool.Get(reader)
 	defer stream.DefaultBufioReaderPool.Put(bufioReader)
 
+	// The response head is buffered to be sent together with small bodies
+	bufioWriter := responseWriterPool.Get(conn)
+	defer responseWriterPool.Put(bufioWriter)
+
+	// The handled request is returned to the pool once the response is written
+	var req *server_ops.HttpRequest
+	defer func() {
+		if req != nil {
+			controller.holds.Wait()
+			server_ops.ReleaseRequest(req)
+		}
+	}()
+
+	// Start of the request in flight, which is failed if handling is not completed
+	var requestStart time.Time
+	var requestSlot bool
+	defer func() {
+		if !requestStart.IsZero() {
+			srv.Metrics.requestDone(0, requestStart)
+		}
+		if requestSlot {
+			config.requests.Release()
+		}
+	}()
+
 	for i := 0; true; i++ {
 		if i > 0 {
+			srv.setState(conn, ConnStateIdle)
+			rateReader.Disarm()
+
 			idleTimeout := srv.IdleTimeout
 			if idleTimeout <= 0 {
 				idleTimeout = srv.ReadTimeout
@@ -208,22 +329,59 @@ func (srv *Server) handle(ctx context.Context, conn net.Conn, handler Handler) e
 			}
 		}
 
+		var readDeadline, headDeadline time.Time
 		if srv.ReadTimeout > 0 {
-			conn.SetReadDeadline(time.Now().Add(srv.ReadTimeout))
+			readDeadline = time.Now().Add(srv.ReadTimeout)
+		}
+		headDeadline = readDeadline
+		if srv.ReadHeaderTimeout > 0 {
+			headDeadline = time.Now().Add(srv.ReadHeaderTimeout)
 		}
+		conn.SetReadDeadline(headDeadline)
+		rateReader.Arm(headDeadline)
 
-		req, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), bufioReader, srv.ReadLineMaxLength, srv.HeadMaxLength)
+		req, err = server_ops.ReadRequest(ctx, conn.RemoteAddr(), bufioReader, srv.ReadLineMaxLength, srv.HeadMaxLength, srv.StrictParsing)
 
 		if err == nil {
 			err = ctx.Err()
 		}
 		if err != nil {
+			var respErr *server_ops.ErrorResponse
+			if errors.As(err, &respErr) && respErr.Err != nil {
+				return err
+			}
+			if rateReader.Exceeded() {
+				return responseErrSlowClient
+			}
 			if !catch.IsCommonNetReadError(err) {
 				return responseErrNotProcessable
 			}
 			return err
 		}
 
+		if tlsState != nil {
+			// Each request has its own copy, so handlers cannot affect the next ones
+			state := *tlsState
+			req.TLSState = &state
+		}
+
+		// The body is read by the deadline of the whole request
+		if !headDeadline.Equal(readDeadline) {
+			controller.SetReadDeadline(readDeadline)
+		}
+
+		if len(config.trustedProxies) > 0 {
+			peer := proxy.AddrIP(req.RemoteAddr())
+			clientIP := proxy.ResolveClientIP(peer, req.Header(), srv.clientIPHeader(), config.trustedProxies)
+			if clientIP != nil && !clientIP.Equal(peer) {
+				req.SetClientAddr(&net.TCPAddr{IP: clientIP})
+			}
+		}
+
+		srv.setState(conn, ConnStateActive)
+		requestStart = time.Now()
+		srv.Metrics.requestStarted()
+
 		protoMajor, protoMinor := req.ProtoVersion()
 		isHttp11 := protoMajor == 1 && protoMinor == 1
 		var wantKeepAlive bool
@@ -245,21 +403,10 @@ func (srv *Server) handle(ctx context.Context, conn net.Conn, handler Handler) e
 			}
 		}
 
-		var selectedEncoding string
-		if acceptEncoding, has := req.Header().TryGet("Accept-Encoding"); has {
-			variants := strings.Split(acceptEncoding, ", ")
-			for _, variant := range variants {
-				if encoding.IsKnownEncoding(variant) {
-					selectedEncoding = variant
-					break
-				}
-			}
-		}
-
 		var isChunked bool
-		if req.Method().IsPostable() {
+		if req.Method().IsPostable() || srv.StrictParsing {
 			var contentLength int64
-			isChunked, contentLength, err = parsing.ParseContentLength(req.Header())
+			isChunked, contentLength, err = parsing.ParseContentLength(req.Header(), srv.StrictParsing)
 			if err != nil {
 				if errors.Is(err, parsing.ErrParsing) {
 					return responseInvalidContentLength
@@ -267,29 +414,46 @@ func (srv *Server) handle(ctx context.Context, conn net.Conn, handler Handler) e
 				if errors.Is(err, specs.ErrUnknownTransferEncoding) {
 					return responseUnsupportedTransferEncoding
 				}
+				if errors.Is(err, specs.ErrContentLengthWithTransferEncoding) || errors.Is(err, specs.ErrChunkedNotLast) {
+					return server_ops.MalformedRequestError(err)
+				}
 
 				return err
 			}
 
-			if isChunked || contentLength > 0 {
-				if srv.MaxBodySize > 0 {
-					if isChunked {
-						contentLength = srv.MaxBodySize
-					} else if contentLength > srv.MaxBodySize {
-						return responseErrBodyTooLarge
-					}
-				}
+			// The body of methods which are not expected to have it must not
+			// be left in the connection to be read as the next request
+			if !req.Method().IsPostable() && (isChunked || contentLength > 0) {
+				return server_ops.MalformedRequestError(specs.ErrUnexpectedBody)
+			}
 
+			if isChunked || contentLength > 0 {
 				var reader io.Reader = bufioReader
 				if isChunked {
-					reader = encoding.NewChunkedReader(bufioReader)
-				}
-
-				if contentLength > 0 {
+					req.ChunkedReader = encoding.NewChunkedReader(bufioReader, srv.ReadLineMaxLength, srv.HeadMaxLength)
+					reader = req.ChunkedReader
+				} else {
 					reader = io.LimitReader(reader, contentLength)
+					req.ContentLength = contentLength
 				}
 
+				// The limit is checked while reading, so handlers can raise it
+				// before the body is read (see BodyLimiter)
 				req.BodyReader = reader
+				req.MaxBodySize = srv.MaxBodySize
+
+				// The declared oversize body is rejected before the handler is called,
+				// unless the handler raises the limit for the request
+				if req.BodyTooLarge() {
+					if provider, ok := config.handler.(BodyLimitProvider); ok {
+						if size, ok := provider.BodyLimit(req); ok {
+							req.LimitBody(size)
+						}
+					}
+					if req.BodyTooLarge() {
+						return responseErrBodyTooLarge
+					}
+				}
 			}
 		}
 
@@ -297,22 +461,76 @@ func (srv *Server) handle(ctx context.Context, conn net.Conn, handler Handler) e
 			return err
 		}
 
+		var writeDeadline time.Time
 		if srv.WriteTimeout > 0 {
-			conn.SetWriteDeadline(time.Now().Add(srv.WriteTimeout))
+			writeDeadline = time.Now().Add(srv.WriteTimeout)
 		}
+		conn.SetWriteDeadline(writeDeadline)
 
 		if req.BodyReader != nil && expectContinue {
 			req.BodyReader = server_ops.ExpectContinueReader(req.BodyReader, conn)
 		}
 
-		resp := handler.Handle(ctx, req)
+		if req.BodyReader != nil {
+			contentEncoding := strings.ToLower(strings.TrimSpace(req.Header().Get("Content-Encoding")))
+			if contentEncoding != "" && contentEncoding != "identity" {
+				// The unsupported encoding is responded only if the handler reads the decoded body,
+				// so routes and proxies can take the body as is (see BodyDecoder)
+				req.SetContentEncoding(contentEncoding, !srv.DisableRequestDecoding)
+			}
+		}
+
+		if !overLimit {
+			requestSlot = srv.acquire(config.requests)
+			overLimit = !requestSlot
+		}
+		if overLimit {
+			if srv.LimitPolicy == LimitPolicyReject {
+				return srv.responseOverLimit()
+			}
+			return nil
+		}
+
+		// The request context is cancelled if the client closes the connection
+		// once the request body is consumed
+		reqCtx, cancelReq := context.WithCancelCause(ctx)
+		onClose := func() {
+			cancelReq(specs.ErrClientDisconnected)
+		}
+		if req.BodyReader == nil {
+			connReader.StartBackgroundRead(onClose)
+		} else {
+			req.BodyReader = server_ops.NotifyEOFReader(req.BodyReader, func() {
+				connReader.StartBackgroundRead(onClose)
+			})
+		}
+
+		resp := config.handler.Handle(reqCtx, req)
+
+		// The held request is still used by the handler, so its state is not checked
+		if controller.held.Load() == 0 && req.Hijacker() == nil {
+			if req.BodyTooLarge() {
+				return responseErrBodyTooLarge
+			}
+			if req.UnsupportedEncoding() {
+				return responseUnsupportedContentEncoding
+			}
+			if rateReader.Exceeded() {
+				return responseErrSlowClient
+			}
+		}
+
 		var header *specs.Header
 		var code specs.StatusCode
 		var writable BodyWriter
+		var trailer *specs.Header
 		if resp != nil {
 			header = resp.Header()
 			code = resp.StatusCode()
 			writable, _ = resp.(BodyWriter)
+			if trailerWriter, ok := resp.(TrailerWriter); ok {
+				trailer = trailerWriter.Trailer()
+			}
 		}
 		if header == nil {
 			header = specs.NewHeader()
@@ -324,11 +542,7 @@ func (srv *Server) handle(ctx context.Context, conn net.Conn, handler Handler) e
 			header.Set("Server", DefaultServerName)
 		}
 
-		header.Set("Date", time.Now().Format(specs.TimeFormat))
-
-		if selectedEncoding != "" {
-			header.Set("Content-Encoding", selectedEncoding)
-		}
+		header.Set("Date", server_ops.DateHeader(time.Now()))
 
 		var mustClose bool
 		if connHeader := header.Get("Connection"); connHeader != "" {
@@ -353,37 +567,61 @@ func (srv *Server) handle(ctx context.Context, conn net.Conn, handler Handler) e
 		}
 
 		var encodedContent []byte
+		var selectedEncoding string
+		var contentLength int64
 		mustResponseBody := req.Method().IsReplyable() && code.IsReplyable() && writable != nil
+		if mustResponseBody && srv.isEncodable(code, header) {
+			addVary(header, "Accept-Encoding")
+			if acceptEncoding, has := req.Header().TryGet("Accept-Encoding"); has {
+				selectedEncoding = encoding.Negotiate(acceptEncoding, srv.contentEncodings())
+			}
+		}
+
 		if mustResponseBody {
-			if isChunked {
+			maxEncodingSize := DefaultMaxEncodingSize
+			if srv.MaxEncodingSize > 0 {
+				maxEncodingSize = srv.MaxEncodingSize
+			}
+			contentLength = writable.ContentLength()
+
+			if isChunked || (isHttp11 && trailer != nil && trailer.Any()) {
+				isChunked = true
 				header.Set("Transfer-Encoding", "chunked")
+				header.Del("Content-Length")
 			} else if header.Get("Transfer-Encoding") == "chunked" {
 				isChunked = true
+			} else if selectedEncoding != "" && 0 < contentLength && contentLength <= maxEncodingSize {
+				var cachedBody bytes.Buffer
+				err = srv.writeBody(writable, &cachedBody, false, nil, selectedEncoding)
+				if err != nil {
+					return err
+				}
+				encodedContent = cachedBody.Bytes()
+				header.Set("Content-Length", strconv.Itoa(len(encodedContent)))
+			} else if selectedEncoding != "" && isHttp11 {
+				// Large bodies and bodies of unknown size are encoded while streaming
+				isChunked = true
+				header.Set("Transfer-Encoding", "chunked")
+				header.Del("Content-Length")
 			} else {
-				maxEncodingSize := DefaultMaxEncodingSize
-				if srv.MaxEncodingSize > 0 {
-					maxEncodingSize = srv.MaxEncodingSize
+				selectedEncoding = ""
+				if contentLength > 0 {
+					header.Set("Content-Length", strconv.FormatInt(contentLength, 10))
 				}
-				contentLength := writable.ContentLength()
+			}
 
-				if selectedEncoding != "" && contentLength <= maxEncodingSize {
-					var cachedBody bytes.Buffer
-					err = srv.writeBody(writable, &cachedBody, false, selectedEncoding)
-					if err != nil {
-						return err
-					}
-					encodedContent = cachedBody.Bytes()
-					header.Set("Content-Length", strconv.Itoa(len(encodedContent)))
-				} else {
-					selectedEncoding = ""
-					if contentLength > 0 {
-						header.Set("Content-Length", strconv.FormatInt(contentLength, 10))
-					}
-				}
+			if selectedEncoding != "" {
+				header.Set("Content-Encoding", selectedEncoding)
 			}
 		}
 
-		_, err = server_ops.WriteResponseHead(conn, isHttp11, code, header)
+		if mustResponseBody && isChunked && trailer != nil && trailer.Any() {
+			header.Set("Trailer", encoding.TrailerNames(trailer))
+		} else {
+			trailer = nil
+		}
+
+		_, err = server_ops.WriteResponseHead(bufioWriter, isHttp11, code, header)
 
 		if err != nil {
 			return err
@@ -393,36 +631,108 @@ func (srv *Server) handle(ctx context.Context, conn net.Conn, handler Handler) e
 			return err
 		}
 
+		// Bodies of the known size which fit the buffer are sent by the same write as the head,
+		// other bodies are written directly, so streamed data is not delayed by the buffer
 		if encodedContent != nil {
 			if len(encodedContent) > 0 {
-				_, err = conn.Write(encodedContent)
+				_, err = bufioWriter.Write(encodedContent)
 			}
+		} else if mustResponseBody && !isChunked && selectedEncoding == "" &&
+			0 < contentLength && contentLength <= int64(bufioWriter.Available()) {
+			err = srv.writeBody(writable, bufioWriter, false, nil, "")
 		} else if mustResponseBody {
-			err = srv.writeBody(writable, conn, isChunked, selectedEncoding)
+			if err = bufioWriter.Flush(); err == nil {
+				err = srv.writeBody(writable, conn, isChunked, trailer, selectedEncoding)
+			}
 		}
 
+		if err == nil {
+			err = bufioWriter.Flush()
+		}
 		if err != nil {
 			return err
 		}
 
+		srv.Metrics.requestDone(code, requestStart)
+		requestStart = time.Time{}
+		config.requests.Release()
+		requestSlot = false
+
+		// The response is written, so the connection can be read again
+		connReader.AbortPendingRead()
+		cancelReq(nil)
+
 		if err = ctx.Err(); err != nil {
 			return err
 		} else if hijacker := req.Hijacker(); hijacker != nil {
-			hijacker(ctx, conn)
+			srv.setState(conn, ConnStateHijacked)
+			rateReader.Disarm()
+			// The client can send data right after the request,
+			// so the data buffered by the reader is read first
+			hijacker(ctx, stream.BufferedConn(connReader.HijackConn(), bufioReader))
 			break
 		} else if mustClose {
 			break
 		} else if req.Method() != specs.HttpMethodHead && writable == nil && code.IsReplyable() {
 			break
 		}
+
+		controller.holds.Wait()
+		server_ops.ReleaseRequest(req)
+		req = nil
 	}
 
 	return nil
 }
 
-func (srv *Server) writeBody(writable BodyWriter, writer io.Writer, chunked bool, contentEncoding string) error {
+func (srv *Server) clientIPHeader() string {
+	if srv.ClientIPHeader != "" {
+		return srv.ClientIPHeader
+	}
+	return "X-Forwarded-For"
+}
+
+// isEncodable reports whether the response body can be encoded by the server,
+// already encoded content and byte ranges must be sent as is.
+func (srv *Server) isEncodable(code specs.StatusCode, header *specs.Header) bool {
+	if srv.DisableCompression || code == specs.StatusCodePartialContent || header.Has("Content-Encoding") {
+		return false
+	}
+
+	contentTypes := srv.EncodingContentTypes
+	if contentTypes == nil {
+		contentTypes = DefaultEncodingContentTypes
+	}
+	return encoding.MatchContentType(header.Get("Content-Type"), contentTypes)
+}
+
+func (srv *Server) contentEncodings() []string {
+	if srv.ContentEncodings != nil {
+		return srv.ContentEncodings
+	}
+	return DefaultContentEncodings
+}
+
+// addVary appends the header name to the "Vary" header if it is not listed yet.
+func addVary(header *specs.Header, name string) {
+	vary := header.Get("Vary")
+	if vary == "" {
+		header.Set("Vary", name)
+		return
+	}
+
+	for _, listed := range strings.Split(vary, ",") {
+		listed = strings.TrimSpace(listed)
+		if listed == "*" || strings.EqualFold(listed, name) {
+			return
+		}
+	}
+	header.Set("Vary", vary+", "+name)
+}
+
+func (srv *Server) writeBody(writable BodyWriter, writer io.Writer, chunked bool, trailer *specs.Header, contentEncoding string) error {
 	if chunked {
-		chw := encoding.NewChunkedWriter(writer)
+		chw := encoding.NewChunkedTrailerWriter(writer, trailer)
 		defer chw.Close()
 		writer = chw
 	}
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/oesand/plow/internal/workers"
 	"github.com/oesand/plow/specs"
 )
 
@@ -61,6 +62,46 @@ type Server struct {
 	// Returns true - accept, false - close connection
 	FilterConn func(addr net.Addr) bool
 
+	// ConnState specifies an optional callback function that is
+	// called when a client connection changes state, see [ConnState].
+	// The connection is the one passed to handlers, such as [tls.Conn] for TLS.
+	//
+	// It must be safe for concurrent use, as it is called
+	// from the goroutines of the connections.
+	ConnState func(conn net.Conn, state ConnState)
+
+	// Metrics optionally collects counters and histograms of the server
+	// connections and requests, see [NewServerMetrics].
+	Metrics *ServerMetrics
+
+	// ProxyProtocolTrusted enables the PROXY protocol (v1 and v2) for connections
+	// from the listed IP addresses or CIDR ranges of TCP load balancers, such as "10.0.0.0/8".
+	//
+	// Connections from these addresses must start with the PROXY protocol header,
+	// the original client address of the header is passed to FilterConn, the ErrorHandler conn
+	// and reported by Request.RemoteAddr, the header itself is available by [ProxyProtocolHeaderFromContext].
+	// Connections from other addresses are served as is.
+	//
+	// The header is read before the TLS handshake, so TLS must be served
+	// by [Server.ServeTLS] instead of the listener wrapped by the caller.
+	// The header must be received within ReadHeaderTimeout, or ReadTimeout if it is zero,
+	// or 5 seconds if both are zero.
+	ProxyProtocolTrusted []string
+
+	// TrustedProxies lists IP addresses or CIDR ranges of trusted L7 proxies, such as "10.0.0.0/8".
+	//
+	// If the request is received from a trusted proxy, Request.RemoteAddr reports the client address
+	// resolved by the ClientIPHeader with zero port. Hops of the header are walked from the nearest one
+	// while they are trusted, so addresses prepended by the client cannot spoof it.
+	// The address of the proxy itself is available by [PeerAddr].
+	TrustedProxies []string
+
+	// ClientIPHeader specifies the header of the client address set by trusted proxies,
+	// such as "X-Forwarded-For", "X-Real-IP" or "Forwarded" (RFC 7239).
+	//
+	// If empty, "X-Forwarded-For" is used.
+	ClientIPHeader string
+
 	// ServerName for sending in response headers.
 	ServerName string
 
@@ -74,11 +115,21 @@ type Server struct {
 	// ReadTimeout is the maximum duration for server the entire
 	// request, including the body. A zero or negative value means
 	// there will be no timeout.
+	//
+	// The deadline can be changed per request with [RequestController].
 	ReadTimeout time.Duration
 
+	// ReadHeaderTimeout is the maximum duration for reading the request head,
+	// so it may be shorter than ReadTimeout which still applies to the body.
+	//
+	// If zero, the value of ReadTimeout is used.
+	ReadHeaderTimeout time.Duration
+
 	// WriteTimeout is the maximum duration before timing out
 	// writes of the response. A zero or negative value means
 	// there will be no timeout.
+	//
+	// The deadline can be changed per request with [RequestController].
 	WriteTimeout time.Duration
 
 	// IdleTimeout is the maximum amount of time to wait for the
@@ -89,6 +140,57 @@ type Server struct {
 	// is zero or negative, there is no timeout.
 	IdleTimeout time.Duration
 
+	// MinReadRate is the minimum rate in bytes per second the client must send
+	// the request head and body at, so slow clients cannot hold connections within ReadTimeout.
+	// Only the time waiting for the client data is accounted, not the time of the handler.
+	//
+	// Slower requests are responded with 408 "Request Timeout" and
+	// [specs.ErrSlowClient] is passed to the [ErrorHandler].
+	//
+	// If zero there is no limit
+	MinReadRate int64
+
+	// MinReadRateGrace is the time the client may send slower than MinReadRate
+	// at the start of each request.
+	//
+	// If zero, one second is used.
+	MinReadRateGrace time.Duration
+
+	// MaxConns limits the number of connections served at the same time,
+	// connections over the limit are handled by the LimitPolicy.
+	//
+	// If zero there is no limit
+	MaxConns int
+
+	// MaxConnsPerIP limits the number of connections served at the same time
+	// from a single client IP address, connections over the limit are handled by the LimitPolicy.
+	// The address is the one reported by the PROXY protocol, see ProxyProtocolTrusted.
+	//
+	// If zero there is no limit
+	MaxConnsPerIP int
+
+	// MaxConcurrentRequests limits the number of requests handled at the same time,
+	// requests over the limit are handled by the LimitPolicy.
+	//
+	// If zero there is no limit
+	MaxConcurrentRequests int
+
+	// LimitPolicy specifies how connections and requests over the limits are handled,
+	// by default they are refused, see [LimitPolicy].
+	LimitPolicy LimitPolicy
+
+	// LimitQueueTimeout is the maximum time to wait for the free slot
+	// with [LimitPolicyQueue].
+	//
+	// If zero there is no timeout.
+	LimitQueueTimeout time.Duration
+
+	// LimitRetryAfter is the time sent in the "Retry-After" header
+	// with [LimitPolicyReject], it is rounded up to seconds.
+	//
+	// If zero, one second is used.
+	LimitRetryAfter time.Duration
+
 	// ReadLineMaxLength maximum size in bytes
 	// to read lines in the request
 	// such as headers and headlines
@@ -106,19 +208,71 @@ type Server struct {
 	// MaxBodySize maximum size in bytes
 	// to read request body size.
 	//
-	// The server responds ErrTooLarge if this limit is greater than 0
-	// and response body is greater than the limit.
+	// If this limit is greater than 0, reading of a larger body
+	// fails with [specs.ErrTooLarge], the server responds
+	// 413 "Request Entity Too Large" and closes the connection.
+	// The limit can be overridden per request with [BodyLimiter].
+	//
+	// Requests which declare a larger body by "Content-Length" are responded
+	// before the handler is called, unless the handler raises the limit
+	// for them by [BodyLimitProvider].
 	//
 	// By default, request body size is unlimited.
+	//
+	// For bodies decoded by the "Content-Encoding" header
+	// the limit is also applied to the decoded size.
 	MaxBodySize int64
 
+	// DisableRequestDecoding disables transparent decoding of request bodies
+	// by the "Content-Encoding" header, so handlers receive bodies as is.
+	//
+	// When decoding is enabled, reading of bodies with unsupported encodings fails
+	// with [specs.ErrUnknownContentEncoding] and the server responds 415 "Unsupported Media Type".
+	// Decoding can be switched per request with [BodyDecoder] before the body is read,
+	// proxies which forward bodies of any encoding should disable it.
+	DisableRequestDecoding bool
+
 	// MaxEncodingSize maximum size in bytes
-	// of the response body that will be encoded (based on the "Accept-Encoding" header)
-	// when transfer by size - "Content-Length", except { "Transfer-Encoding": "chunked" }
+	// of the response body that will be encoded in memory (based on the "Accept-Encoding" header)
+	// to transfer by size - "Content-Length".
 	//
-	// if not specified, the encoding will be skipped
+	// Larger bodies and bodies of unknown size are encoded while streaming
+	// with { "Transfer-Encoding": "chunked" } or sent as is for HTTP/1.0 clients.
+	//
+	// If zero, [DefaultMaxEncodingSize] is used.
 	MaxEncodingSize int64
 
+	// ContentEncodings specifies supported content encodings in the server preferred order,
+	// it is negotiated with the "Accept-Encoding" header with respect of quality values.
+	//
+	// If nil, [DefaultContentEncodings] is used.
+	ContentEncodings []string
+
+	// EncodingContentTypes specifies media types of response bodies that can be encoded,
+	// such as "application/json" or "text/*" for any subtype.
+	// Bodies of other types, such as already compressed images or archives, are sent as is.
+	//
+	// If nil, [DefaultEncodingContentTypes] is used.
+	EncodingContentTypes []string
+
+	// DisableCompression disables encoding of response bodies.
+	DisableCompression bool
+
+	// StrictParsing rejects requests with 400 "Bad Request" if the message head
+	// may be interpreted differently by intermediaries, which is used for request smuggling:
+	//   - both "Content-Length" and "Transfer-Encoding" headers
+	//   - duplicate or conflicting "Content-Length" values
+	//   - "Transfer-Encoding" list where "chunked" is not the last
+	//   - obsolete line folding of header fields
+	//   - whitespace between header field name and colon
+	//   - invalid bytes of header field name or value
+	//   - lines terminated by bare LF instead of CRLF
+	//   - body of request methods which do not expect it, such as GET
+	//
+	// The distinct cause, such as [specs.ErrBareLineFeed], is passed to the [ErrorHandler].
+	// It is disabled by default, enable it for servers behind proxies or load balancers.
+	StrictParsing bool
+
 	// DisableKeepAlive controls whether HTTP keep-alive are enabled.
 	//
 	// Only very resource-constrained environments or servers in the process of
@@ -132,12 +286,16 @@ type Server struct {
 	listenerTrack sync.WaitGroup
 	shuttingDown  chan struct{}
 
+	// workers serve connections and background reads of requests
+	workers *workers.Pool
+
 	mutex sync.Mutex
 	once  sync.Once
 }
 
 func (srv *Server) beforeOnce() {
 	srv.shuttingDown = make(chan struct{})
+	srv.workers = workers.NewPool(0)
 }
 
 // TLSHasNextProto checks if a handler function is specified
@@ -297,6 +455,64 @@ func (srv *Server) serveTLSRaw(lst net.Listener, cert *tls.Certificate) error {
 		return specs.ErrClosed
 	}
 
+	config := srv.tlsConfig()
+	configHasCert := len(config.Certificates) > 0 || config.GetCertificate != nil
+	if !configHasCert {
+		config.Certificates = make([]tls.Certificate, 1)
+		config.Certificates[0] = *cert
+	}
+
+	// The handshake is done by the connection goroutine
+	// after the PROXY protocol header is read
+	return srv.serve(lst, config)
+}
+
+// ListenAndServeTLSStore listens on the TCP network address and then
+// calls [Server.ServeTLSStore] to handle requests on incoming connections.
+//
+// If addr is blank, ":https" is used.
+//
+// ListenAndServeTLSStore always returns a non-nil error.
+// After [Server.Shutdown], the returned error is [specs.ErrClosed].
+func (srv *Server) ListenAndServeTLSStore(addr string, store *CertStore) error {
+	if srv.IsShutdown() {
+		return specs.ErrClosed
+	} else if addr == "" {
+		addr = ":https"
+	}
+	lst, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return err
+	}
+	return srv.ServeTLSStore(lst, store)
+}
+
+// ServeTLSStore accepts incoming connections on the [net.Listener], creating a
+// new service goroutine for each. The service goroutines perform TLS
+// setup and then read requests, calling [Server.Handler] to reply to them.
+//
+// Certificates are selected by the [CertStore] for each handshake,
+// so the certificates reloaded by the store are used by new connections without a restart.
+// The store takes precedence over certificates of the [Server.TLSConfig].
+//
+// ServeTLSStore always returns a non-nil error.
+// After [Server.Shutdown], the returned error is [specs.ErrClosed].
+func (srv *Server) ServeTLSStore(lst net.Listener, store *CertStore) error {
+	if srv.IsShutdown() {
+		return specs.ErrClosed
+	} else if store == nil {
+		return errors.New("plow: nil certificate store")
+	}
+
+	config := srv.tlsConfig()
+	config.Certificates = nil
+	config.GetCertificate = store.GetCertificate
+
+	return srv.serve(lst, config)
+}
+
+// tlsConfig clones the [Server.TLSConfig] and enables the HTTP/1.1 protocol negotiation.
+func (srv *Server) tlsConfig() *tls.Config {
 	var config *tls.Config
 	if srv.TLSConfig != nil {
 		config = srv.TLSConfig.Clone()
@@ -307,15 +523,7 @@ func (srv *Server) serveTLSRaw(lst net.Listener, cert *tls.Certificate) error {
 	if !slices.Contains(config.NextProtos, httpV1NextProtoTLS) {
 		config.NextProtos = append(config.NextProtos, httpV1NextProtoTLS)
 	}
-
-	configHasCert := len(config.Certificates) > 0 || config.GetCertificate != nil
-	if !configHasCert {
-		config.Certificates = make([]tls.Certificate, 1)
-		config.Certificates[0] = *cert
-	}
-
-	listener := tls.NewListener(lst, config)
-	return srv.Serve(listener)
+	return config
 }
 
 // IsShutdown checks if the server is shutting down
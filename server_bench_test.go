@@ -0,0 +1,108 @@
+package plow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/oesand/plow/specs"
+)
+
+// benchmarkServer measures requests sent one by one over the keep-alive connection,
+// allocations of the client are excluded as it only writes and reads raw bytes.
+func benchmarkServer(b *testing.B, handler Handler, request []byte) {
+	server := DefaultServer(handler)
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	go server.Serve(listener)
+	defer server.Shutdown()
+
+	conn, err := net.Dial("tcp4", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The length of responses is the same as the first one,
+	// the "Date" header has the fixed length
+	if _, err = conn.Write(request); err != nil {
+		b.Fatal(err)
+	}
+	responseSize := readBenchResponseSize(b, conn)
+	response := make([]byte, responseSize)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err = conn.Write(request); err != nil {
+			b.Fatal(err)
+		}
+		if _, err = io.ReadFull(conn, response); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func readBenchResponseSize(b *testing.B, conn net.Conn) int {
+	reader := bufio.NewReader(conn)
+	var size int
+	var contentLength int
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err != nil {
+			b.Fatal(err)
+		}
+		size += len(line)
+		if name, value, ok := bytes.Cut(bytes.TrimSpace(line), []byte(": ")); ok && string(name) == "Content-Length" {
+			for _, c := range value {
+				contentLength = contentLength*10 + int(c-'0')
+			}
+		}
+		if len(line) == 2 {
+			break
+		}
+	}
+	if _, err := reader.Discard(contentLength); err != nil {
+		b.Fatal(err)
+	}
+	if reader.Buffered() > 0 {
+		b.Fatal("unexpected data after the response")
+	}
+	return size + contentLength
+}
+
+func BenchmarkServer_Get(b *testing.B) {
+	handler := HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "Hello, World!")
+	})
+	request := []byte("GET /hello HTTP/1.1\r\nHost: localhost\r\nUser-Agent: bench\r\nAccept: */*\r\n\r\n")
+
+	benchmarkServer(b, handler, request)
+}
+
+func BenchmarkServer_Post(b *testing.B) {
+	handler := HandlerFunc(func(ctx context.Context, request Request) Response {
+		io.Copy(io.Discard, request.Body())
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypeJson, `{"ok":true}`)
+	})
+	body := `{"name":"plow","tags":["http","server"]}`
+	request := []byte("POST /items HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\n" +
+		"Content-Length: 40\r\n\r\n" + body)
+
+	benchmarkServer(b, handler, request)
+}
+
+func BenchmarkServer_Empty(b *testing.B) {
+	handler := HandlerFunc(func(ctx context.Context, request Request) Response {
+		return EmptyResponse(specs.StatusCodeNoContent)
+	})
+	request := []byte("GET /ping HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	benchmarkServer(b, handler, request)
+}
@@ -0,0 +1,82 @@
+package plow
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/oesand/plow/internal/limit"
+	"github.com/oesand/plow/internal/proxy"
+	"github.com/oesand/plow/internal/server_ops"
+	"github.com/oesand/plow/specs"
+)
+
+// LimitPolicy specifies how the [Server] handles connections and requests over the limits,
+// see [Server.MaxConns], [Server.MaxConnsPerIP] and [Server.MaxConcurrentRequests].
+type LimitPolicy int
+
+const (
+	// LimitPolicyRefuse closes the connection over the limits right after accept
+	// and the connection of the request over the limit without response.
+	LimitPolicyRefuse LimitPolicy = iota
+
+	// LimitPolicyQueue waits for the free slot up to [Server.LimitQueueTimeout],
+	// then the connection is closed.
+	LimitPolicyQueue
+
+	// LimitPolicyReject responds 503 "Service Unavailable" with the "Retry-After" header
+	// of [Server.LimitRetryAfter] and closes the connection.
+	//
+	// The connection over the limits is served to read the first request,
+	// but it is not counted against the limits.
+	LimitPolicyReject
+)
+
+// serveConfig holds the values prepared once by the serve loop for all its connections.
+type serveConfig struct {
+	handler        Handler
+	trustedProxies proxy.Networks
+	conns          limit.Semaphore
+	connsPerIP     *limit.KeyedSemaphore
+	requests       limit.Semaphore
+}
+
+// acquire takes the slot of the semaphore by the [Server.LimitPolicy].
+func (srv *Server) acquire(semaphore limit.Semaphore) bool {
+	if srv.LimitPolicy == LimitPolicyQueue {
+		return semaphore.Acquire(srv.shuttingDown, srv.LimitQueueTimeout)
+	}
+	return semaphore.TryAcquire()
+}
+
+// acquireIP takes the slot of the client IP of the connection by the [Server.LimitPolicy],
+// returns the key to release or empty if the connection has no IP address.
+func (srv *Server) acquireIP(semaphore *limit.KeyedSemaphore, addr net.Addr) (string, bool) {
+	ip := proxy.AddrIP(addr)
+	if semaphore == nil || ip == nil {
+		return "", true
+	}
+
+	key := ip.String()
+	if srv.LimitPolicy == LimitPolicyQueue {
+		return key, semaphore.Acquire(key, srv.shuttingDown, srv.LimitQueueTimeout)
+	}
+	return key, semaphore.TryAcquire(key)
+}
+
+// responseOverLimit returns 503 "Service Unavailable" response with the "Retry-After" header.
+func (srv *Server) responseOverLimit() *server_ops.ErrorResponse {
+	retryAfter := srv.LimitRetryAfter
+	if retryAfter <= 0 {
+		retryAfter = time.Second
+	}
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+
+	return &server_ops.ErrorResponse{
+		Code: specs.StatusCodeServiceUnavailable,
+		Text: "http: server is busy",
+		Header: specs.NewHeader(func(header *specs.Header) {
+			header.Set("Retry-After", strconv.FormatInt(seconds, 10))
+		}),
+	}
+}
@@ -0,0 +1,194 @@
+package plow
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/oesand/plow/specs"
+)
+
+func serveLimited(t *testing.T, server *Server) string {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	return listener.Addr().String()
+}
+
+// openLimitedConn sends the keep-alive request and returns the connection with the response,
+// or nil response if the connection was closed by the server.
+func openLimitedConn(t *testing.T, addr string) (net.Conn, *http.Response) {
+	conn, err := net.Dial("tcp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return conn, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return conn, resp
+}
+
+func okayServer() *Server {
+	return DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+}
+
+func TestServer_MaxConnsRefuse(t *testing.T) {
+	server := okayServer()
+	server.MaxConns = 1
+	addr := serveLimited(t, server)
+
+	if _, resp := openLimitedConn(t, addr); resp == nil || resp.StatusCode != 200 {
+		t.Fatal("expected first connection to be served")
+	}
+	if _, resp := openLimitedConn(t, addr); resp != nil {
+		t.Fatalf("expected second connection to be refused, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_MaxConnsQueue(t *testing.T) {
+	server := okayServer()
+	server.MaxConns = 1
+	server.LimitPolicy = LimitPolicyQueue
+	server.LimitQueueTimeout = 2 * time.Second
+	addr := serveLimited(t, server)
+
+	conn, resp := openLimitedConn(t, addr)
+	if resp == nil {
+		t.Fatal("expected first connection to be served")
+	}
+	time.AfterFunc(100*time.Millisecond, func() { conn.Close() })
+
+	if _, resp := openLimitedConn(t, addr); resp == nil || resp.StatusCode != 200 {
+		t.Fatal("expected queued connection to be served")
+	}
+}
+
+func TestServer_MaxConnsPerIPReject(t *testing.T) {
+	server := okayServer()
+	server.MaxConnsPerIP = 1
+	server.LimitPolicy = LimitPolicyReject
+	server.LimitRetryAfter = 2500 * time.Millisecond
+	addr := serveLimited(t, server)
+
+	if _, resp := openLimitedConn(t, addr); resp == nil || resp.StatusCode != 200 {
+		t.Fatal("expected first connection to be served")
+	}
+
+	_, resp := openLimitedConn(t, addr)
+	if resp == nil || resp.StatusCode != 503 {
+		t.Fatal("expected 503 response")
+	}
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "3" {
+		t.Errorf("unexpected Retry-After %q", retryAfter)
+	}
+}
+
+func TestServer_MaxConcurrentRequestsReject(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		if request.Url().Path == "/slow" {
+			close(started)
+			<-release
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+	server.MaxConcurrentRequests = 1
+	server.LimitPolicy = LimitPolicyReject
+	addr := serveLimited(t, server)
+
+	slowResp := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			t.Error("req:", err)
+		}
+		slowResp <- resp
+	}()
+	<-started
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("expected 503 with Retry-After, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	close(release)
+	if resp := <-slowResp; resp != nil {
+		checkHttpResponseBody(t, resp, []byte("okay"))
+	}
+}
+
+func TestServer_MinReadRate(t *testing.T) {
+	handledErrors := make(chan error, 1)
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		if body := request.Body(); body != nil {
+			io.Copy(io.Discard, body)
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+	server.MinReadRate = 100
+	server.MinReadRateGrace = 100 * time.Millisecond
+	server.ErrorHandler = ErrorHandlerFunc(func(ctx context.Context, conn net.Conn, err any) {
+		handledErrors <- err.(error)
+	})
+	addr := serveLimited(t, server)
+
+	t.Run("Fast", func(t *testing.T) {
+		if _, resp := openLimitedConn(t, addr); resp == nil || resp.StatusCode != 200 {
+			t.Fatal("expected request to be served")
+		}
+	})
+
+	for _, tt := range []struct {
+		name string
+		head string
+	}{
+		{"Slow head", "GET / HTTP/1.1\r\n"},
+		{"Slow body", "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 100\r\n\r\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp4", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			conn.Write([]byte(tt.head))
+			for i := 0; i < 5; i++ {
+				time.Sleep(100 * time.Millisecond)
+				if _, err := conn.Write([]byte("x")); err != nil {
+					break
+				}
+			}
+
+			select {
+			case err := <-handledErrors:
+				if !errors.Is(err, specs.ErrSlowClient) {
+					t.Errorf("expected ErrSlowClient, got %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("slow client is not detected")
+			}
+		})
+	}
+}
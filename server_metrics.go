@@ -0,0 +1,142 @@
+package plow
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/oesand/plow/internal/metrics"
+	"github.com/oesand/plow/specs"
+)
+
+// NewServerMetrics creates [ServerMetrics] for the [Server.Metrics].
+func NewServerMetrics() *ServerMetrics {
+	return &ServerMetrics{}
+}
+
+// ServerMetrics collects counters and histograms of connections and requests of the [Server].
+// It can be shared by several servers to collect their total values.
+// The zero value is ready to use.
+//
+// ServerMetrics is the [Handler] which exposes the metrics
+// in the Prometheus text exposition format, so it can be routed as "/metrics".
+type ServerMetrics struct {
+	accepted     metrics.Counter
+	filtered     metrics.Counter
+	refused      metrics.Counter
+	tlsFailures  metrics.Counter
+	bytesRead    metrics.Counter
+	bytesWritten metrics.Counter
+	active       metrics.Gauge
+	inFlight     metrics.Gauge
+
+	// durations by status class from 1xx to 5xx, created on the first use
+	durations     [5]*metrics.Histogram
+	durationsOnce sync.Once
+}
+
+func (m *ServerMetrics) histograms() *[5]*metrics.Histogram {
+	m.durationsOnce.Do(func() {
+		for i := range m.durations {
+			m.durations[i] = metrics.NewHistogram(metrics.DefaultBuckets)
+		}
+	})
+	return &m.durations
+}
+
+// Handle writes the metrics in the Prometheus text exposition format.
+func (m *ServerMetrics) Handle(_ context.Context, _ Request) Response {
+	var buf bytes.Buffer
+
+	m.writeCounter(&buf, "plow_connections_accepted_total", "Total number of accepted connections.", &m.accepted)
+	m.writeCounter(&buf, "plow_connections_filtered_total", "Total number of connections rejected by the filter.", &m.filtered)
+	m.writeCounter(&buf, "plow_connections_refused_total", "Total number of connections refused by the limits.", &m.refused)
+	m.writeGauge(&buf, "plow_connections_active", "Number of open connections.", &m.active)
+	m.writeGauge(&buf, "plow_requests_in_flight", "Number of requests being handled.", &m.inFlight)
+
+	metrics.WriteHeader(&buf, "plow_request_duration_seconds", "Duration of handled requests by status class.", metrics.TypeHistogram)
+	for i, histogram := range m.histograms() {
+		class := string(rune('1'+i)) + "xx"
+		metrics.WriteHistogram(&buf, "plow_request_duration_seconds", histogram, "class", class)
+	}
+
+	m.writeCounter(&buf, "plow_read_bytes_total", "Total number of bytes read from connections.", &m.bytesRead)
+	m.writeCounter(&buf, "plow_written_bytes_total", "Total number of bytes written to connections.", &m.bytesWritten)
+	m.writeCounter(&buf, "plow_tls_handshake_failures_total", "Total number of failed TLS handshakes.", &m.tlsFailures)
+
+	return BufferResponse(specs.StatusCodeOK, metrics.ContentType, buf.Bytes())
+}
+
+func (m *ServerMetrics) writeCounter(buf *bytes.Buffer, name, help string, counter *metrics.Counter) {
+	metrics.WriteHeader(buf, name, help, metrics.TypeCounter)
+	metrics.WriteSample(buf, name, float64(counter.Value()))
+}
+
+func (m *ServerMetrics) writeGauge(buf *bytes.Buffer, name, help string, gauge *metrics.Gauge) {
+	metrics.WriteHeader(buf, name, help, metrics.TypeGauge)
+	metrics.WriteSample(buf, name, float64(gauge.Value()))
+}
+
+func (m *ServerMetrics) connAccepted() {
+	if m != nil {
+		m.accepted.Inc()
+	}
+}
+
+// countConn returns the connection which counts bytes read and written.
+func (m *ServerMetrics) countConn(conn net.Conn) net.Conn {
+	if m == nil {
+		return conn
+	}
+	return metrics.NewCountingConn(conn, &m.bytesRead, &m.bytesWritten)
+}
+
+func (m *ServerMetrics) connFiltered() {
+	if m != nil {
+		m.filtered.Inc()
+	}
+}
+
+func (m *ServerMetrics) connRefused() {
+	if m != nil {
+		m.refused.Inc()
+	}
+}
+
+func (m *ServerMetrics) connState(state ConnState) {
+	if m == nil {
+		return
+	}
+	switch state {
+	case ConnStateNew:
+		m.active.Add(1)
+	case ConnStateClosed:
+		m.active.Add(-1)
+	}
+}
+
+func (m *ServerMetrics) tlsHandshakeFailed() {
+	if m != nil {
+		m.tlsFailures.Inc()
+	}
+}
+
+func (m *ServerMetrics) requestStarted() {
+	if m != nil {
+		m.inFlight.Add(1)
+	}
+}
+
+// requestDone observes the duration of the request responded with the code,
+// the duration of failed requests of zero code is not observed.
+func (m *ServerMetrics) requestDone(code specs.StatusCode, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Add(-1)
+	if class := int(code) / 100; 1 <= class && class <= len(m.durations) {
+		m.histograms()[class-1].ObserveDuration(time.Since(start))
+	}
+}
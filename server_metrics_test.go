@@ -0,0 +1,141 @@
+package plow
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oesand/plow/internal/testing_ops"
+	"github.com/oesand/plow/specs"
+)
+
+func TestServerMetrics(t *testing.T) {
+	metrics := NewServerMetrics()
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		if request.Url().Path == "/missing" {
+			return TextResponse(specs.StatusCodeNotFound, specs.ContentTypePlain, "missing")
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+	server.Metrics = metrics
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for _, path := range []string{"/", "/", "/missing"} {
+		resp, err := client.Get("http://" + listener.Addr().String() + path)
+		if err != nil {
+			t.Fatal("req:", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	resp := metrics.Handle(context.Background(), nil)
+	if contentType := resp.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", contentType)
+	}
+
+	var body strings.Builder
+	resp.(BodyWriter).WriteBody(&body)
+	exposition := body.String()
+
+	for _, line := range []string{
+		"# TYPE plow_connections_accepted_total counter\nplow_connections_accepted_total 3\n",
+		"plow_connections_filtered_total 0\n",
+		"plow_requests_in_flight 0\n",
+		"# TYPE plow_request_duration_seconds histogram\n",
+		"plow_request_duration_seconds_count{class=\"2xx\"} 2\n",
+		"plow_request_duration_seconds_count{class=\"4xx\"} 1\n",
+		"plow_request_duration_seconds_bucket{class=\"5xx\",le=\"+Inf\"} 0\n",
+		"plow_tls_handshake_failures_total 0\n",
+	} {
+		if !strings.Contains(exposition, line) {
+			t.Errorf("exposition does not contain %q:\n%s", line, exposition)
+		}
+	}
+	if metrics.bytesRead.Value() == 0 || metrics.bytesWritten.Value() == 0 {
+		t.Errorf("bytes are not counted, read %d, written %d", metrics.bytesRead.Value(), metrics.bytesWritten.Value())
+	}
+}
+
+func TestServerMetrics_FilteredAndTLSFailures(t *testing.T) {
+	metrics := NewServerMetrics()
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+	server.Metrics = metrics
+
+	var filterCalls atomic.Int32
+	server.FilterConn = func(addr net.Addr) bool {
+		return filterCalls.Add(1) > 1
+	}
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLSRaw(listener, testing_ops.NewTlsCert())
+
+	// The first connection is filtered, the second one fails the handshake
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp4", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: "example.com"})
+		if err = tlsConn.Handshake(); err == nil {
+			t.Error("expected handshake error")
+		}
+		conn.Close()
+	}
+
+	// The server may not complete the failed handshake yet
+	for i := 0; i < 100 && metrics.tlsFailures.Value() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if metrics.filtered.Value() != 1 {
+		t.Errorf("expected 1 filtered connection, got %d", metrics.filtered.Value())
+	}
+	if metrics.tlsFailures.Value() != 1 {
+		t.Errorf("expected 1 handshake failure, got %d", metrics.tlsFailures.Value())
+	}
+}
+
+func TestServerMetrics_ZeroValue(t *testing.T) {
+	metrics := &ServerMetrics{}
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+	server.Metrics = metrics
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	resp, err := http.Get("http://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	var body strings.Builder
+	metrics.Handle(context.Background(), nil).(BodyWriter).WriteBody(&body)
+	if !strings.Contains(body.String(), "plow_request_duration_seconds_count{class=\"2xx\"} 1\n") {
+		t.Errorf("duration is not observed:\n%s", body.String())
+	}
+}
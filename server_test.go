@@ -7,6 +7,8 @@ import (
 	"compress/zlib"
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"github.com/andybalholm/brotli"
 	"github.com/oesand/plow/internal/client_ops"
 	"github.com/oesand/plow/internal/encoding"
@@ -217,7 +219,7 @@ func TestServer_ChunkedTransferEncodingTwoWays(t *testing.T) {
 
 	defer body.Close()
 
-	reader := encoding.NewChunkedReader(bufio.NewReader(body))
+	reader := encoding.NewChunkedReader(bufio.NewReader(body), 0, 0)
 	data, err := io.ReadAll(reader)
 	if err != nil {
 		t.Fatal("read all:", err)
@@ -273,7 +275,7 @@ func TestServer_ChunkedTransferEncodingResponse(t *testing.T) {
 
 	defer body.Close()
 
-	reader := encoding.NewChunkedReader(bufio.NewReader(body))
+	reader := encoding.NewChunkedReader(bufio.NewReader(body), 0, 0)
 	data, err := io.ReadAll(reader)
 	if err != nil {
 		t.Fatal("read all:", err)
@@ -284,6 +286,59 @@ func TestServer_ChunkedTransferEncodingResponse(t *testing.T) {
 	}
 }
 
+func TestServer_ChunkedTrailerTwoWays(t *testing.T) {
+	requestBody := []byte("request streamed")
+
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		data, err := io.ReadAll(request.Body())
+		if err != nil {
+			t.Fatal("read all:", err)
+		}
+
+		if !bytes.Equal(data, requestBody) {
+			t.Error("invalid request body:", string(data))
+		}
+		if trailer := Trailer(request); trailer == nil || trailer.Get("X-Checksum") != "req-123" {
+			t.Errorf("not found expected request trailer, %+v", trailer)
+		}
+
+		resp := StreamResponse(specs.StatusCodeOK, specs.ContentTypePlain, bytes.NewReader([]byte("response streamed")), 0)
+		resp.(TrailerWriter).Trailer().Set("X-Checksum", "resp-123")
+		return resp
+	}))
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	url := "http://" + listener.Addr().String()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	req, _ := http.NewRequest("POST", url, io.NopCloser(bytes.NewReader(requestBody)))
+	req.ContentLength = -1
+	req.Trailer = http.Header{"X-Checksum": {"req-123"}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	if len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("invalid transfer encoding %+v", resp.TransferEncoding)
+	}
+
+	if _, has := resp.Trailer["X-Checksum"]; !has {
+		t.Errorf("not found expected declared trailer, %+v", resp.Trailer)
+	}
+
+	checkHttpResponseBody(t, resp, []byte("response streamed"))
+
+	if resp.Trailer.Get("X-Checksum") != "resp-123" {
+		t.Errorf("not found expected trailer, %+v", resp.Trailer)
+	}
+}
+
 // Test content encoding
 
 func TestServer_GzipEncoding(t *testing.T) {
@@ -524,7 +579,7 @@ func TestServer_GzipEncodingAndChunkedTransferEncoding(t *testing.T) {
 
 	defer body.Close()
 
-	reader := encoding.NewChunkedReader(bufio.NewReader(body))
+	var reader io.Reader = encoding.NewChunkedReader(bufio.NewReader(body), 0, 0)
 	reader, err = gzip.NewReader(reader)
 	if err != nil {
 		t.Fatalf("encoder err: %s", err)
@@ -586,7 +641,7 @@ func TestServer_DeflateEncodingAndChunkedTransferEncoding(t *testing.T) {
 
 	defer body.Close()
 
-	reader := encoding.NewChunkedReader(bufio.NewReader(body))
+	var reader io.Reader = encoding.NewChunkedReader(bufio.NewReader(body), 0, 0)
 	reader, err = zlib.NewReader(reader)
 	if err != nil {
 		t.Fatalf("encoder err: %s", err)
@@ -648,7 +703,7 @@ func TestServer_BrotliEncodingAndChunkedTransferEncoding(t *testing.T) {
 
 	defer body.Close()
 
-	reader := encoding.NewChunkedReader(bufio.NewReader(body))
+	var reader io.Reader = encoding.NewChunkedReader(bufio.NewReader(body), 0, 0)
 	reader = brotli.NewReader(reader)
 
 	data, err := io.ReadAll(reader)
@@ -698,6 +753,258 @@ func TestServer_GzipEncodingAndChunkedTransferEncoding_ByHttpTestClient(t *testi
 	checkHttpResponseBody(t, resp, []byte("response encoded"))
 }
 
+func newEncodingTestServer(t *testing.T, configure func(*Server), handler func(request Request) Response) string {
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return handler(request)
+	}))
+	if configure != nil {
+		configure(server)
+	}
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	return "http://" + listener.Addr().String()
+}
+
+func TestServer_EncodingNegotiation(t *testing.T) {
+	url := newEncodingTestServer(t, nil, func(request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "negotiated")
+	})
+
+	tests := []struct {
+		acceptEncoding  string
+		contentEncoding string
+	}{
+		{acceptEncoding: "gzip;q=0.2, br", contentEncoding: specs.ContentEncodingBrotli},
+		{acceptEncoding: "br,gzip,deflate", contentEncoding: specs.ContentEncodingGzip},
+		{acceptEncoding: "gzip;q=0", contentEncoding: ""},
+		{acceptEncoding: "deflate;q=0.5, identity", contentEncoding: ""},
+		{acceptEncoding: "deflate;q=0.5, identity;q=0", contentEncoding: specs.ContentEncodingDeflate},
+		{acceptEncoding: "*", contentEncoding: specs.ContentEncodingGzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", url, nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+			defer resp.Body.Close()
+			io.Copy(io.Discard, resp.Body)
+
+			if got := resp.Header.Get("Content-Encoding"); got != tt.contentEncoding {
+				t.Errorf("expected %q encoding, got %q", tt.contentEncoding, got)
+			}
+			if resp.Header.Get("Vary") != "Accept-Encoding" {
+				t.Errorf("expected Vary header, %+v", resp.Header)
+			}
+		})
+	}
+}
+
+func TestServer_StreamingEncoding(t *testing.T) {
+	content := bytes.Repeat([]byte("streaming content "), 1024)
+
+	tests := []struct {
+		name          string
+		contentLength int64
+	}{
+		{name: "Larger than MaxEncodingSize", contentLength: int64(len(content))},
+		{name: "Unknown length", contentLength: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := newEncodingTestServer(t, func(server *Server) {
+				server.MaxEncodingSize = 1024
+			}, func(request Request) Response {
+				return StreamResponse(specs.StatusCodeOK, specs.ContentTypePlain, bytes.NewReader(content), tt.contentLength)
+			})
+
+			req, _ := http.NewRequest("GET", url, nil)
+			req.Header.Set("Accept-Encoding", specs.ContentEncodingGzip)
+
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.Header.Get("Content-Encoding") != specs.ContentEncodingGzip ||
+				len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+				t.Errorf("expected streaming gzip encoding, %+v %+v", resp.Header, resp.TransferEncoding)
+			}
+
+			reader, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				t.Fatalf("encoder err: %s", err)
+			}
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal("read all:", err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Errorf("invalid response of %d bytes", len(data))
+			}
+		})
+	}
+}
+
+func TestServer_EncodingContentTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		configure   func(*Server)
+		encoded     bool
+	}{
+		{name: "Compressible", contentType: specs.ContentTypeJson, encoded: true},
+		{name: "Already compressed", contentType: specs.ContentTypePNG},
+		{name: "Custom allowlist", contentType: specs.ContentTypePlain, configure: func(server *Server) {
+			server.EncodingContentTypes = []string{specs.ContentTypeJson}
+		}},
+		{name: "Disabled", contentType: specs.ContentTypeJson, configure: func(server *Server) {
+			server.DisableCompression = true
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := newEncodingTestServer(t, tt.configure, func(request Request) Response {
+				return TextResponse(specs.StatusCodeOK, tt.contentType, "content")
+			})
+
+			req, _ := http.NewRequest("GET", url, nil)
+			req.Header.Set("Accept-Encoding", specs.ContentEncodingGzip)
+
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+			defer resp.Body.Close()
+			io.Copy(io.Discard, resp.Body)
+
+			encoded := resp.Header.Get("Content-Encoding") == specs.ContentEncodingGzip
+			varied := resp.Header.Get("Vary") == "Accept-Encoding"
+			if encoded != tt.encoded || varied != tt.encoded {
+				t.Errorf("unexpected encoding headers: %+v", resp.Header)
+			}
+		})
+	}
+}
+
+func TestServer_RequestDecoding(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(bytes.Repeat([]byte("decoded "), 64))
+	gz.Close()
+
+	newRequest := func(url, contentEncoding string) *http.Request {
+		req, _ := http.NewRequest("POST", url, bytes.NewReader(compressed.Bytes()))
+		req.Header.Set("Content-Encoding", contentEncoding)
+		return req
+	}
+
+	handler := func(request Request) Response {
+		body, err := io.ReadAll(request.Body())
+		if errors.Is(err, specs.ErrTooLarge) {
+			return TextResponse(specs.StatusCodeRequestEntityTooLarge, specs.ContentTypePlain, err.Error())
+		} else if err != nil {
+			return TextResponse(specs.StatusCodeBadRequest, specs.ContentTypePlain, err.Error())
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, strconv.Itoa(len(body)))
+	}
+
+	tests := []struct {
+		name            string
+		configure       func(*Server)
+		contentEncoding string
+		code            int
+		body            string
+	}{
+		{name: "Decoded", contentEncoding: "gzip", code: http.StatusOK, body: "512"},
+		{name: "CaseInsensitive", contentEncoding: "GZip", code: http.StatusOK, body: "512"},
+		{name: "Unsupported", contentEncoding: "zstd", code: http.StatusUnsupportedMediaType},
+		{
+			name:            "DecodedTooLarge",
+			configure:       func(server *Server) { server.MaxBodySize = 256 },
+			contentEncoding: "gzip", code: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:            "Disabled",
+			configure:       func(server *Server) { server.DisableRequestDecoding = true },
+			contentEncoding: "gzip", code: http.StatusOK, body: strconv.Itoa(compressed.Len()),
+		},
+		{
+			name:            "DisabledUnsupported",
+			configure:       func(server *Server) { server.DisableRequestDecoding = true },
+			contentEncoding: "zstd", code: http.StatusOK, body: strconv.Itoa(compressed.Len()),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := newEncodingTestServer(t, tt.configure, handler)
+
+			resp, err := http.DefaultTransport.RoundTrip(newRequest(url, tt.contentEncoding))
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.code {
+				t.Fatalf("unexpected status code: %d, want %d", resp.StatusCode, tt.code)
+			}
+			if tt.body != "" {
+				body, _ := io.ReadAll(resp.Body)
+				if string(body) != tt.body {
+					t.Errorf("unexpected body: %q, want %q", body, tt.body)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_RequestDecodingOverride(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("plain text"))
+	gz.Close()
+
+	for _, decode := range []bool{true, false} {
+		t.Run(strconv.FormatBool(decode), func(t *testing.T) {
+			url := newEncodingTestServer(t, func(server *Server) {
+				server.DisableRequestDecoding = decode
+			}, func(request Request) Response {
+				if err := request.(BodyDecoder).DecodeBody(decode); err != nil {
+					t.Error("decode body:", err)
+				}
+				body, _ := io.ReadAll(request.Body())
+				return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, strconv.Itoa(len(body)))
+			})
+
+			req, _ := http.NewRequest("POST", url, bytes.NewReader(compressed.Bytes()))
+			req.Header.Set("Content-Encoding", "gzip")
+
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+			defer resp.Body.Close()
+
+			want := strconv.Itoa(compressed.Len())
+			if decode {
+				want = strconv.Itoa(len("plain text"))
+			}
+			if body, _ := io.ReadAll(resp.Body); string(body) != want {
+				t.Errorf("unexpected body: %q, want %q", body, want)
+			}
+		})
+	}
+}
+
 // Test other functionality
 
 func TestServer_Hijack(t *testing.T) {
@@ -829,99 +1136,125 @@ func TestServer_FilterConn(t *testing.T) {
 	}
 }
 
-// Test TLS
+func TestServer_ProxyProtocol(t *testing.T) {
+	var filtered atomic.Value
+	handledErrors := make(chan error, 1)
 
-func TestServer_GetRequestTLS(t *testing.T) {
-	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
-		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay", func(resp Response) {
-			resp.Header().Set("x-hello-world", "xyz-123")
+	newServer := func(trusted []string, serveTLS bool) string {
+		server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+			var authority string
+			if header := ProxyProtocolHeaderFromContext(ctx); header != nil {
+				authority = string(header.TLV(0x02))
+			}
+			return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, request.RemoteAddr().String()+" "+authority)
+		}))
+		server.ProxyProtocolTrusted = trusted
+		server.FilterConn = func(addr net.Addr) bool {
+			filtered.Store(addr.String())
+			return true
+		}
+		server.ErrorHandler = ErrorHandlerFunc(func(ctx context.Context, conn net.Conn, err any) {
+			handledErrors <- err.(error)
 		})
-	}))
-
-	listener, err := net.Listen("tcp4", "127.0.0.1:0")
-	if err != nil {
-		t.Fatal(err)
-	}
-	go server.ServeTLSRaw(listener, testing_ops.NewTlsCert())
-
-	url := "https://" + listener.Addr().String()
 
-	client := &http.Client{Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	}}
-	req, _ := http.NewRequest("GET", url, nil)
-	resp, err := client.Do(req)
-	if err != nil {
-		t.Fatal("req:", err)
+		listener, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if serveTLS {
+			go server.ServeTLSRaw(listener, testing_ops.NewTlsCert())
+		} else {
+			go server.Serve(listener)
+		}
+		return listener.Addr().String()
 	}
 
-	if resp.Header.Get("X-Hello-World") != "xyz-123" ||
-		resp.Header.Get("Content-Type") != "text/plain" {
-		t.Errorf("not found expected headers, %+v", resp.Header)
+	roundTrip := func(t *testing.T, conn net.Conn) string {
+		if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal("read response:", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
 	}
 
-	checkHttpResponseBody(t, resp, []byte("okay"))
-}
-
-func TestServer_PostRequestTLS(t *testing.T) {
-	requestBody := []byte(`{"key": "value"}`)
-
-	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
-		if request.Header().Get("X-Hello-World") != "xyz-123" ||
-			request.Header().Get("Content-Length") != strconv.Itoa(len(requestBody)) {
-			t.Error("not found expected headers")
+	t.Run("v1", func(t *testing.T) {
+		conn, err := net.Dial("tcp4", newServer([]string{"127.0.0.0/8"}, false))
+		if err != nil {
+			t.Fatal(err)
 		}
+		defer conn.Close()
 
-		b, _ := io.ReadAll(request.Body())
-		if !bytes.Equal(b, requestBody) {
-			t.Errorf("expected %s, got %s", string(requestBody), string(b))
+		conn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"))
+		if body := roundTrip(t, conn); body != "192.0.2.1:56324 " {
+			t.Errorf("unexpected remote address %q", body)
 		}
+		if addr := filtered.Load(); addr != "192.0.2.1:56324" {
+			t.Errorf("unexpected filtered address %v", addr)
+		}
+	})
 
-		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay", func(resp Response) {
-			resp.Header().Set("x-hello-world", "321-xyz")
-		})
-	}))
+	t.Run("v2 before TLS", func(t *testing.T) {
+		conn, err := net.Dial("tcp4", newServer([]string{"127.0.0.1"}, true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
 
-	listener, err := net.Listen("tcp4", "127.0.0.1:0")
-	if err != nil {
-		t.Fatal(err)
-	}
-	go server.ServeTLSRaw(listener, testing_ops.NewTlsCert())
+		header := []byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x1a")
+		header = append(header, 192, 0, 2, 1, 198, 51, 100, 1, 0xDC, 0x04, 0x01, 0xBB)
+		header = append(header, 0x02, 0x00, 0x0b)
+		header = append(header, "example.com"...)
+		conn.Write(header)
 
-	url := "https://" + listener.Addr().String()
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+		if body := roundTrip(t, tlsConn); body != "192.0.2.1:56324 example.com" {
+			t.Errorf("unexpected response %q", body)
+		}
+	})
 
-	client := &http.Client{Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	}}
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	req.Header.Set("X-Hello-World", "xyz-123")
+	t.Run("Untrusted", func(t *testing.T) {
+		conn, err := net.Dial("tcp4", newServer([]string{"10.0.0.0/8"}, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
 
-	resp, err := client.Do(req)
-	if err != nil {
-		t.Fatal("req:", err)
-	}
+		if body := roundTrip(t, conn); body != conn.LocalAddr().String()+" " {
+			t.Errorf("unexpected remote address %q", body)
+		}
+	})
 
-	if resp.Header.Get("X-Hello-World") != "321-xyz" ||
-		resp.Header.Get("Content-Type") != "text/plain" {
-		t.Errorf("not found expected headers, %+v", resp.Header)
-	}
+	t.Run("Missing header", func(t *testing.T) {
+		conn, err := net.Dial("tcp4", newServer([]string{"127.0.0.0/8"}, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
 
-	checkHttpResponseBody(t, resp, []byte("okay"))
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+		select {
+		case err := <-handledErrors:
+			if !errors.Is(err, specs.ErrProxyProtocol) {
+				t.Errorf("expected ErrProxyProtocol, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("error is not handled")
+		}
+	})
 }
 
-func TestServer_PanicHandling(t *testing.T) {
-	var panicHandled atomic.Bool
+func TestServer_ProxyProtocolHeaderTimeout(t *testing.T) {
 	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
-		panic("test panic")
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "ok")
 	}))
-	server.ErrorHandler = ErrorHandlerFunc(func(ctx context.Context, conn net.Conn, err any) {
-		ShortResponseWriter(specs.StatusCodeInternalServerError, "panic handled").WriteTo(conn)
-		panicHandled.Store(true)
-	})
+	server.ProxyProtocolTrusted = []string{"127.0.0.1"}
+	server.ReadTimeout = 0
+	server.ReadHeaderTimeout = 100 * time.Millisecond
 
 	listener, err := net.Listen("tcp4", "127.0.0.1:0")
 	if err != nil {
@@ -929,15 +1262,495 @@ func TestServer_PanicHandling(t *testing.T) {
 	}
 	go server.Serve(listener)
 
-	url := "http://" + listener.Addr().String()
-	client := &http.Client{Transport: &http.Transport{}}
-	req, _ := http.NewRequest("GET", url, nil)
-	resp, err := client.Do(req)
+	conn, err := net.Dial("tcp4", listener.Addr().String())
 	if err != nil {
-		t.Fatal("req:", err)
+		t.Fatal(err)
 	}
-	if resp.StatusCode != int(specs.StatusCodeInternalServerError) {
-		t.Errorf("expected status code 500, got %d", resp.StatusCode)
+	defer conn.Close()
+
+	// The header is never sent, so the connection is closed by the timeout
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestServer_TrustedProxies(t *testing.T) {
+	newServer := func(trusted []string, headerName string) string {
+		server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+			peer := PeerAddr(request).(*net.TCPAddr)
+			return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, ClientIP(request).String()+" "+peer.IP.String())
+		}))
+		server.TrustedProxies = trusted
+		server.ClientIPHeader = headerName
+
+		listener, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go server.Serve(listener)
+		return "http://" + listener.Addr().String()
+	}
+
+	tests := []struct {
+		name       string
+		trusted    []string
+		headerName string
+		value      string
+		expected   string
+	}{
+		{"Trusted", []string{"127.0.0.1"}, "", "203.0.113.7", "203.0.113.7 127.0.0.1"},
+		{"Spoofed", []string{"127.0.0.0/8"}, "", "1.2.3.4, 203.0.113.7", "203.0.113.7 127.0.0.1"},
+		{"Untrusted", []string{"10.0.0.0/8"}, "", "203.0.113.7", "127.0.0.1 127.0.0.1"},
+		{"Real IP", []string{"127.0.0.1"}, "X-Real-IP", "203.0.113.7", "203.0.113.7 127.0.0.1"},
+		{"Forwarded", []string{"127.0.0.1"}, "Forwarded", "for=\"[2001:db8::1]:4711\"", "2001:db8::1 127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headerName := tt.headerName
+			if headerName == "" {
+				headerName = "X-Forwarded-For"
+			}
+
+			req, _ := http.NewRequest("GET", newServer(tt.trusted, tt.headerName), nil)
+			req.Header.Set(headerName, tt.value)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+
+			checkHttpResponseBody(t, resp, []byte(tt.expected))
+		})
+	}
+}
+
+func TestServer_ConnState(t *testing.T) {
+	states := make(chan ConnState, 10)
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+	server.ConnState = func(conn net.Conn, state ConnState) {
+		states <- state
+	}
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	conn, err := net.Dial("tcp4", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for _, connection := range []string{"keep-alive", "close"} {
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nConnection: " + connection + "\r\n\r\n"))
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal("read response:", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	expected := []ConnState{ConnStateNew, ConnStateActive, ConnStateIdle, ConnStateActive, ConnStateClosed}
+	for _, want := range expected {
+		select {
+		case state := <-states:
+			if state != want {
+				t.Fatalf("expected state %s, got %s", want, state)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("state %s is not reported", want)
+		}
+	}
+}
+
+func TestServer_ReadHeaderTimeout(t *testing.T) {
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		body, err := io.ReadAll(request.Body())
+		if err != nil {
+			return TextResponse(specs.StatusCodeBadRequest, specs.ContentTypePlain, err.Error())
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, string(body))
+	}))
+	server.ReadHeaderTimeout = 100 * time.Millisecond
+	server.ReadTimeout = 2 * time.Second
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	t.Run("Slow head", func(t *testing.T) {
+		conn, err := net.Dial("tcp4", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("POST / HTTP/1.1\r\n"))
+		time.Sleep(300 * time.Millisecond)
+		conn.Write([]byte("Host: example.com\r\nContent-Length: 4\r\n\r\nbody"))
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if resp, err := http.ReadResponse(bufio.NewReader(conn), nil); err == nil {
+			t.Fatalf("expected connection to be closed, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Slow body", func(t *testing.T) {
+		conn, err := net.Dial("tcp4", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\nConnection: close\r\n\r\n"))
+		time.Sleep(300 * time.Millisecond)
+		conn.Write([]byte("body"))
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal("read response:", err)
+		}
+		checkHttpResponseBody(t, resp, []byte("body"))
+	})
+}
+
+func TestServer_RequestController(t *testing.T) {
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		if request.Url().Path == "/upload" {
+			RequestControllerFromContext(ctx).SetReadDeadline(time.Now().Add(2 * time.Second))
+		}
+		body, err := io.ReadAll(request.Body())
+		if err != nil {
+			return TextResponse(specs.StatusCodeRequestTimeout, specs.ContentTypePlain, err.Error())
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, string(body))
+	}))
+	server.ReadTimeout = 200 * time.Millisecond
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	for _, tt := range []struct {
+		path string
+		code int
+	}{
+		{"/upload", 200},
+		{"/", 408},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			conn, err := net.Dial("tcp4", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			conn.Write([]byte("POST " + tt.path + " HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\nConnection: close\r\n\r\n"))
+			time.Sleep(400 * time.Millisecond)
+			conn.Write([]byte("body"))
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal("read response:", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.code {
+				t.Errorf("expected status %d, got %d", tt.code, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestServer_ClientDisconnect(t *testing.T) {
+	causes := make(chan error, 1)
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		if body := request.Body(); body != nil {
+			io.ReadAll(body)
+		}
+		select {
+		case <-ctx.Done():
+			causes <- context.Cause(ctx)
+		case <-time.After(2 * time.Second):
+			causes <- nil
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	for _, tt := range []struct {
+		name    string
+		request string
+	}{
+		{"Without body", "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{"With body", "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\n\r\nbody"},
+		{"Chunked body", "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n4\r\nbody\r\n0\r\n\r\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp4", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Write([]byte(tt.request))
+			time.Sleep(50 * time.Millisecond)
+			conn.Close()
+
+			if cause := <-causes; !errors.Is(cause, specs.ErrClientDisconnected) {
+				t.Errorf("expected ErrClientDisconnected, got %v", cause)
+			}
+		})
+	}
+}
+
+func TestServer_ClientDisconnectAfterDeadlineChange(t *testing.T) {
+	causes := make(chan error, 1)
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		io.ReadAll(request.Body())
+
+		// The deadline fails the pending background read of the connection
+		RequestControllerFromContext(ctx).SetReadDeadline(time.Now())
+
+		select {
+		case <-ctx.Done():
+			causes <- context.Cause(ctx)
+		case <-time.After(2 * time.Second):
+			causes <- nil
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay")
+	}))
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	conn, err := net.Dial("tcp4", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\n\r\nbody"))
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+
+	if cause := <-causes; !errors.Is(cause, specs.ErrClientDisconnected) {
+		t.Errorf("expected ErrClientDisconnected, got %v", cause)
+	}
+}
+
+func TestServer_PipelinedRequests(t *testing.T) {
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		time.Sleep(50 * time.Millisecond)
+		if err := context.Cause(ctx); err != nil {
+			return TextResponse(specs.StatusCodeInternalServerError, specs.ContentTypePlain, err.Error())
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, request.Url().Path)
+	}))
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	conn, err := net.Dial("tcp4", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /first HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+		"GET /second HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	for _, path := range []string{"/first", "/second"} {
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal("read response:", err)
+		}
+		checkHttpResponseBody(t, resp, []byte(path))
+	}
+}
+
+// Test TLS
+
+func TestServer_GetRequestTLS(t *testing.T) {
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay", func(resp Response) {
+			resp.Header().Set("x-hello-world", "xyz-123")
+		})
+	}))
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLSRaw(listener, testing_ops.NewTlsCert())
+
+	url := "https://" + listener.Addr().String()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	}}
+	req, _ := http.NewRequest("GET", url, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	if resp.Header.Get("X-Hello-World") != "xyz-123" ||
+		resp.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("not found expected headers, %+v", resp.Header)
+	}
+
+	checkHttpResponseBody(t, resp, []byte("okay"))
+}
+
+func TestServer_PostRequestTLS(t *testing.T) {
+	requestBody := []byte(`{"key": "value"}`)
+
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		if request.Header().Get("X-Hello-World") != "xyz-123" ||
+			request.Header().Get("Content-Length") != strconv.Itoa(len(requestBody)) {
+			t.Error("not found expected headers")
+		}
+
+		b, _ := io.ReadAll(request.Body())
+		if !bytes.Equal(b, requestBody) {
+			t.Errorf("expected %s, got %s", string(requestBody), string(b))
+		}
+
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "okay", func(resp Response) {
+			resp.Header().Set("x-hello-world", "321-xyz")
+		})
+	}))
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLSRaw(listener, testing_ops.NewTlsCert())
+
+	url := "https://" + listener.Addr().String()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	}}
+	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+	req.Header.Set("X-Hello-World", "xyz-123")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	if resp.Header.Get("X-Hello-World") != "321-xyz" ||
+		resp.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("not found expected headers, %+v", resp.Header)
+	}
+
+	checkHttpResponseBody(t, resp, []byte("okay"))
+}
+
+func TestServer_TLSState(t *testing.T) {
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		state := TLSState(request)
+		if state == nil {
+			return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "plain")
+		}
+
+		var subject string
+		if len(state.VerifiedChains) > 0 {
+			subject = state.VerifiedChains[0][0].Subject.CommonName
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain,
+			fmt.Sprintf("%s|%s|%s|%s", state.ServerName, tls.VersionName(state.Version), state.NegotiatedProtocol, subject))
+	}))
+	server.TLSConfig = &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  testing_ops.CertPool(),
+	}
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLSRaw(listener, testing_ops.NewTlsCert())
+
+	url := "https://" + listener.Addr().String()
+
+	tests := []struct {
+		name   string
+		certs  []tls.Certificate
+		expect string
+	}{
+		{"WithoutClientCert", nil, "example.com|TLS 1.3|http/1.1|"},
+		{"WithClientCert", []tls.Certificate{testing_ops.NewClientCert("billing")}, "example.com|TLS 1.3|http/1.1|billing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+					ServerName:         "example.com",
+					NextProtos:         []string{"http/1.1"},
+					Certificates:       tt.certs,
+				},
+			}}
+			resp, err := client.Get(url)
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+			checkHttpResponseBody(t, resp, []byte(tt.expect))
+		})
+	}
+}
+
+func TestServer_PanicHandling(t *testing.T) {
+	var panicHandled atomic.Bool
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		panic("test panic")
+	}))
+	server.ErrorHandler = ErrorHandlerFunc(func(ctx context.Context, conn net.Conn, err any) {
+		ShortResponseWriter(specs.StatusCodeInternalServerError, "panic handled").WriteTo(conn)
+		panicHandled.Store(true)
+	})
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	url := "http://" + listener.Addr().String()
+	client := &http.Client{Transport: &http.Transport{}}
+	req, _ := http.NewRequest("GET", url, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	if resp.StatusCode != int(specs.StatusCodeInternalServerError) {
+		t.Errorf("expected status code 500, got %d", resp.StatusCode)
 	}
 
 	body := resp.Body
@@ -962,7 +1775,9 @@ func TestServer_PanicHandling(t *testing.T) {
 }
 
 func TestServer_RequestBodyTooLarge(t *testing.T) {
+	var handled atomic.Bool
 	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		handled.Store(true)
 		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "ok")
 	}))
 	server.MaxBodySize = 4
@@ -983,6 +1798,197 @@ func TestServer_RequestBodyTooLarge(t *testing.T) {
 	if resp.StatusCode != int(specs.StatusCodeRequestEntityTooLarge) {
 		t.Errorf("expected status code 413, go %d", resp.StatusCode)
 	}
+	if handled.Load() {
+		t.Error("handler must not be called for the declared oversize body")
+	}
+}
+
+func TestServer_ChunkedRequestBodyTooLarge(t *testing.T) {
+	var readErr error
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		_, readErr = io.ReadAll(request.Body())
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "ok")
+	}))
+	server.MaxBodySize = 16
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	url := "http://" + listener.Addr().String()
+	client := &http.Client{Transport: &http.Transport{}}
+	req, _ := http.NewRequest("POST", url, io.NopCloser(bytes.NewReader(bytes.Repeat([]byte("chunk "), 64))))
+	req.ContentLength = -1
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != int(specs.StatusCodeRequestEntityTooLarge) {
+		t.Errorf("expected status code 413, got %d", resp.StatusCode)
+	}
+	if !resp.Close {
+		t.Error("expected connection to be closed")
+	}
+	if !errors.Is(readErr, specs.ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge on read, got %v", readErr)
+	}
+}
+
+type bodyLimitHandler struct {
+	HandlerFunc
+	limit int64
+}
+
+func (handler bodyLimitHandler) BodyLimit(request Request) (int64, bool) {
+	return handler.limit, true
+}
+
+func TestServer_LimitBody(t *testing.T) {
+	body := bytes.Repeat([]byte("upload "), 64)
+
+	// The declared length is checked against the limit of the provider before the handler,
+	// the length of chunked bodies is known only while reading
+	server := DefaultServer(bodyLimitHandler{
+		HandlerFunc: func(ctx context.Context, request Request) Response {
+			request.(BodyLimiter).LimitBody(int64(len(body)))
+			data, err := io.ReadAll(request.Body())
+			if err != nil {
+				t.Error("read:", err)
+			}
+			return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, strconv.Itoa(len(data)))
+		},
+		limit: int64(len(body)),
+	})
+	server.MaxBodySize = 16
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	url := "http://" + listener.Addr().String()
+	for _, chunked := range []bool{false, true} {
+		t.Run("Chunked="+strconv.FormatBool(chunked), func(t *testing.T) {
+			req, _ := http.NewRequest("POST", url, io.NopCloser(bytes.NewReader(body)))
+			req.ContentLength = int64(len(body))
+			if chunked {
+				req.ContentLength = -1
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+
+			checkHttpResponseBody(t, resp, []byte(strconv.Itoa(len(body))))
+		})
+	}
+}
+
+func TestServer_StrictParsing(t *testing.T) {
+	handledErrors := make(chan error, 1)
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "ok")
+	}))
+	server.StrictParsing = true
+	server.ErrorHandler = ErrorHandlerFunc(func(ctx context.Context, conn net.Conn, err any) {
+		ShortResponseWriter(specs.StatusCodeBadRequest, "rejected").WriteTo(conn)
+		handledErrors <- err.(error)
+	})
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	tests := []struct {
+		name string
+		raw  string
+		err  error
+	}{
+		{
+			name: "CL.TE",
+			raw:  "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 6\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nG",
+			err:  specs.ErrContentLengthWithTransferEncoding,
+		},
+		{
+			name: "CL.0",
+			raw:  "GET / HTTP/1.1\r\nHost: a\r\nContent-Length: 28\r\n\r\nGET /admin HTTP/1.1\r\nX: \r\n\r\n",
+			err:  specs.ErrUnexpectedBody,
+		},
+		{
+			name: "bare LF",
+			raw:  "GET / HTTP/1.1\r\nHost: a\n\r\n",
+			err:  specs.ErrBareLineFeed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp4", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if _, err = conn.Write([]byte(tt.raw)); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal("read response:", err)
+			}
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("unexpected status code: %d", resp.StatusCode)
+			}
+
+			select {
+			case err := <-handledErrors:
+				if !errors.Is(err, tt.err) {
+					t.Errorf("expected error %v, got %v", tt.err, err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("error is not handled")
+			}
+		})
+	}
+}
+
+func TestServer_LenientParsingByDefault(t *testing.T) {
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "ok")
+	}))
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	conn, err := net.Dial("tcp4", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: a\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("read response:", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
 }
 
 // TestContinue
@@ -0,0 +1,108 @@
+package socks5
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/oesand/plow/specs"
+)
+
+const (
+	socksVersion5 byte = 0x05
+
+	socksNoAuthFlag       byte = 0x00
+	socksAuthByCredsFlag  byte = 0x02
+	socksNoAcceptableFlag byte = 0xFF
+
+	socksAuthCredsVersion byte = 0x01
+	socksAuthSucceeded    byte = 0x00
+	socksAuthFailed       byte = 0x01
+
+	socksAddrTypeIPv4 byte = 0x01
+	socksAddrTypeFQDN byte = 0x03
+	socksAddrTypeIPv6 byte = 0x04
+)
+
+const (
+	replySucceeded           byte = 0x00
+	replyGeneralFailure      byte = 0x01
+	replyNotAllowed          byte = 0x02
+	replyNetworkUnreachable  byte = 0x03
+	replyHostUnreachable     byte = 0x04
+	replyConnectionRefused   byte = 0x05
+	replyCommandNotSupported byte = 0x07
+	replyAddrTypeUnsupported byte = 0x08
+)
+
+var (
+	ErrUnsupportedVersion  = specs.NewOpError("socks5", "unsupported protocol version")
+	ErrNoAcceptableAuth    = specs.NewOpError("socks5", "no acceptable authentication methods")
+	ErrAuthFailed          = specs.NewOpError("socks5", "username/password authentication failed")
+	ErrNotAllowed          = specs.NewOpError("socks5", "connection not allowed by ruleset")
+	ErrUnsupportedCommand  = specs.NewOpError("socks5", "command not supported")
+	ErrUnsupportedAddrType = specs.NewOpError("socks5", "address type not supported")
+)
+
+// Command represents the SOCKS5 request command.
+type Command byte
+
+const (
+	CommandConnect   Command = 0x01
+	CommandBind      Command = 0x02
+	CommandAssociate Command = 0x03
+)
+
+// String returns the name of the command.
+func (cmd Command) String() string {
+	switch cmd {
+	case CommandConnect:
+		return "CONNECT"
+	case CommandBind:
+		return "BIND"
+	case CommandAssociate:
+		return "UDP ASSOCIATE"
+	default:
+		return "UNKNOWN(" + strconv.Itoa(int(cmd)) + ")"
+	}
+}
+
+// Addr is the destination address of the SOCKS5 request.
+//
+// Either FQDN or IP is set depending on the address type passed by the client.
+type Addr struct {
+	FQDN string
+	IP   net.IP
+	Port int
+}
+
+// Network implements the [net.Addr] interface.
+func (a *Addr) Network() string { return "socks5" }
+
+// String returns the address in "host:port" form suitable for dialing.
+func (a *Addr) String() string {
+	if a == nil {
+		return "<nil>"
+	}
+	host := a.FQDN
+	if host == "" {
+		host = a.IP.String()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(a.Port))
+}
+
+// Request holds the information about the SOCKS5 request
+// passed to the [RuleSet] before it is served.
+type Request struct {
+	// Command requested by the client.
+	Command Command
+
+	// Username authenticated by RFC 1929 username/password method,
+	// empty if the authentication is not required.
+	Username string
+
+	// RemoteAddr is the network address of the client.
+	RemoteAddr net.Addr
+
+	// DestAddr is the destination address requested by the client.
+	DestAddr *Addr
+}
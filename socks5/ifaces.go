@@ -0,0 +1,40 @@
+package socks5
+
+import (
+	"context"
+	"net"
+	"slices"
+)
+
+// Dialer is an interface representing the ability to dial network connections
+// to the destination requested by the client.
+//
+// It has the same method set as plow.Dialer, so any of its implementations can be used.
+type Dialer interface {
+	// Dial connects to the address on the named network.
+	Dial(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// RuleSet decides whether the request is allowed to be served.
+//
+// A RuleSet must be concurrent safe for use by multiple goroutines.
+type RuleSet interface {
+	// Allow returns true to serve the request, false to answer
+	// with 'connection not allowed by ruleset' reply.
+	Allow(ctx context.Context, req *Request) bool
+}
+
+// RuleFunc shorthand implementation for [RuleSet]
+type RuleFunc func(ctx context.Context, req *Request) bool
+
+// Allow triggers top level function [RuleFunc]
+func (f RuleFunc) Allow(ctx context.Context, req *Request) bool {
+	return f(ctx, req)
+}
+
+// PermitCommands returns a [RuleSet] that allows only the requests with listed commands.
+func PermitCommands(commands ...Command) RuleSet {
+	return RuleFunc(func(ctx context.Context, req *Request) bool {
+		return slices.Contains(commands, req.Command)
+	})
+}
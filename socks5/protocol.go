@@ -0,0 +1,108 @@
+package socks5
+
+import (
+	"io"
+	"net"
+)
+
+// readRequest reads VER | CMD | RSV | ATYP | DST.ADDR | DST.PORT
+func readRequest(reader io.Reader) (*Request, error) {
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	if header[0] != socksVersion5 {
+		return nil, ErrUnsupportedVersion
+	}
+
+	addr, err := readAddr(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Request{
+		Command:  Command(header[1]),
+		DestAddr: addr,
+	}, nil
+}
+
+// readAddr reads ATYP | ADDR | PORT
+func readAddr(reader io.Reader) (*Addr, error) {
+	buf := make([]byte, 1, 255)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, err
+	}
+
+	addr := &Addr{}
+	switch buf[0] {
+	case socksAddrTypeIPv4:
+		addr.IP = make(net.IP, net.IPv4len)
+		if _, err := io.ReadFull(reader, addr.IP); err != nil {
+			return nil, err
+		}
+	case socksAddrTypeIPv6:
+		addr.IP = make(net.IP, net.IPv6len)
+		if _, err := io.ReadFull(reader, addr.IP); err != nil {
+			return nil, err
+		}
+	case socksAddrTypeFQDN:
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		buf = buf[:buf[0]]
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		addr.FQDN = string(buf)
+	default:
+		return nil, ErrUnsupportedAddrType
+	}
+
+	port := buf[:2]
+	if _, err := io.ReadFull(reader, port); err != nil {
+		return nil, err
+	}
+	addr.Port = int(port[0])<<8 | int(port[1])
+
+	return addr, nil
+}
+
+// appendAddr appends ATYP | ADDR | PORT of the network address,
+// unknown addresses are encoded as IPv4 zero address.
+func appendAddr(buf []byte, addr net.Addr) []byte {
+	var ip net.IP
+	var port int
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		ip, port = addr.IP, addr.Port
+	case *net.UDPAddr:
+		ip, port = addr.IP, addr.Port
+	case *Addr:
+		if addr.FQDN != "" && len(addr.FQDN) <= 255 {
+			buf = append(buf, socksAddrTypeFQDN, byte(len(addr.FQDN)))
+			buf = append(buf, addr.FQDN...)
+			return append(buf, byte(addr.Port>>8), byte(addr.Port))
+		}
+		ip, port = addr.IP, addr.Port
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		buf = append(buf, socksAddrTypeIPv4)
+		buf = append(buf, ip4...)
+	} else if ip6 := ip.To16(); ip6 != nil {
+		buf = append(buf, socksAddrTypeIPv6)
+		buf = append(buf, ip6...)
+	} else {
+		buf = append(buf, socksAddrTypeIPv4, 0, 0, 0, 0)
+	}
+	return append(buf, byte(port>>8), byte(port))
+}
+
+// writeReply writes VER | REP | RSV | ATYP | BND.ADDR | BND.PORT
+func writeReply(writer io.Writer, code byte, bindAddr net.Addr) error {
+	buf := make([]byte, 0, 22)
+	buf = append(buf, socksVersion5, code, 0)
+	buf = appendAddr(buf, bindAddr)
+	_, err := writer.Write(buf)
+	return err
+}
@@ -0,0 +1,278 @@
+package socks5
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/oesand/plow/internal"
+)
+
+var defaultDialer = net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+// DefaultServer creates a new [Server] with default settings.
+func DefaultServer() *Server {
+	return &Server{
+		HandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// Server is a SOCKS5 proxy server (RFC 1928).
+//
+// It supports CONNECT and optionally UDP ASSOCIATE commands,
+// domain, IPv4 and IPv6 destination addresses and
+// username/password authentication (RFC 1929).
+type Server struct {
+	_ internal.NoCopy
+
+	// Authenticate optionally verifies credentials passed by clients
+	// with username/password authentication method.
+	//
+	// If nil, authentication is not required.
+	Authenticate func(username, password string) bool
+
+	// Dialer specifies the dialer for connecting to the requested destination.
+	// If Dialer is nil then the server dials using package net.
+	Dialer Dialer
+
+	// Rules optionally filters requests by command, destination or user.
+	// If nil, all requests are allowed.
+	Rules RuleSet
+
+	// FilterConn handles all new incoming connections to provide filtering by address
+	// Returns true - accept, false - close connection
+	FilterConn func(addr net.Addr) bool
+
+	// EnableUDP enables UDP ASSOCIATE command,
+	// datagrams are relayed through package net without the Dialer
+	// and each of them is checked by the Rules.
+	EnableUDP bool
+
+	// HandshakeTimeout specifies the maximum amount of time to
+	// wait for negotiation and the request. Zero means no timeout.
+	HandshakeTimeout time.Duration
+}
+
+// ListenAndServe listens on the TCP network address and then
+// calls [Server.Serve] to handle incoming connections.
+//
+// If addr is blank, ":1080" is used.
+func (srv *Server) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = ":1080"
+	}
+	lst, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(lst)
+}
+
+// Serve accepts incoming connections on the [net.Listener], creating a
+// new service goroutine for each.
+//
+// Serve returns the error of accepting when the listener is closed.
+func (srv *Server) Serve(listener net.Listener) error {
+	if listener == nil {
+		panic("plow: nil listener")
+	}
+
+	var attemptDelay time.Duration
+	ctx := context.Background()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				if attemptDelay == 0 {
+					attemptDelay = 5 * time.Millisecond
+				} else if maxDelay := 1 * time.Second; attemptDelay >= maxDelay {
+					attemptDelay = maxDelay
+				} else {
+					attemptDelay *= 2
+				}
+
+				time.Sleep(attemptDelay)
+				continue
+			}
+			return err
+		}
+
+		attemptDelay = 0
+		if srv.FilterConn != nil {
+			if allow := srv.FilterConn(conn.RemoteAddr()); !allow {
+				conn.Close()
+				continue
+			}
+		}
+
+		go srv.ServeConn(ctx, conn)
+	}
+}
+
+// ServeConn serves the SOCKS5 negotiation and the request on the connection,
+// and then relays the traffic until one of the sides or the context is closed.
+//
+// The connection is always closed when ServeConn returns.
+func (srv *Server) ServeConn(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+
+	if srv.HandshakeTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(srv.HandshakeTimeout))
+	}
+
+	reader := bufio.NewReader(conn)
+
+	username, err := srv.negotiate(reader, conn)
+	if err != nil {
+		return err
+	}
+
+	req, err := readRequest(reader)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedAddrType) {
+			writeReply(conn, replyAddrTypeUnsupported, nil)
+		}
+		return err
+	}
+	req.Username = username
+	req.RemoteAddr = conn.RemoteAddr()
+
+	if srv.Rules != nil && !srv.Rules.Allow(ctx, req) {
+		writeReply(conn, replyNotAllowed, nil)
+		return ErrNotAllowed
+	}
+
+	switch req.Command {
+	case CommandConnect:
+		return srv.connect(ctx, conn, reader, req)
+	case CommandAssociate:
+		if srv.EnableUDP {
+			return srv.associate(ctx, conn, reader, req)
+		}
+	}
+
+	writeReply(conn, replyCommandNotSupported, nil)
+	return ErrUnsupportedCommand
+}
+
+func (srv *Server) negotiate(reader *bufio.Reader, conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksVersion5 {
+		return "", ErrUnsupportedVersion
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, methods); err != nil {
+		return "", err
+	}
+
+	method := socksNoAuthFlag
+	if srv.Authenticate != nil {
+		method = socksAuthByCredsFlag
+	}
+
+	if !slices.Contains(methods, method) {
+		conn.Write([]byte{socksVersion5, socksNoAcceptableFlag})
+		return "", ErrNoAcceptableAuth
+	}
+
+	if _, err := conn.Write([]byte{socksVersion5, method}); err != nil {
+		return "", err
+	}
+	if method == socksNoAuthFlag {
+		return "", nil
+	}
+
+	// RFC 1929: VER | ULEN | UNAME | PLEN | PASSWD
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksAuthCredsVersion {
+		return "", ErrUnsupportedVersion
+	}
+	username := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, username); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(reader, header[:1]); err != nil {
+		return "", err
+	}
+	password := make([]byte, header[0])
+	if _, err := io.ReadFull(reader, password); err != nil {
+		return "", err
+	}
+
+	if !srv.Authenticate(string(username), string(password)) {
+		conn.Write([]byte{socksAuthCredsVersion, socksAuthFailed})
+		return "", ErrAuthFailed
+	}
+	if _, err := conn.Write([]byte{socksAuthCredsVersion, socksAuthSucceeded}); err != nil {
+		return "", err
+	}
+	return string(username), nil
+}
+
+func (srv *Server) connect(ctx context.Context, conn net.Conn, reader *bufio.Reader, req *Request) error {
+	var upstream net.Conn
+	var err error
+	if srv.Dialer != nil {
+		upstream, err = srv.Dialer.Dial(ctx, "tcp", req.DestAddr.String())
+	} else {
+		upstream, err = defaultDialer.DialContext(ctx, "tcp", req.DestAddr.String())
+	}
+	if err != nil {
+		writeReply(conn, replyCodeOf(err), nil)
+		return err
+	}
+	defer upstream.Close()
+
+	if err = writeReply(conn, replySucceeded, upstream.LocalAddr()); err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	done := make(chan struct{}, 2)
+	copyConn := func(dst io.WriteCloser, src io.Reader) {
+		io.Copy(dst, src)
+		dst.Close()
+		done <- struct{}{}
+	}
+
+	// The reader may hold data sent by the client right after the request
+	go copyConn(upstream, reader)
+	go copyConn(conn, upstream)
+
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+	return nil
+}
+
+func replyCodeOf(err error) byte {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return replyConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return replyNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return replyHostUnreachable
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return replyHostUnreachable
+	}
+	return replyGeneralFailure
+}
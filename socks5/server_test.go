@@ -0,0 +1,334 @@
+package socks5
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/oesand/plow/internal/proxy"
+)
+
+func newTestSocksServer(t *testing.T, server *Server) string {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go server.Serve(listener)
+
+	return listener.Addr().String()
+}
+
+func newTestEchoServer(t *testing.T) *net.TCPAddr {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr)
+}
+
+func dialTestSocks(t *testing.T, proxyAddr, host string, port int, creds *proxy.Creds) (net.Conn, error) {
+	conn, err := net.Dial("tcp4", proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = proxy.DialSocks5(conn, host, uint16(port), creds)
+	return conn, err
+}
+
+func checkEcho(t *testing.T, conn net.Conn) {
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, []byte("ping")) {
+		t.Errorf("unexpected echo: %q", buf)
+	}
+}
+
+func TestServer_ConnectAddrTypes(t *testing.T) {
+	echoAddr := newTestEchoServer(t)
+	proxyAddr := newTestSocksServer(t, DefaultServer())
+
+	tests := []struct {
+		name string
+		host string
+	}{
+		{name: "IPv4", host: "127.0.0.1"},
+		{name: "Domain", host: "localhost"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := dialTestSocks(t, proxyAddr, tt.host, echoAddr.Port, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkEcho(t, conn)
+		})
+	}
+}
+
+func TestServer_ConnectIPv6(t *testing.T) {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available:", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	proxyAddr := newTestSocksServer(t, DefaultServer())
+
+	conn, err := dialTestSocks(t, proxyAddr, "::1", listener.Addr().(*net.TCPAddr).Port, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEcho(t, conn)
+}
+
+func TestServer_Authenticate(t *testing.T) {
+	echoAddr := newTestEchoServer(t)
+
+	var username atomic.Value
+	proxyAddr := newTestSocksServer(t, &Server{
+		Authenticate: func(user, password string) bool {
+			return user == "user" && password == "pass"
+		},
+		Rules: RuleFunc(func(ctx context.Context, req *Request) bool {
+			username.Store(req.Username)
+			return true
+		}),
+	})
+
+	conn, err := dialTestSocks(t, proxyAddr, "127.0.0.1", echoAddr.Port, &proxy.Creds{Username: "user", Password: "pass"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEcho(t, conn)
+
+	if username.Load() != "user" {
+		t.Errorf("unexpected request username: %v", username.Load())
+	}
+
+	_, err = dialTestSocks(t, proxyAddr, "127.0.0.1", echoAddr.Port, &proxy.Creds{Username: "user", Password: "invalid"})
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = dialTestSocks(t, proxyAddr, "127.0.0.1", echoAddr.Port, nil)
+	if err == nil || !strings.Contains(err.Error(), "no acceptable authentication methods") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServer_Rules(t *testing.T) {
+	echoAddr := newTestEchoServer(t)
+	proxyAddr := newTestSocksServer(t, &Server{
+		Rules: RuleFunc(func(ctx context.Context, req *Request) bool {
+			return req.Command == CommandConnect && req.DestAddr.FQDN != "denied.test"
+		}),
+	})
+
+	conn, err := dialTestSocks(t, proxyAddr, "127.0.0.1", echoAddr.Port, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEcho(t, conn)
+
+	_, err = dialTestSocks(t, proxyAddr, "denied.test", 80, nil)
+	if err == nil || !strings.Contains(err.Error(), "connection not allowed by ruleset") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServer_Dialer(t *testing.T) {
+	echoAddr := newTestEchoServer(t)
+
+	var dialed atomic.Value
+	proxyAddr := newTestSocksServer(t, &Server{
+		Dialer: dialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed.Store(address)
+			return net.Dial(network, echoAddr.String())
+		}),
+	})
+
+	conn, err := dialTestSocks(t, proxyAddr, "virtual.test", 8080, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEcho(t, conn)
+
+	if dialed.Load() != "virtual.test:8080" {
+		t.Errorf("unexpected dialed address: %v", dialed.Load())
+	}
+}
+
+func TestServer_ConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := listener.Addr().(*net.TCPAddr)
+	listener.Close()
+
+	proxyAddr := newTestSocksServer(t, DefaultServer())
+
+	_, err = dialTestSocks(t, proxyAddr, "127.0.0.1", closedAddr.Port, nil)
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServer_FilterConn(t *testing.T) {
+	var wasChecked atomic.Bool
+	proxyAddr := newTestSocksServer(t, &Server{
+		FilterConn: func(addr net.Addr) bool {
+			wasChecked.Store(true)
+			return false
+		},
+	})
+
+	_, err := dialTestSocks(t, proxyAddr, "127.0.0.1", 80, nil)
+	if err == nil {
+		t.Error("expected filtered connection to fail")
+	}
+	if !wasChecked.Load() {
+		t.Error("FilterConn not was triggered")
+	}
+}
+
+func TestServer_UDPAssociate(t *testing.T) {
+	echo, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, from, err := echo.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteToUDP(buf[:n], from)
+		}
+	}()
+	echoAddr := echo.LocalAddr().(*net.UDPAddr)
+
+	proxyAddr := newTestSocksServer(t, &Server{EnableUDP: true})
+
+	conn, err := net.Dial("tcp4", proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte{socksVersion5, 1, socksNoAuthFlag})
+	resp := make([]byte, 2)
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Write(append([]byte{socksVersion5, byte(CommandAssociate), 0}, appendAddr(nil, &net.UDPAddr{IP: net.IPv4zero})...))
+	resp = make([]byte, 3)
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp[1] != replySucceeded {
+		t.Fatalf("unexpected reply code: %d", resp[1])
+	}
+	bindAddr, err := readAddr(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: bindAddr.IP, Port: bindAddr.Port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	packet := appendAddr([]byte{0, 0, 0}, echoAddr)
+	packet = append(packet, "ping"...)
+	if _, err = client.Write(packet); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bytes.NewReader(buf[3:n])
+	from, err := readAddr(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.IP.Equal(echoAddr.IP) || from.Port != echoAddr.Port {
+		t.Errorf("unexpected source address: %s", from)
+	}
+
+	data, _ := io.ReadAll(reader)
+	if string(data) != "ping" {
+		t.Errorf("unexpected datagram: %q", data)
+	}
+}
+
+func TestServer_UDPAssociateDisabled(t *testing.T) {
+	proxyAddr := newTestSocksServer(t, DefaultServer())
+
+	conn, err := net.Dial("tcp4", proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte{socksVersion5, 1, socksNoAuthFlag})
+	conn.Write(append([]byte{socksVersion5, byte(CommandAssociate), 0}, appendAddr(nil, nil)...))
+
+	resp := make([]byte, 4)
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp[3] != replyCommandNotSupported {
+		t.Errorf("unexpected reply code: %d", resp[3])
+	}
+}
+
+type dialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f dialerFunc) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
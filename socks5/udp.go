@@ -0,0 +1,110 @@
+package socks5
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
+const maxDatagramSize = 64 * 1024
+
+func (srv *Server) associate(ctx context.Context, conn net.Conn, reader *bufio.Reader, req *Request) error {
+	var bindIP net.IP
+	if local, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		bindIP = local.IP
+	}
+
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: bindIP})
+	if err != nil {
+		writeReply(conn, replyGeneralFailure, nil)
+		return err
+	}
+	defer relay.Close()
+
+	if err = writeReply(conn, replySucceeded, relay.LocalAddr()); err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	// The association terminates when the control connection is closed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		io.Copy(io.Discard, reader)
+		cancel()
+	}()
+	go func() {
+		<-ctx.Done()
+		relay.Close()
+	}()
+
+	var clientIP net.IP
+	if remote, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		clientIP = remote.IP
+	}
+
+	var clientAddr *net.UDPAddr
+	if req.DestAddr.Port != 0 && req.DestAddr.IP != nil && !req.DestAddr.IP.IsUnspecified() {
+		clientAddr = &net.UDPAddr{IP: req.DestAddr.IP, Port: req.DestAddr.Port}
+	}
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, from, err := relay.ReadFromUDP(buf)
+		if err != nil {
+			return nil
+		}
+
+		fromClient := false
+		if clientAddr != nil {
+			fromClient = from.IP.Equal(clientAddr.IP) && from.Port == clientAddr.Port
+		} else if clientIP == nil || from.IP.Equal(clientIP) {
+			clientAddr, fromClient = from, true
+		}
+
+		if fromClient {
+			srv.relayFromClient(ctx, relay, req, buf[:n])
+		} else if clientAddr != nil {
+			// RSV | FRAG | ATYP | DST.ADDR | DST.PORT | DATA
+			packet := make([]byte, 0, n+22)
+			packet = append(packet, 0, 0, 0)
+			packet = appendAddr(packet, from)
+			packet = append(packet, buf[:n]...)
+			relay.WriteToUDP(packet, clientAddr)
+		}
+	}
+}
+
+func (srv *Server) relayFromClient(ctx context.Context, relay *net.UDPConn, req *Request, packet []byte) {
+	// Fragmentation is not supported, such datagrams are dropped
+	if len(packet) < 3 || packet[2] != 0 {
+		return
+	}
+
+	reader := bytes.NewReader(packet[3:])
+	addr, err := readAddr(reader)
+	if err != nil {
+		return
+	}
+
+	if srv.Rules != nil {
+		datagramReq := &Request{
+			Command:    CommandAssociate,
+			Username:   req.Username,
+			RemoteAddr: req.RemoteAddr,
+			DestAddr:   addr,
+		}
+		if !srv.Rules.Allow(ctx, datagramReq) {
+			return
+		}
+	}
+
+	target, err := net.ResolveUDPAddr("udp", addr.String())
+	if err != nil {
+		return
+	}
+	relay.WriteToUDP(packet[len(packet)-reader.Len():], target)
+}
@@ -14,4 +14,24 @@ var (
 	ErrTrailerEOF              = NewOpError("read", "unexpected EOF reading trailer")
 	ErrUnknownTransferEncoding = NewOpError("http", "unknown transfer encoding")
 	ErrUnknownContentEncoding  = NewOpError("http", "unknown content encoding")
+	ErrPublicKeyPinMismatch    = NewOpError("tls", "certificate public key pin mismatch")
+	ErrNoUpstreamAvailable     = NewOpError("upstream", "no available upstream")
+	ErrProxyProtocol           = NewOpError("proxy", "invalid PROXY protocol header")
+	ErrSlowClient              = NewOpError("read", "client is slower than minimum read rate")
+	ErrClientDisconnected      = NewOpError("read", "client disconnected")
+)
+
+// Errors of the strict parsing of the request message head,
+// each of them denotes a message which may be interpreted differently
+// by intermediaries and is known to be used for request smuggling.
+var (
+	ErrContentLengthWithTransferEncoding = NewOpError("parsing", "both content-length and transfer-encoding")
+	ErrConflictingContentLength          = NewOpError("parsing", "duplicate or conflicting content-length")
+	ErrChunkedNotLast                    = NewOpError("parsing", "chunked is not the last transfer coding")
+	ErrObsoleteLineFolding               = NewOpError("parsing", "obsolete header line folding")
+	ErrSpaceBeforeColon                  = NewOpError("parsing", "whitespace before header colon")
+	ErrInvalidHeaderName                 = NewOpError("parsing", "invalid header field name")
+	ErrInvalidHeaderValue                = NewOpError("parsing", "invalid header field value")
+	ErrBareLineFeed                      = NewOpError("parsing", "line is not terminated by CRLF")
+	ErrUnexpectedBody                    = NewOpError("parsing", "unexpected body of request method")
 )
@@ -0,0 +1,15 @@
+package plow
+
+import "crypto/tls"
+
+// TLSState returns the TLS connection state of the [Request] received over TLS,
+// such as the server name (SNI), negotiated version and cipher suite,
+// ALPN protocol and verified certificate chains of the client.
+//
+// Returns nil if the request is not received over TLS.
+func TLSState(req Request) *tls.ConnectionState {
+	if tlsReq, ok := req.(interface{ TLS() *tls.ConnectionState }); ok {
+		return tlsReq.TLS()
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package plow
+
+import "github.com/oesand/plow/specs"
+
+// Trailer returns the trailer fields received after the chunked body
+// of the [Request], see [TrailerReader].
+//
+// Returns nil until the body is read up to EOF, if trailer was not sent
+// or if the request does not provide it.
+func Trailer(req Request) *specs.Header {
+	if reader, ok := req.(TrailerReader); ok {
+		return reader.Trailer()
+	}
+	return nil
+}
+
+// ResponseTrailer returns the trailer fields received after the chunked body
+// of the [ClientResponse], see [TrailerReader].
+//
+// Returns nil until the body is read up to EOF, if trailer was not sent
+// or if the response does not provide it.
+func ResponseTrailer(resp ClientResponse) *specs.Header {
+	if reader, ok := resp.(TrailerReader); ok {
+		return reader.Trailer()
+	}
+	return nil
+}
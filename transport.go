@@ -17,6 +17,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -48,6 +49,20 @@ type Transport struct {
 	// If Dialer is nil then the transport dials using package net
 	Dialer Dialer
 
+	// Resolver specifies the resolver for looking up host addresses.
+	//
+	// If Resolver is set, connection is established by racing
+	// resolved IPv6 and IPv4 addresses according to
+	// Happy Eyeballs (RFC 8305) with the Dialer.
+	// If Resolver is nil then host is passed to the Dialer as is.
+	Resolver Resolver
+
+	// ConnectAttemptDelay specifies the delay between starting
+	// racing connection attempts to resolved addresses.
+	//
+	// If zero, a default delay of 250ms is used.
+	ConnectAttemptDelay time.Duration
+
 	// Proxy specifies a function to return a proxy for a given
 	// Request. If the function returns a non-nil error, the
 	// request is aborted with the provided error.
@@ -57,6 +72,11 @@ type Transport struct {
 	// "http" is assumed.
 	// "socks5" is treated the same as "socks5h".
 	//
+	// Plain http requests are forwarded by "http" proxy as is, while
+	// for https requests a tunnel is established by the CONNECT method.
+	// With "https" proxy the connection to the proxy itself is
+	// secured by TLS (see ProxyTLSConfig) and a tunnel is always established.
+	//
 	// If the proxy specs.Url contains a username & password subcomponents,
 	// the proxy request will pass the username and password
 	// in a `Proxy-Authorization` header.
@@ -64,6 +84,21 @@ type Transport struct {
 	// If Proxy is nil or returns a nil *specs.Url, no proxy is used.
 	Proxy func(url *specs.Url) (*specs.Url, error)
 
+	// ProxyChain specifies a function to return a chain of proxies
+	// for a given Request, each proxy establishes a tunnel to the next one,
+	// the last one to the request host. Every hop is handled as described in Proxy,
+	// with its own scheme and credentials.
+	//
+	// If ProxyChain is set, Proxy is ignored.
+	// If ProxyChain returns an empty chain, no proxy is used.
+	ProxyChain func(url *specs.Url) ([]*specs.Url, error)
+
+	// ProxyTLSConfig specifies the TLS configuration to use
+	// for connections to "https" proxies.
+	//
+	// If nil, the default configuration is used.
+	ProxyTLSConfig *tls.Config
+
 	// ProxyDialTimeout specifies the maximum amount of time to
 	// wait for a Proxy establish connection.
 	//
@@ -86,6 +121,16 @@ type Transport struct {
 	// If non-nil, HTTP/2 support may not be enabled by default.
 	TLSConfig *tls.Config
 
+	// TLSHosts specifies TLS parameters per host name, such as
+	// client certificates for mutual TLS, root CAs and public key pinning,
+	// applied on top of the TLSConfig.
+	//
+	// Keys are host names without port, a key in the form "*.example.com"
+	// matches a single level of subdomains and used when there is no exact match.
+	//
+	// TLSHosts is ignored when TLSDialer is set.
+	TLSHosts map[string]*TLSHostConfig
+
 	// TLSHandshakeTimeout specifies the maximum amount of time to
 	// wait for a TLS handshake. Zero means no timeout.
 	TLSHandshakeTimeout time.Duration
@@ -95,6 +140,12 @@ type Transport struct {
 	// there will be no timeout.
 	ReadTimeout time.Duration
 
+	// ResponseHeaderTimeout is the maximum duration to wait for
+	// the response headline and headers after the request is written,
+	// the body is not limited by it, such as of streamed responses.
+	// A zero or negative value means there will be no timeout.
+	ResponseHeaderTimeout time.Duration
+
 	// WriteTimeout is the maximum duration before timing out
 	// writes of the request. A zero or negative value means
 	// there will be no timeout.
@@ -123,7 +174,9 @@ type Transport struct {
 	// to read response body size.
 	//
 	// The client returns specs.ErrTooLarge if this limit is greater than 0
-	// and response body is greater than the limit.
+	// and response body is greater than the limit by "Content-Length",
+	// otherwise reading of the body fails with specs.ErrTooLarge once it exceeds the limit,
+	// such as of chunked or decoded bodies.
 	//
 	// By default, response body size is unlimited.
 	MaxBodySize int64
@@ -156,45 +209,25 @@ func (transport *Transport) RoundTrip(ctx context.Context, method specs.HttpMeth
 		}
 	}
 
-	var err error
-	var proxyUrl *specs.Url
-	if transport.Proxy != nil {
-		proxyUrl, err = transport.Proxy(url)
-		if err != nil {
-			return nil, err
-		}
+	proxyChain, err := transport.proxyChain(url)
+	if err != nil {
+		return nil, err
 	}
 
-	host := client_ops.IdnaHost(url.Host)
-	if proxyUrl != nil {
-		if proxyUrl.Host == "" {
-			return nil, fmt.Errorf("invalid proxy url '%s' host", url.Host)
-		}
-
-		if proxyUrl.Scheme == "http" && url.Scheme == "https" {
-			proxyUrl.Scheme = url.Scheme
-		}
-
-		switch proxyUrl.Scheme {
-		case "http":
-			header.Set("Host", client_ops.HostHeader(host, url.Port, true))
-			if proxyUrl.Username != "" {
-				proxy.WithAuthHeader(header, proxyUrl.Username, proxyUrl.Password)
-			}
-		case "https", "socks5", "socks5h":
-			header.Set("Host", client_ops.HostHeader(host, url.Port, false))
-		default:
-			return nil, fmt.Errorf("unsupported proxy '%s' scheme", url.Scheme)
-		}
-
-		proxyUrl.Host = client_ops.IdnaHost(proxyUrl.Host)
-		if proxyUrl.Port == 0 {
-			proxyUrl.Port = proxy.SchemeDefaultPortMap[proxyUrl.Scheme]
+	// Plain http requests are forwarded by the last http proxy,
+	// otherwise a tunnel to the host is established.
+	var forwardProxy bool
+	if len(proxyChain) > 0 {
+		lastProxy := proxyChain[len(proxyChain)-1]
+		forwardProxy = lastProxy.Scheme == "http" && url.Scheme == "http"
+		if forwardProxy && lastProxy.Username != "" {
+			proxy.WithAuthHeader(header, lastProxy.Username, lastProxy.Password)
 		}
-	} else {
-		header.Set("Host", client_ops.HostHeader(host, url.Port, false))
 	}
 
+	host := client_ops.IdnaHost(url.Host)
+	header.Set("Host", client_ops.HostHeader(host, url.Port, forwardProxy))
+
 	if !header.Has("Accept") {
 		header.Set("Accept", "*/*")
 	}
@@ -225,6 +258,17 @@ func (transport *Transport) RoundTrip(ctx context.Context, method specs.HttpMeth
 
 	mustWriteBody := method.IsPostable() && writer != nil
 
+	var trailer *specs.Header
+	if trailerWriter, ok := writer.(TrailerWriter); ok && mustWriteBody {
+		if trailer = trailerWriter.Trailer(); trailer != nil && trailer.Any() {
+			isChunked = true
+			header.Set("Transfer-Encoding", "chunked")
+			header.Set("Trailer", encoding.TrailerNames(trailer))
+		} else {
+			trailer = nil
+		}
+	}
+
 	if !isChunked && mustWriteBody {
 		contentLength := writer.ContentLength()
 		if contentLength > 0 {
@@ -233,21 +277,27 @@ func (transport *Transport) RoundTrip(ctx context.Context, method specs.HttpMeth
 	}
 
 	var conn net.Conn
-	if proxyUrl != nil {
-		conn, err = transport.dial(ctx, proxyUrl.Host, proxyUrl.Port)
+	if len(proxyChain) > 0 {
+		conn, err = transport.dial(withoutDialGuard(ctx), proxyChain[0].Host, proxyChain[0].Port)
 		if err != nil {
 			return nil, catch.TryWrapOpErr("dial", err)
 		}
 
-		var proxyCreds *proxy.Creds
-		if proxyUrl.Username != "" {
-			proxyCreds = &proxy.Creds{Username: proxyUrl.Username, Password: proxyUrl.Password}
-		}
+		for i, hop := range proxyChain {
+			nextHost, nextPort := host, url.Port
+			if i+1 < len(proxyChain) {
+				nextHost, nextPort = proxyChain[i+1].Host, proxyChain[i+1].Port
+			} else if forwardProxy {
+				break
+			}
 
-		err = transport.dialProxy(ctx, conn, proxyUrl.Scheme, host, url.Port, proxyCreds)
-		if err != nil {
-			conn.Close()
-			return nil, catch.TryWrapOpErr("proxy", err)
+			var hopConn net.Conn
+			hopConn, err = transport.dialProxy(ctx, conn, hop, nextHost, nextPort)
+			if err != nil {
+				conn.Close()
+				return nil, catch.TryWrapOpErr("proxy", err)
+			}
+			conn = hopConn
 		}
 	} else {
 		conn, err = transport.dial(ctx, host, url.Port)
@@ -275,25 +325,38 @@ func (transport *Transport) RoundTrip(ctx context.Context, method specs.HttpMeth
 		defer conn.SetWriteDeadline(time.Time{})
 	}
 
-	_, err = client_ops.WriteRequestHead(conn, method, url.Path, url.Query, header)
+	requestPath := url.Path
+	if forwardProxy {
+		// RFC 7230, section 5.3.2: absolute-form is required for requests to a proxy.
+		requestPath = url.Scheme + "://" + client_ops.HostHeader(host, url.Port, true) + url.Path
+		if url.Path == "" {
+			requestPath += "/"
+		}
+	}
+
+	trace := ContextClientTrace(ctx)
+
+	_, err = client_ops.WriteRequestHead(conn, method, requestPath, url.Query, header)
 
 	if err == nil {
 		err = ctx.Err()
 	}
 	if err = catch.CatchCommonErr(err); err != nil {
-		return nil, catch.TryWrapOpErr("write", err)
+		err = catch.TryWrapOpErr("write", err)
+		trace.wroteRequest(err)
+		return nil, err
 	}
 
-	// Expect 100 Continue support
-	expectContinue := mustWriteBody && strings.EqualFold(header.Get("Expect"), "100-continue")
-	if expectContinue {
-		goto reading
-	}
+	trace.wroteHeaders()
 
-writeBody:
-	if mustWriteBody {
+	writeBody := func() error {
+		if !mustWriteBody {
+			return nil
+		}
+
+		var err error
 		if isChunked {
-			chunkedWriter := encoding.NewChunkedWriter(conn)
+			chunkedWriter := encoding.NewChunkedTrailerWriter(conn, trailer)
 			err = writer.WriteBody(chunkedWriter)
 			chunkedWriter.Close()
 		} else {
@@ -303,14 +366,17 @@ writeBody:
 		if err == nil {
 			err = ctx.Err()
 		}
-		if err != nil {
-			return nil, catch.CatchCommonErr(err)
-		}
+		return catch.CatchCommonErr(err)
 	}
 
-reading:
-	if transport.ReadTimeout > 0 {
-		conn.SetReadDeadline(time.Now().Add(transport.ReadTimeout))
+	// Expect 100 Continue support, the body is written after the "100 Continue" response
+	expectContinue := mustWriteBody && strings.EqualFold(header.Get("Expect"), "100-continue")
+	if !expectContinue {
+		err = writeBody()
+		trace.wroteRequest(err)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	bufioReader := stream.DefaultBufioReaderPool.Get(conn)
@@ -318,25 +384,73 @@ reading:
 		stream.DefaultBufioReaderPool.Put(bufioReader)
 	})
 
+	var gotFirstByte bool
+
+reading:
+	var readDeadline time.Time
+	if transport.ReadTimeout > 0 {
+		readDeadline = time.Now().Add(transport.ReadTimeout)
+	}
+	headDeadline := readDeadline
+	if transport.ResponseHeaderTimeout > 0 {
+		deadline := time.Now().Add(transport.ResponseHeaderTimeout)
+		if headDeadline.IsZero() || deadline.Before(headDeadline) {
+			headDeadline = deadline
+		}
+	}
+	conn.SetReadDeadline(headDeadline)
+
+	if trace != nil && !gotFirstByte {
+		if _, err = bufioReader.Peek(1); err == nil {
+			gotFirstByte = true
+			trace.gotFirstResponseByte()
+		}
+	}
+
 	resp, err := client_ops.ReadResponse(ctx, bufioReader, transport.ReadLineMaxLength, transport.HeadMaxLength)
 
 	if err == nil {
 		err = ctx.Err()
 	}
 	if err != nil {
-		return nil, catch.CatchCommonErr(err)
+		err = catch.CatchCommonErr(err)
+		if expectContinue {
+			trace.wroteRequest(err)
+		}
+		return nil, err
 	}
 
-	if expectContinue && resp.StatusCode() == specs.StatusCodeContinue {
+	resp.Addr = conn.RemoteAddr()
+
+	if !headDeadline.Equal(readDeadline) {
+		conn.SetReadDeadline(readDeadline)
+	}
+
+	if expectContinue {
 		expectContinue = false
-		goto writeBody
+
+		if resp.StatusCode() == specs.StatusCodeContinue {
+			trace.got100Continue()
+
+			err = writeBody()
+			trace.wroteRequest(err)
+			if err != nil {
+				return nil, err
+			}
+			goto reading
+		}
+
+		// The final response is received without "100 Continue",
+		// so the body is not sent
+		trace.wroteRequest(nil)
 	}
 
 	hijacker, hasHijacker := ctx.Value(transportHijackerKey).(*TransportHijacker)
 
 	if !method.IsReplyable() || !resp.StatusCode().IsReplyable() {
 		if hasHijacker && !strings.EqualFold(header.Get("Connection"), "close") {
-			hijacker.Conn = conn
+			// The data of the switched protocol can be read along with the response
+			hijacker.Conn = stream.BufferedConn(conn, bufioReader)
 			cancelCloseConn()
 		}
 	} else {
@@ -346,11 +460,10 @@ reading:
 		}
 
 		var contentLength int64
-		isChunked, contentLength, err = parsing.ParseContentLength(resp.Header())
+		isChunked, contentLength, err = parsing.ParseContentLength(resp.Header(), false)
 		if err != nil {
 			if errors.Is(err, parsing.ErrParsing) {
 				// Fail to parse Content-Length
-				stream.DefaultBufioReaderPool.Put(bufioReader)
 				if hasHijacker {
 					return nil, err
 				}
@@ -358,28 +471,38 @@ reading:
 				return nil, err
 			}
 		} else if isChunked || contentLength > 0 {
-			if transport.MaxBodySize > 0 {
-				if isChunked {
-					contentLength = transport.MaxBodySize
-				} else if contentLength > transport.MaxBodySize {
-					return nil, specs.ErrTooLarge
-				}
+			if transport.MaxBodySize > 0 && contentLength > transport.MaxBodySize {
+				return nil, specs.ErrTooLarge
+			}
+
+			var reader io.Reader = bufioReader
+			if isChunked {
+				resp.ChunkedReader = encoding.NewChunkedReader(bufioReader, transport.ReadLineMaxLength, transport.HeadMaxLength)
+				reader = resp.ChunkedReader
+			} else {
+				reader = io.LimitReader(reader, contentLength)
 			}
 
-			encodingReader, err := encoding.NewReader(isChunked, contentEncoding, bufioReader)
+			encodingReader, err := encoding.NewReader(contentEncoding, reader)
 			if err != nil {
 				return nil, err
 			}
 
 			var bodyReader io.Reader = encodingReader
 
-			if contentLength > 0 {
-				bodyReader = io.LimitReader(bodyReader, contentLength)
+			// Reading fails once the limit is exceeded, so the body of unknown size
+			// or the decoded body is not cut off silently
+			if transport.MaxBodySize > 0 {
+				bodyReader = &stream.LimitedReader{R: encodingReader, N: transport.MaxBodySize}
 			}
 
 			cancelCloseConn()
+			var releaseOnce sync.Once
 			resp.Reader = internal.ReadCloser(bodyReader, internal.CloserFunc(func() error {
-				stream.DefaultBufioReaderPool.Put(bufioReader)
+				// The reader is reused by the pool, so it is put back only once
+				releaseOnce.Do(func() {
+					stream.DefaultBufioReaderPool.Put(bufioReader)
+				})
 
 				err := encodingReader.Close()
 				err1 := conn.Close()
@@ -391,7 +514,11 @@ reading:
 		}
 
 		if hasHijacker {
-			hijacker.Conn = conn
+			if resp.Reader == nil {
+				hijacker.Conn = stream.BufferedConn(conn, bufioReader)
+			} else {
+				hijacker.Conn = conn
+			}
 			cancelCloseConn()
 		}
 	}
@@ -400,43 +527,155 @@ reading:
 }
 
 func (transport *Transport) dial(ctx context.Context, host string, port uint16) (net.Conn, error) {
-	address := client_ops.HostPort(host, port)
+	if transport.Resolver == nil || client_ops.ParseHostIP(host) != nil {
+		conn, err := transport.dialAddress(ctx, client_ops.HostPort(host, port))
+		return conn, catch.CatchCommonErr(err)
+	}
+
+	trace := ContextClientTrace(ctx)
+	trace.dnsStart(host)
+	ips, err := transport.Resolver.Resolve(ctx, host)
+	trace.dnsDone(ips, err)
+	if err != nil {
+		return nil, catch.TryWrapOpErr("dns", catch.CatchCommonErr(err))
+	}
+	if len(ips) == 0 {
+		return nil, specs.NewOpError("dns", "no addresses found for host '%s'", host)
+	}
+
+	conn, err := client_ops.DialParallel(ctx, ips, port, transport.ConnectAttemptDelay, transport.dialAddress)
+	return conn, catch.CatchCommonErr(err)
+}
+
+func (transport *Transport) dialAddress(ctx context.Context, address string) (net.Conn, error) {
+	trace := ContextClientTrace(ctx)
+	trace.connectStart("tcp", address)
 
 	var conn net.Conn
 	var err error
-	if transport.Dialer != nil {
+	if guard := contextDialGuard(ctx); guard != nil {
+		conn, err = guard.dial(ctx, transport.Dialer, address)
+	} else if transport.Dialer != nil {
 		conn, err = transport.Dialer.Dial(ctx, "tcp", address)
 	} else {
 		conn, err = defaultDialer.DialContext(ctx, "tcp", address)
 	}
 
-	return conn, catch.CatchCommonErr(err)
+	trace.connectDone("tcp", address, err)
+	return conn, err
+}
+
+func (transport *Transport) proxyChain(url *specs.Url) ([]*specs.Url, error) {
+	var chain []*specs.Url
+	if transport.ProxyChain != nil {
+		var err error
+		chain, err = transport.ProxyChain(url)
+		if err != nil {
+			return nil, err
+		}
+	} else if transport.Proxy != nil {
+		proxyUrl, err := transport.Proxy(url)
+		if err != nil {
+			return nil, err
+		}
+		if proxyUrl != nil {
+			chain = []*specs.Url{proxyUrl}
+		}
+	}
+
+	for _, proxyUrl := range chain {
+		if proxyUrl == nil || proxyUrl.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url '%s' host", proxyUrl)
+		}
+
+		switch proxyUrl.Scheme {
+		case "":
+			proxyUrl.Scheme = "http"
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy '%s' scheme", proxyUrl.Scheme)
+		}
+
+		proxyUrl.Host = client_ops.IdnaHost(proxyUrl.Host)
+		if proxyUrl.Port == 0 {
+			proxyUrl.Port = proxy.SchemeDefaultPortMap[proxyUrl.Scheme]
+		}
+	}
+
+	return chain, nil
 }
 
-func (transport *Transport) dialProxy(ctx context.Context, conn net.Conn, scheme, host string, port uint16, creds *proxy.Creds) error {
-	if scheme == "http" {
-		return nil
+func (transport *Transport) dialProxy(ctx context.Context, conn net.Conn, proxyUrl *specs.Url, host string, port uint16) (net.Conn, error) {
+	var creds *proxy.Creds
+	if proxyUrl.Username != "" {
+		creds = &proxy.Creds{Username: proxyUrl.Username, Password: proxyUrl.Password}
 	}
+
+	trace := ContextClientTrace(ctx)
+	trace.proxyHandshakeStart(proxyUrl)
+
 	if transport.ProxyDialTimeout > 0 {
 		conn.SetDeadline(time.Now().Add(transport.ProxyDialTimeout))
 		defer conn.SetDeadline(time.Time{})
 	}
-	return catch.CallWithTimeoutContextErr(ctx, transport.ProxyDialTimeout, func(ctx context.Context) error {
+	proxyConn, err := catch.CallWithTimeoutContext(ctx, transport.ProxyDialTimeout, func(ctx context.Context) (net.Conn, error) {
 		var err error
-		switch scheme {
+		switch proxyUrl.Scheme {
+		case "http":
+			err = proxy.DialHttps(conn, host, port, creds)
 		case "https":
+			var tlsConn *tls.Conn
+			tlsConn, err = transport.dialProxyTls(ctx, conn, proxyUrl.Host)
+			if err != nil {
+				return nil, err
+			}
+			conn = tlsConn
 			err = proxy.DialHttps(conn, host, port, creds)
 		case "socks5", "socks5h":
 			_, err = proxy.DialSocks5(conn, host, port, creds)
 		default:
-			panic(fmt.Sprintf("plow: not implemented proxy '%s' scheme dialer", scheme))
+			panic(fmt.Sprintf("plow: not implemented proxy '%s' scheme dialer", proxyUrl.Scheme))
+		}
+		if err != nil {
+			return nil, err
 		}
-		return err
+		return conn, nil
 	})
+
+	trace.proxyHandshakeDone(proxyUrl, err)
+	return proxyConn, err
+}
+
+func (transport *Transport) dialProxyTls(ctx context.Context, conn net.Conn, host string) (*tls.Conn, error) {
+	var tlsCfg *tls.Config
+	if transport.ProxyTLSConfig == nil {
+		tlsCfg = &tls.Config{}
+	} else {
+		tlsCfg = transport.ProxyTLSConfig.Clone()
+	}
+
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName = host
+	}
+
+	if hostCfg := transport.tlsHostConfig(host); hostCfg != nil {
+		if err := applyTLSHostConfig(tlsCfg, hostCfg); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConn := tls.Client(conn, tlsCfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
 }
 
 func (transport *Transport) dialTls(ctx context.Context, conn net.Conn, host string) (net.Conn, error) {
-	return catch.CallWithTimeoutContext(ctx, transport.TLSHandshakeTimeout, func(ctx context.Context) (net.Conn, error) {
+	trace := ContextClientTrace(ctx)
+	trace.tlsHandshakeStart()
+
+	tlsConn, err := catch.CallWithTimeoutContext(ctx, transport.TLSHandshakeTimeout, func(ctx context.Context) (net.Conn, error) {
 		if transport.TLSDialer != nil {
 			return transport.TLSDialer.Handshake(ctx, conn, host)
 		} else {
@@ -452,6 +691,12 @@ func (transport *Transport) dialTls(ctx context.Context, conn net.Conn, host str
 				tlsCfg.ServerName = host
 			}
 
+			if hostCfg := transport.tlsHostConfig(host); hostCfg != nil {
+				if err := applyTLSHostConfig(tlsCfg, hostCfg); err != nil {
+					return nil, err
+				}
+			}
+
 			tlsConn := tls.Client(conn, tlsCfg)
 			err := tlsConn.HandshakeContext(ctx)
 			if err != nil {
@@ -460,6 +705,9 @@ func (transport *Transport) dialTls(ctx context.Context, conn net.Conn, host str
 			return tlsConn, nil
 		}
 	})
+
+	trace.tlsHandshakeDone(tlsConn, err)
+	return tlsConn, err
 }
 
 var transportHijackerKey = internal.FlagKey{Key: "transport.hijacker.key"}
@@ -10,9 +10,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/andybalholm/brotli"
-	"github.com/armon/go-socks5"
 	"github.com/oesand/plow/internal/encoding"
 	"github.com/oesand/plow/internal/server_ops"
+	"github.com/oesand/plow/socks5"
 	"github.com/oesand/plow/specs"
 	"io"
 	"net"
@@ -182,7 +182,7 @@ func TestTransport_PostChunkedTransferEncodingRequest(t *testing.T) {
 		}
 
 		reader := bufio.NewReader(conn)
-		req, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), reader, 1024, 8024)
+		req, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), reader, 1024, 8024, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -192,7 +192,7 @@ func TestTransport_PostChunkedTransferEncodingRequest(t *testing.T) {
 			t.Errorf("not found expected headers: %+v", req.Header())
 		}
 
-		cr := encoding.NewChunkedReader(reader)
+		cr := encoding.NewChunkedReader(reader, 0, 0)
 		b, err := io.ReadAll(cr)
 		if err != nil {
 			t.Fatalf("Read all: %s", err)
@@ -228,6 +228,121 @@ func TestTransport_PostChunkedTransferEncodingRequest(t *testing.T) {
 	checkResponseBody(t, resp, []byte("received"))
 }
 
+func TestTransport_ChunkedTrailerResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("streamed"))
+		w.(http.Flusher).Flush()
+		w.Header().Set("X-Checksum", "abc-123")
+	}))
+	defer server.Close()
+
+	resp, err := DefaultTransport().RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl(server.URL), specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	if ResponseTrailer(resp) != nil {
+		t.Error("trailer must be nil before body EOF")
+	}
+
+	checkResponseBody(t, resp, []byte("streamed"))
+
+	if trailer := ResponseTrailer(resp); trailer == nil || trailer.Get("X-Checksum") != "abc-123" {
+		t.Errorf("not found expected trailer, %+v", trailer)
+	}
+}
+
+func TestTransport_ChunkedResponseTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("chunk "), 64))
+		w.(http.Flusher).Flush()
+	}))
+	defer server.Close()
+
+	transport := DefaultTransport()
+	transport.MaxBodySize = 100
+
+	resp, err := transport.RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl(server.URL), specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	defer resp.Body().Close()
+
+	body, err := io.ReadAll(resp.Body())
+	if !errors.Is(err, specs.ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+	if len(body) != 100 {
+		t.Errorf("unexpected body size: %d", len(body))
+	}
+}
+
+func TestTransport_ResponseHeaderTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-head" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.Write([]byte("first "))
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("second"))
+	}))
+	defer server.Close()
+
+	transport := DefaultTransport()
+	transport.ReadTimeout = 0
+	transport.ResponseHeaderTimeout = 100 * time.Millisecond
+
+	resp, err := transport.RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl(server.URL+"/slow-body"), specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	checkResponseBody(t, resp, []byte("first second"))
+
+	_, err = transport.RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl(server.URL+"/slow-head"), specs.NewHeader(), nil)
+	if !errors.Is(err, specs.ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+}
+
+func TestTransport_PostChunkedTrailerRequestHttpTest(t *testing.T) {
+	requestBody := []byte(`{"key": "value"}`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, has := r.Trailer["X-Checksum"]; !has {
+			t.Errorf("not found expected declared trailer: %+v", r.Trailer)
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+
+		if !bytes.Equal(b, requestBody) {
+			t.Errorf("expected %s, got %s", string(requestBody), string(b))
+		}
+		if r.Trailer.Get("X-Checksum") != "abc-123" {
+			t.Errorf("not found expected trailer: %+v", r.Trailer)
+		}
+		w.Write([]byte("received"))
+	}))
+	defer server.Close()
+
+	req := StreamRequest(specs.HttpMethodPost, specs.MustParseUrl(server.URL), specs.ContentTypePlain, bytes.NewReader(requestBody), int64(len(requestBody)))
+	req.(TrailerWriter).Trailer().Set("X-Checksum", "abc-123")
+
+	resp, err := DefaultTransport().RoundTrip(
+		context.Background(), req.Method(), req.Url(), req.Header(), req.(BodyWriter))
+
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	checkResponseBody(t, resp, []byte("received"))
+}
+
 // Test content encoding
 
 func TestTransport_GzipEncoding(t *testing.T) {
@@ -499,10 +614,7 @@ func TestTransport_Sock5Proxy(t *testing.T) {
 	})
 	defer closeServer()
 
-	proxyServer, err := socks5.New(&socks5.Config{})
-	if err != nil {
-		t.Fatal(err)
-	}
+	proxyServer := socks5.DefaultServer()
 
 	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -526,7 +638,7 @@ func TestTransport_Sock5Proxy(t *testing.T) {
 			break
 		}
 		connectedProxy.Store(true)
-		if err := proxyServer.ServeConn(conn); err != nil {
+		if err := proxyServer.ServeConn(context.Background(), conn); err != nil {
 			t.Error(err)
 		}
 	}()
@@ -569,13 +681,9 @@ func TestTransport_Sock5ProxyAuth(t *testing.T) {
 	})
 	defer closeServer()
 
-	proxyServer, err := socks5.New(&socks5.Config{
-		Credentials: &socks5.StaticCredentials{
-			"username": "password",
-		},
-	})
-	if err != nil {
-		t.Fatal(err)
+	proxyServer := socks5.DefaultServer()
+	proxyServer.Authenticate = func(username, password string) bool {
+		return username == "username" && password == "password"
 	}
 
 	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
@@ -600,7 +708,7 @@ func TestTransport_Sock5ProxyAuth(t *testing.T) {
 			break
 		}
 		connectedProxy.Store(true)
-		if err := proxyServer.ServeConn(conn); err != nil {
+		if err := proxyServer.ServeConn(context.Background(), conn); err != nil {
 			t.Error(err)
 		}
 	}()
@@ -734,7 +842,7 @@ func TestTransport_HttpsProxy(t *testing.T) {
 
 	var connectedProxy atomic.Bool
 
-	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	proxyServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		destConn, err := net.Dial("tcp", r.Host)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusServiceUnavailable)
@@ -773,6 +881,7 @@ func TestTransport_HttpsProxy(t *testing.T) {
 	header.Set("x-ping", "xyz-123")
 
 	transport := DefaultTransport()
+	transport.ProxyTLSConfig = &tls.Config{InsecureSkipVerify: true}
 	proxyUrl.Scheme = "https"
 	transport.Proxy = FixedProxyUrl(proxyUrl)
 
@@ -811,7 +920,7 @@ func TestTransport_HttpsProxyAuth(t *testing.T) {
 
 	var connectedProxy atomic.Bool
 
-	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	proxyServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("Proxy-Authorization") != specs.BasicAuthHeader("usern", "pass") {
 			user, pass, _ := specs.ParseBasicAuthHeader(r.Header.Get("Proxy-Authorization"))
 			t.Errorf("invalid creds: %s : %s", user, pass)
@@ -857,6 +966,7 @@ func TestTransport_HttpsProxyAuth(t *testing.T) {
 	header.Set("x-ping", "xyz-123")
 
 	transport := DefaultTransport()
+	transport.ProxyTLSConfig = &tls.Config{InsecureSkipVerify: true}
 	proxyUrl.Scheme = "https"
 	proxyUrl.Username = "usern"
 	proxyUrl.Password = "pass"
@@ -888,7 +998,7 @@ func TestTransport_Expect100ContinueRaw(t *testing.T) {
 	defer cancel()
 	url, err := serveTcpTest(ctx, func(conn net.Conn) {
 		bufioReader := bufio.NewReader(conn)
-		req, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), bufioReader, 1024, 8*1024)
+		req, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), bufioReader, 1024, 8*1024, false)
 		if err != nil {
 			t.Error(err)
 		}
@@ -956,7 +1066,7 @@ func TestTransport_Expect100ContinueAndAnswerOK(t *testing.T) {
 	defer cancel()
 	url, err := serveTcpTest(ctx, func(conn net.Conn) {
 		bufioReader := bufio.NewReader(conn)
-		req, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), bufioReader, 1024, 8*1024)
+		req, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), bufioReader, 1024, 8*1024, false)
 		if err != nil {
 			t.Error(err)
 		}
@@ -1033,7 +1143,7 @@ func TestTransport_Hijack(t *testing.T) {
 	url, err := serveTcpTest(ctx, func(conn net.Conn) {
 		// Reading
 		bufioReader := bufio.NewReader(conn)
-		req, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), bufioReader, 1024, 8*1024)
+		req, err := server_ops.ReadRequest(ctx, conn.RemoteAddr(), bufioReader, 1024, 8*1024, false)
 		if err != nil {
 			t.Error(err)
 		}
@@ -0,0 +1,135 @@
+package plow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/oesand/plow/specs"
+)
+
+// PublicKeyPinPrefix prefix of the pins in the "sha256/<base64>" form.
+const PublicKeyPinPrefix = "sha256/"
+
+// PublicKeyPin computes SHA-256 pin of the certificate
+// Subject Public Key Info in the "sha256/<base64>" form
+// that can be used in [TLSHostConfig.PinnedKeys].
+func PublicKeyPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return PublicKeyPinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// TLSHostConfig specifies TLS parameters of connections
+// to a particular host made by [Transport].
+type TLSHostConfig struct {
+	// Certificates contains one or more client certificate chains
+	// to present to the server for mutual TLS authentication.
+	//
+	// If empty, certificates of [Transport.TLSConfig] are used.
+	Certificates []tls.Certificate
+
+	// RootCAs defines the set of root certificate authorities
+	// that used to verify server certificates.
+	//
+	// If nil, roots of [Transport.TLSConfig] or the host's root CA set are used.
+	RootCAs *x509.CertPool
+
+	// PinnedKeys specifies SHA-256 hashes of the Subject Public Key Info
+	// of certificates which the server certificate chain must contain
+	// at least one, such as primary and backup pins.
+	//
+	// Pins are accepted in the "sha256/<base64>" form (see [PublicKeyPin])
+	// or as plain base64 encoded hash.
+	//
+	// If chain does not match any pin, the connection is
+	// aborted with [specs.ErrPublicKeyPinMismatch].
+	PinnedKeys []string
+}
+
+func (transport *Transport) tlsHostConfig(host string) *TLSHostConfig {
+	if len(transport.TLSHosts) == 0 {
+		return nil
+	}
+
+	host = strings.ToLower(host)
+	if conf, has := transport.TLSHosts[host]; has {
+		return conf
+	}
+
+	// Wildcard covers only one level of subdomain
+	if _, parent, ok := strings.Cut(host, "."); ok {
+		if conf, has := transport.TLSHosts["*."+parent]; has {
+			return conf
+		}
+	}
+
+	return nil
+}
+
+func applyTLSHostConfig(config *tls.Config, hostConfig *TLSHostConfig) error {
+	if len(hostConfig.Certificates) > 0 {
+		config.Certificates = hostConfig.Certificates
+		config.GetClientCertificate = nil
+	}
+
+	if hostConfig.RootCAs != nil {
+		config.RootCAs = hostConfig.RootCAs
+	}
+
+	if len(hostConfig.PinnedKeys) > 0 {
+		pins, err := decodePublicKeyPins(hostConfig.PinnedKeys)
+		if err != nil {
+			return err
+		}
+
+		verifyConnection := config.VerifyConnection
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if verifyConnection != nil {
+				if err := verifyConnection(state); err != nil {
+					return err
+				}
+			}
+			return verifyPublicKeyPins(state, pins)
+		}
+	}
+
+	return nil
+}
+
+func decodePublicKeyPins(pins []string) ([][]byte, error) {
+	decoded := make([][]byte, 0, len(pins))
+	for _, pin := range pins {
+		hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, PublicKeyPinPrefix))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid public key pin '%s'", pin)
+		}
+		decoded = append(decoded, hash)
+	}
+	return decoded, nil
+}
+
+func verifyPublicKeyPins(state tls.ConnectionState, pins [][]byte) error {
+	// Prefer verified chains, peer certificates are used
+	// only when verification is skipped.
+	chains := state.VerifiedChains
+	if len(chains) == 0 {
+		chains = [][]*x509.Certificate{state.PeerCertificates}
+	}
+
+	for _, chain := range chains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(sum[:], pin) {
+					return nil
+				}
+			}
+		}
+	}
+
+	return specs.ErrPublicKeyPinMismatch
+}
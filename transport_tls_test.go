@@ -0,0 +1,148 @@
+package plow
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/oesand/plow/internal/testing_ops"
+	"github.com/oesand/plow/specs"
+)
+
+func newTestTLSServer(t *testing.T, config *tls.Config) *specs.Url {
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, request Request) Response {
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, "OK")
+	}))
+	server.TLSConfig = config
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLSRaw(listener, testing_ops.NewTlsCert())
+	t.Cleanup(server.Shutdown)
+
+	return specs.MustParseUrl("https://" + listener.Addr().String())
+}
+
+func newTestRootCAs() *x509.CertPool {
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(testing_ops.LocalhostCert)
+	return roots
+}
+
+func testLocalhostPin(t *testing.T) string {
+	cert, err := x509.ParseCertificate(testing_ops.NewTlsCert().Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return PublicKeyPin(cert)
+}
+
+func TestTransport_TLSHostsClientCertificate(t *testing.T) {
+	var receivedCert atomic.Bool
+	url := newTestTLSServer(t, &tls.Config{
+		ClientAuth: tls.RequireAnyClientCert,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			receivedCert.Store(len(rawCerts) > 0)
+			return nil
+		},
+	})
+
+	transport := DefaultTransport()
+	transport.TLSHosts = map[string]*TLSHostConfig{
+		"127.0.0.1": {
+			Certificates: []tls.Certificate{testing_ops.NewTlsCert()},
+			RootCAs:      newTestRootCAs(),
+		},
+	}
+
+	resp, err := transport.RoundTrip(context.Background(), specs.HttpMethodGet, url, specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	checkResponseBody(t, resp, []byte("OK"))
+
+	if !receivedCert.Load() {
+		t.Error("server did not receive client certificate")
+	}
+
+	transport.TLSHosts = nil
+	transport.TLSConfig = &tls.Config{RootCAs: newTestRootCAs()}
+	_, err = transport.RoundTrip(context.Background(), specs.HttpMethodGet, url, specs.NewHeader(), nil)
+	if err == nil {
+		t.Error("expected error without client certificate")
+	}
+}
+
+func TestTransport_TLSHostsPinning(t *testing.T) {
+	url := newTestTLSServer(t, nil)
+	validPin := testLocalhostPin(t)
+	otherPin := "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	tests := []struct {
+		name    string
+		pins    []string
+		wantErr error
+	}{
+		{name: "Primary pin", pins: []string{validPin}},
+		{name: "Backup pin", pins: []string{otherPin, validPin}},
+		{name: "Plain base64 pin", pins: []string{validPin[len(PublicKeyPinPrefix):]}},
+		{name: "Mismatch", pins: []string{otherPin}, wantErr: specs.ErrPublicKeyPinMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := DefaultTransport()
+			transport.TLSHosts = map[string]*TLSHostConfig{
+				"127.0.0.1": {
+					RootCAs:    newTestRootCAs(),
+					PinnedKeys: tt.pins,
+				},
+			}
+
+			resp, err := transport.RoundTrip(context.Background(), specs.HttpMethodGet, url, specs.NewHeader(), nil)
+			if tt.wantErr != nil {
+				var opErr *specs.OpError
+				if !errors.Is(err, tt.wantErr) || !errors.As(err, &opErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("req:", err)
+			}
+			checkResponseBody(t, resp, []byte("OK"))
+		})
+	}
+}
+
+func TestTransport_TLSHostConfigLookup(t *testing.T) {
+	exact := &TLSHostConfig{}
+	wildcard := &TLSHostConfig{}
+	transport := &Transport{
+		TLSHosts: map[string]*TLSHostConfig{
+			"api.example.com": exact,
+			"*.example.com":   wildcard,
+		},
+	}
+
+	tests := []struct {
+		host string
+		want *TLSHostConfig
+	}{
+		{host: "api.example.com", want: exact},
+		{host: "API.Example.com", want: exact},
+		{host: "www.example.com", want: wildcard},
+		{host: "a.b.example.com", want: nil},
+		{host: "example.com", want: nil},
+	}
+	for _, tt := range tests {
+		if got := transport.tlsHostConfig(tt.host); got != tt.want {
+			t.Errorf("tlsHostConfig(%s) = %p, want %p", tt.host, got, tt.want)
+		}
+	}
+}
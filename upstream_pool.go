@@ -0,0 +1,576 @@
+package plow
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oesand/plow/internal"
+	"github.com/oesand/plow/specs"
+)
+
+// BalanceStrategy specifies how [UpstreamPool] selects
+// the upstream for each request.
+type BalanceStrategy int
+
+const (
+	// BalanceRoundRobin selects upstreams in turn.
+	BalanceRoundRobin BalanceStrategy = iota
+
+	// BalanceLeastConnections selects the upstream
+	// with the fewest active requests.
+	BalanceLeastConnections
+
+	// BalanceWeighted selects upstreams in turn
+	// proportionally to their weights (smooth weighted round-robin).
+	BalanceWeighted
+
+	// BalanceConsistentHash selects the upstream by hash of the
+	// request key (see [UpstreamPool.HashKey]), so requests with
+	// the same key reach the same upstream while it is available.
+	BalanceConsistentHash
+)
+
+// consistentHashReplicas number of points on the hash ring per weight unit.
+const consistentHashReplicas = 160
+
+// Upstream describes the server of the [UpstreamPool].
+type Upstream struct {
+	// Url specifies scheme, host, port and optional path prefix of the upstream.
+	Url *specs.Url
+
+	// Weight specifies relative weight of the upstream
+	// for [BalanceWeighted] and [BalanceConsistentHash] strategies.
+	//
+	// If zero or negative, weight 1 is used.
+	Weight int
+}
+
+// HealthCheck defines parameters of active health checks of [UpstreamPool].
+type HealthCheck struct {
+	// Path specifies the path requested on each upstream by GET method,
+	// the upstream is healthy while it responds with 2xx status code.
+	Path string
+
+	// Interval specifies the delay between health checks.
+	//
+	// If zero, a default interval of 10s is used.
+	Interval time.Duration
+
+	// Timeout specifies the maximum duration of a single health check.
+	//
+	// If zero, a default timeout of 5s is used.
+	Timeout time.Duration
+
+	// UnhealthyThreshold specifies the number of consecutive failed checks
+	// after which the upstream is marked as unhealthy.
+	//
+	// If zero, upstream is marked as unhealthy after the first failed check.
+	UnhealthyThreshold int
+
+	// HealthyThreshold specifies the number of consecutive successful checks
+	// after which the unhealthy upstream is marked as healthy again.
+	//
+	// If zero, upstream is marked as healthy after the first successful check.
+	HealthyThreshold int
+}
+
+// OutlierDetection defines parameters of passive ejection of [UpstreamPool]
+// upstreams which fail requests.
+type OutlierDetection struct {
+	// ConsecutiveErrors specifies the number of consecutive
+	// connection errors after which the upstream is ejected.
+	//
+	// If zero, connection errors do not eject upstreams.
+	ConsecutiveErrors int
+
+	// ServerErrorRatio specifies the ratio of responses with 5xx status codes
+	// within the Window after which the upstream is ejected.
+	//
+	// If zero, server errors do not eject upstreams.
+	ServerErrorRatio float64
+
+	// MinRequests specifies the minimum number of requests
+	// within the Window for the ServerErrorRatio to be evaluated.
+	MinRequests int
+
+	// Window specifies the duration over which the ServerErrorRatio is calculated.
+	//
+	// If zero, a default window of 30s is used.
+	Window time.Duration
+
+	// EjectionTime specifies the duration for which the upstream is ejected.
+	//
+	// If zero, a default ejection time of 30s is used.
+	EjectionTime time.Duration
+}
+
+// UpstreamStats contains the state and counters of the [UpstreamPool] upstream.
+type UpstreamStats struct {
+	// Url of the upstream.
+	Url *specs.Url
+
+	// Weight of the upstream.
+	Weight int
+
+	// Healthy reports whether the upstream passes active health checks.
+	Healthy bool
+
+	// Ejected reports whether the upstream is ejected by outlier detection.
+	Ejected bool
+
+	// ActiveRequests number of requests in flight,
+	// including responses whose body is not closed yet.
+	ActiveRequests int64
+
+	// TotalRequests number of requests sent to the upstream.
+	TotalRequests int64
+
+	// Failures number of requests failed with connection errors.
+	Failures int64
+
+	// ServerErrors number of responses with 5xx status codes.
+	ServerErrors int64
+
+	// Ejections number of times the upstream was ejected.
+	Ejections int64
+}
+
+// NewUpstreamPool creates [UpstreamPool] over provided upstreams
+// which selects them by the strategy.
+func NewUpstreamPool(strategy BalanceStrategy, upstreams ...Upstream) *UpstreamPool {
+	if len(upstreams) == 0 {
+		panic("plow: upstream pool requires at least one upstream")
+	}
+
+	pool := &UpstreamPool{
+		strategy: strategy,
+		states:   make([]*upstreamState, len(upstreams)),
+	}
+
+	for i, upstream := range upstreams {
+		if upstream.Url == nil || upstream.Url.Host == "" {
+			panic("plow: upstream url host must not be empty")
+		}
+		if upstream.Weight <= 0 {
+			upstream.Weight = 1
+		}
+		state := &upstreamState{upstream: upstream}
+		state.healthy.Store(true)
+		pool.states[i] = state
+	}
+
+	if strategy == BalanceConsistentHash {
+		pool.ring = newHashRing(pool.states)
+	}
+
+	return pool
+}
+
+// UpstreamPool is an implementation of [RoundTripper] which distributes
+// requests among upstreams by the [BalanceStrategy].
+//
+// Scheme, host and port of the request url are replaced by the selected
+// upstream url, its path is prepended to the request path.
+// Upstreams which fail active health checks or are ejected
+// by outlier detection are skipped.
+//
+// UpstreamPool must be created by [NewUpstreamPool].
+type UpstreamPool struct {
+	_ internal.NoCopy
+
+	// Transport specifies the mechanism by which requests to upstreams are made.
+	// If nil, the transport of [NewReverseProxy] is used.
+	Transport RoundTripper
+
+	// HashKey specifies the function returning the key of the request
+	// for [BalanceConsistentHash] strategy.
+	//
+	// If nil, the request path is used as the key.
+	HashKey func(url *specs.Url, header *specs.Header) string
+
+	// HealthCheck specifies parameters of active health checks,
+	// which are run by [UpstreamPool.RunHealthChecks].
+	//
+	// If nil, upstreams are always treated as healthy.
+	HealthCheck *HealthCheck
+
+	// OutlierDetection specifies parameters of passive ejection of upstreams.
+	//
+	// If nil, upstreams are never ejected.
+	OutlierDetection *OutlierDetection
+
+	strategy BalanceStrategy
+	states   []*upstreamState
+	ring     *hashRing
+
+	next atomic.Uint64
+	mu   sync.Mutex
+}
+
+type upstreamState struct {
+	upstream Upstream
+
+	healthy        atomic.Bool
+	ejectedUntil   atomic.Int64
+	active         atomic.Int64
+	total          atomic.Int64
+	failures       atomic.Int64
+	serverErrors   atomic.Int64
+	ejections      atomic.Int64
+	healthCounter  int
+	currentWeight  int
+	outlierMu      sync.Mutex
+	consecutiveErr int
+	windowStart    time.Time
+	windowTotal    int
+	windowErrors   int
+}
+
+func (state *upstreamState) available(now time.Time) bool {
+	return state.healthy.Load() && state.ejectedUntil.Load() <= now.UnixNano()
+}
+
+// RoundTrip implements the [RoundTripper] interface.
+func (pool *UpstreamPool) RoundTrip(ctx context.Context, method specs.HttpMethod, url *specs.Url, header *specs.Header, writer BodyWriter) (ClientResponse, error) {
+	if url == nil {
+		panic("plow: nil url pointer")
+	}
+
+	state := pool.selectUpstream(url, header)
+	if state == nil {
+		return nil, specs.ErrNoUpstreamAvailable
+	}
+
+	upstreamUrl := *url
+	upstreamUrl.Scheme = state.upstream.Url.Scheme
+	upstreamUrl.Host = state.upstream.Url.Host
+	upstreamUrl.Port = state.upstream.Url.Port
+	if prefix := state.upstream.Url.Path; prefix != "" && prefix != "/" {
+		upstreamUrl.Path = joinUrlPath(prefix, url.Path)
+	}
+
+	state.active.Add(1)
+	state.total.Add(1)
+
+	resp, err := pool.transport().RoundTrip(ctx, method, &upstreamUrl, header, writer)
+	if err != nil {
+		state.active.Add(-1)
+		if !errors.Is(err, context.Canceled) {
+			state.failures.Add(1)
+			pool.reportOutlier(state, true, false)
+		}
+		return nil, err
+	}
+
+	isServerError := resp.StatusCode() >= 500
+	if isServerError {
+		state.serverErrors.Add(1)
+	}
+	pool.reportOutlier(state, false, isServerError)
+
+	if resp.Body() == nil {
+		state.active.Add(-1)
+		return resp, nil
+	}
+	return &upstreamResponse{ClientResponse: resp, state: state}, nil
+}
+
+// Stats returns the state and counters of each upstream
+// in the order they were provided to [NewUpstreamPool].
+func (pool *UpstreamPool) Stats() []UpstreamStats {
+	now := time.Now()
+	stats := make([]UpstreamStats, len(pool.states))
+	for i, state := range pool.states {
+		stats[i] = UpstreamStats{
+			Url:            state.upstream.Url,
+			Weight:         state.upstream.Weight,
+			Healthy:        state.healthy.Load(),
+			Ejected:        state.ejectedUntil.Load() > now.UnixNano(),
+			ActiveRequests: state.active.Load(),
+			TotalRequests:  state.total.Load(),
+			Failures:       state.failures.Load(),
+			ServerErrors:   state.serverErrors.Load(),
+			Ejections:      state.ejections.Load(),
+		}
+	}
+	return stats
+}
+
+// RunHealthChecks probes every upstream as configured by [UpstreamPool.HealthCheck]
+// until the context is done and returns the context error.
+//
+// If HealthCheck is nil, RunHealthChecks only waits for the context.
+func (pool *UpstreamPool) RunHealthChecks(ctx context.Context) error {
+	check := pool.HealthCheck
+	if check == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	interval := check.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var wg sync.WaitGroup
+		for _, state := range pool.states {
+			wg.Add(1)
+			go func(state *upstreamState) {
+				defer wg.Done()
+				pool.probe(ctx, check, state)
+			}(state)
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (pool *UpstreamPool) probe(ctx context.Context, check *HealthCheck, state *upstreamState) {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	url := *state.upstream.Url
+	url.Path = joinUrlPath(url.Path, check.Path)
+	url.Query = nil
+
+	var ok bool
+	resp, err := pool.transport().RoundTrip(ctx, specs.HttpMethodGet, &url, specs.NewHeader(), nil)
+	if err == nil {
+		if body := resp.Body(); body != nil {
+			io.Copy(io.Discard, body)
+			body.Close()
+		}
+		code := resp.StatusCode()
+		ok = 200 <= code && code < 300
+	} else if errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	healthy := state.healthy.Load()
+	if ok == healthy {
+		state.healthCounter = 0
+		return
+	}
+
+	threshold := check.UnhealthyThreshold
+	if ok {
+		threshold = check.HealthyThreshold
+	}
+
+	state.healthCounter++
+	if state.healthCounter >= threshold {
+		state.healthCounter = 0
+		state.healthy.Store(ok)
+	}
+}
+
+func (pool *UpstreamPool) reportOutlier(state *upstreamState, connErr, serverErr bool) {
+	detection := pool.OutlierDetection
+	if detection == nil {
+		return
+	}
+
+	state.outlierMu.Lock()
+	defer state.outlierMu.Unlock()
+
+	now := time.Now()
+	var eject bool
+
+	if connErr {
+		state.consecutiveErr++
+		eject = detection.ConsecutiveErrors > 0 && state.consecutiveErr >= detection.ConsecutiveErrors
+	} else {
+		state.consecutiveErr = 0
+
+		window := detection.Window
+		if window <= 0 {
+			window = 30 * time.Second
+		}
+		if now.Sub(state.windowStart) > window {
+			state.windowStart = now
+			state.windowTotal, state.windowErrors = 0, 0
+		}
+
+		state.windowTotal++
+		if serverErr {
+			state.windowErrors++
+		}
+
+		eject = detection.ServerErrorRatio > 0 &&
+			state.windowTotal >= detection.MinRequests &&
+			float64(state.windowErrors)/float64(state.windowTotal) >= detection.ServerErrorRatio
+	}
+
+	if eject {
+		ejectionTime := detection.EjectionTime
+		if ejectionTime <= 0 {
+			ejectionTime = 30 * time.Second
+		}
+
+		state.ejectedUntil.Store(now.Add(ejectionTime).UnixNano())
+		state.ejections.Add(1)
+		state.consecutiveErr = 0
+		state.windowStart = now
+		state.windowTotal, state.windowErrors = 0, 0
+	}
+}
+
+func (pool *UpstreamPool) selectUpstream(url *specs.Url, header *specs.Header) *upstreamState {
+	now := time.Now()
+
+	switch pool.strategy {
+	case BalanceLeastConnections:
+		var selected *upstreamState
+		offset := int(pool.next.Add(1))
+		for i := range pool.states {
+			state := pool.states[(offset+i)%len(pool.states)]
+			if !state.available(now) {
+				continue
+			}
+			if selected == nil || state.active.Load() < selected.active.Load() {
+				selected = state
+			}
+		}
+		return selected
+
+	case BalanceWeighted:
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+
+		var selected *upstreamState
+		var totalWeight int
+		for _, state := range pool.states {
+			if !state.available(now) {
+				continue
+			}
+			state.currentWeight += state.upstream.Weight
+			totalWeight += state.upstream.Weight
+			if selected == nil || state.currentWeight > selected.currentWeight {
+				selected = state
+			}
+		}
+		if selected != nil {
+			selected.currentWeight -= totalWeight
+		}
+		return selected
+
+	case BalanceConsistentHash:
+		var key string
+		if pool.HashKey != nil {
+			key = pool.HashKey(url, header)
+		} else {
+			key = url.Path
+		}
+		return pool.ring.lookup(key, now)
+
+	default:
+		offset := int(pool.next.Add(1) - 1)
+		for i := range pool.states {
+			state := pool.states[(offset+i)%len(pool.states)]
+			if state.available(now) {
+				return state
+			}
+		}
+		return nil
+	}
+}
+
+func (pool *UpstreamPool) transport() RoundTripper {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.Transport == nil {
+		pool.Transport = proxyTransport()
+	}
+	return pool.Transport
+}
+
+type upstreamResponse struct {
+	ClientResponse
+	state *upstreamState
+	once  sync.Once
+}
+
+func (resp *upstreamResponse) Body() io.ReadCloser {
+	return internal.ReadCloser(resp.ClientResponse.Body(), internal.CloserFunc(func() error {
+		resp.once.Do(func() {
+			resp.state.active.Add(-1)
+		})
+		return resp.ClientResponse.Body().Close()
+	}))
+}
+
+type hashRingPoint struct {
+	hash  uint32
+	state *upstreamState
+}
+
+type hashRing struct {
+	points []hashRingPoint
+}
+
+func newHashRing(states []*upstreamState) *hashRing {
+	ring := &hashRing{}
+	for _, state := range states {
+		base := state.upstream.Url.String()
+		for i := 0; i < state.upstream.Weight*consistentHashReplicas; i++ {
+			ring.points = append(ring.points, hashRingPoint{
+				hash:  crc32.ChecksumIEEE([]byte(base + "#" + strconv.Itoa(i))),
+				state: state,
+			})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		return ring.points[i].hash < ring.points[j].hash
+	})
+	return ring
+}
+
+func (ring *hashRing) lookup(key string, now time.Time) *upstreamState {
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(ring.points), func(i int) bool {
+		return ring.points[i].hash >= hash
+	})
+
+	for i := range ring.points {
+		point := ring.points[(start+i)%len(ring.points)]
+		if point.state.available(now) {
+			return point.state
+		}
+	}
+	return nil
+}
+
+func joinUrlPath(prefix, path string) string {
+	switch {
+	case prefix == "" || prefix == "/":
+		return path
+	case path == "" || path == "/":
+		return prefix
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(path, "/")
+}
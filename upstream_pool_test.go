@@ -0,0 +1,261 @@
+package plow
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oesand/plow/specs"
+)
+
+func newUpstreamTestServer(t *testing.T, name string, handler func(req Request) Response) *specs.Url {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := DefaultServer(HandlerFunc(func(ctx context.Context, req Request) Response {
+		if handler != nil {
+			if resp := handler(req); resp != nil {
+				return resp
+			}
+		}
+		return TextResponse(specs.StatusCodeOK, specs.ContentTypePlain, name)
+	}))
+	go server.Serve(listener)
+
+	return specs.MustParseUrl("http://" + listener.Addr().String())
+}
+
+func upstreamPoolGet(t *testing.T, pool *UpstreamPool, path string) string {
+	resp, err := pool.RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl("http://pool"+path), specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+
+	body := resp.Body()
+	if body == nil {
+		t.Fatal("response body is nil")
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal("read all:", err)
+	}
+	return string(data)
+}
+
+func TestUpstreamPool_RoundRobin(t *testing.T) {
+	pool := NewUpstreamPool(BalanceRoundRobin,
+		Upstream{Url: newUpstreamTestServer(t, "a", nil)},
+		Upstream{Url: newUpstreamTestServer(t, "b", nil)},
+		Upstream{Url: newUpstreamTestServer(t, "c", nil)},
+	)
+
+	var got string
+	for i := 0; i < 6; i++ {
+		got += upstreamPoolGet(t, pool, "/")
+	}
+
+	if got != "abcabc" {
+		t.Errorf("unexpected distribution: %s", got)
+	}
+
+	for _, stats := range pool.Stats() {
+		if stats.TotalRequests != 2 || stats.ActiveRequests != 0 {
+			t.Errorf("unexpected stats: %+v", stats)
+		}
+	}
+}
+
+func TestUpstreamPool_LargeChunkedResponse(t *testing.T) {
+	// The body is larger than the default limit of the transport
+	chunk := bytes.Repeat([]byte("0123456789abcdef"), 4<<10)
+	const chunks = 192
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for range chunks {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	pool := NewUpstreamPool(BalanceRoundRobin, Upstream{Url: specs.MustParseUrl(upstream.URL)})
+
+	got := upstreamPoolGet(t, pool, "/download")
+	if expected := len(chunk) * chunks; len(got) != expected {
+		t.Errorf("unexpected body size: %d, want %d", len(got), expected)
+	}
+}
+
+func TestUpstreamPool_Weighted(t *testing.T) {
+	pool := NewUpstreamPool(BalanceWeighted,
+		Upstream{Url: newUpstreamTestServer(t, "a", nil), Weight: 3},
+		Upstream{Url: newUpstreamTestServer(t, "b", nil), Weight: 1},
+	)
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		counts[upstreamPoolGet(t, pool, "/")]++
+	}
+
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Errorf("unexpected distribution: %+v", counts)
+	}
+}
+
+func TestUpstreamPool_LeastConnections(t *testing.T) {
+	pool := NewUpstreamPool(BalanceLeastConnections,
+		Upstream{Url: newUpstreamTestServer(t, "a", nil)},
+		Upstream{Url: newUpstreamTestServer(t, "b", nil)},
+	)
+
+	resp, err := pool.RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl("http://pool/"), specs.NewHeader(), nil)
+	if err != nil {
+		t.Fatal("req:", err)
+	}
+	held, _ := io.ReadAll(resp.Body())
+
+	for i := 0; i < 3; i++ {
+		if got := upstreamPoolGet(t, pool, "/"); got == string(held) {
+			t.Errorf("request is sent to the busy upstream %s", got)
+		}
+	}
+
+	resp.Body().Close()
+
+	for _, stats := range pool.Stats() {
+		if stats.ActiveRequests != 0 {
+			t.Errorf("unexpected active requests: %+v", stats)
+		}
+	}
+}
+
+func TestUpstreamPool_ConsistentHash(t *testing.T) {
+	pool := NewUpstreamPool(BalanceConsistentHash,
+		Upstream{Url: newUpstreamTestServer(t, "a", nil)},
+		Upstream{Url: newUpstreamTestServer(t, "b", nil)},
+		Upstream{Url: newUpstreamTestServer(t, "c", nil)},
+	)
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/3", "/orders/42"} {
+		first := upstreamPoolGet(t, pool, path)
+		for i := 0; i < 3; i++ {
+			if got := upstreamPoolGet(t, pool, path); got != first {
+				t.Errorf("key %s moved from %s to %s", path, first, got)
+			}
+		}
+	}
+}
+
+func TestUpstreamPool_HealthCheck(t *testing.T) {
+	unhealthy := func(req Request) Response {
+		if req.Url().Path == "/health" {
+			return TextResponse(specs.StatusCodeServiceUnavailable, specs.ContentTypePlain, "down")
+		}
+		return nil
+	}
+
+	pool := NewUpstreamPool(BalanceRoundRobin,
+		Upstream{Url: newUpstreamTestServer(t, "a", nil)},
+		Upstream{Url: newUpstreamTestServer(t, "b", unhealthy)},
+	)
+	pool.HealthCheck = &HealthCheck{Path: "/health", Interval: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pool.RunHealthChecks(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Stats()[1].Healthy {
+		if time.Now().After(deadline) {
+			t.Fatal("upstream is not marked as unhealthy")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if !pool.Stats()[0].Healthy {
+		t.Error("healthy upstream is marked as unhealthy")
+	}
+
+	for i := 0; i < 4; i++ {
+		if got := upstreamPoolGet(t, pool, "/"); got != "a" {
+			t.Errorf("request is sent to the unhealthy upstream %s", got)
+		}
+	}
+}
+
+func TestUpstreamPool_EjectOnConnectionErrors(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedUrl := specs.MustParseUrl("http://" + listener.Addr().String())
+	listener.Close()
+
+	pool := NewUpstreamPool(BalanceRoundRobin,
+		Upstream{Url: closedUrl},
+		Upstream{Url: newUpstreamTestServer(t, "b", nil)},
+	)
+	pool.OutlierDetection = &OutlierDetection{ConsecutiveErrors: 1}
+
+	_, err = pool.RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl("http://pool/"), specs.NewHeader(), nil)
+	if err == nil {
+		t.Fatal("expected connection error")
+	}
+
+	for i := 0; i < 4; i++ {
+		if got := upstreamPoolGet(t, pool, "/"); got != "b" {
+			t.Errorf("unexpected upstream %s", got)
+		}
+	}
+
+	stats := pool.Stats()[0]
+	if !stats.Ejected || stats.Ejections != 1 || stats.Failures != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestUpstreamPool_EjectOnServerErrors(t *testing.T) {
+	failing := func(req Request) Response {
+		return TextResponse(specs.StatusCodeInternalServerError, specs.ContentTypePlain, "fail")
+	}
+
+	pool := NewUpstreamPool(BalanceRoundRobin,
+		Upstream{Url: newUpstreamTestServer(t, "a", failing)},
+		Upstream{Url: newUpstreamTestServer(t, "b", nil)},
+	)
+	pool.OutlierDetection = &OutlierDetection{ServerErrorRatio: 0.5, MinRequests: 2}
+
+	for i := 0; i < 4; i++ {
+		upstreamPoolGet(t, pool, "/")
+	}
+
+	stats := pool.Stats()[0]
+	if !stats.Ejected || stats.ServerErrors != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	for i := 0; i < 4; i++ {
+		if got := upstreamPoolGet(t, pool, "/"); got != "b" {
+			t.Errorf("request is sent to the ejected upstream %s", got)
+		}
+	}
+}
+
+func TestUpstreamPool_NoUpstreamAvailable(t *testing.T) {
+	pool := NewUpstreamPool(BalanceRoundRobin, Upstream{Url: newUpstreamTestServer(t, "a", nil)})
+	pool.OutlierDetection = &OutlierDetection{ServerErrorRatio: 1}
+	pool.states[0].ejectedUntil.Store(time.Now().Add(time.Hour).UnixNano())
+
+	_, err := pool.RoundTrip(context.Background(), specs.HttpMethodGet, specs.MustParseUrl("http://pool/"), specs.NewHeader(), nil)
+	if err != specs.ErrNoUpstreamAvailable {
+		t.Errorf("unexpected error: %v", err)
+	}
+}